@@ -0,0 +1,916 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// API is the exported API of a package as reported by asty api. Items are
+// sorted by name and do not carry positions, so the result only changes
+// along with the API and its documentation.
+type API struct {
+	Package   string      `json:"Package"`
+	Doc       string      `json:"Doc,omitempty"`
+	Constants []*APIValue `json:"Constants"`
+	Variables []*APIValue `json:"Variables"`
+	Types     []*APIType  `json:"Types"`
+	Functions []*APIFunc  `json:"Functions"`
+}
+
+// APIValue is an exported constant or variable. Value is the expression of a
+// constant, repeated for constants of a group without one, and Constant its
+// exact value when it can be evaluated without type checking. The type of
+// variables declared without one is inferred from literals and conversions,
+// Value is their initializer otherwise.
+type APIValue struct {
+	Name     string `json:"Name"`
+	Type     string `json:"Type,omitempty"`
+	Value    string `json:"Value,omitempty"`
+	Constant string `json:"Constant,omitempty"`
+	Doc      string `json:"Doc,omitempty"`
+}
+
+// APIType is an exported type. Kind is struct, interface, func, map, slice,
+// array, chan, pointer or defined for other types, which are given in Type.
+// Fields are the exported fields of structs and the embedded elements of
+// interfaces, Methods the exported methods of interfaces or the method set of
+// other types, methods promoted from embedded fields of the package included.
+// Comparable tells whether a struct may be compared
+// with ==, Unexported whether an interface has unexported methods, so it can
+// not be implemented by other packages.
+type APIType struct {
+	Name       string      `json:"Name"`
+	Kind       string      `json:"Kind"`
+	TypeParams string      `json:"TypeParams,omitempty"`
+	Alias      bool        `json:"Alias,omitempty"`
+	Type       string      `json:"Type,omitempty"`
+	Comparable bool        `json:"Comparable,omitempty"`
+	Unexported bool        `json:"Unexported,omitempty"`
+	Fields     []*APIField `json:"Fields,omitempty"`
+	Methods    []*APIFunc  `json:"Methods,omitempty"`
+	Doc        string      `json:"Doc,omitempty"`
+}
+
+// APIField is a field of a struct or an embedded element of an interface.
+type APIField struct {
+	Name     string `json:"Name"`
+	Type     string `json:"Type"`
+	Embedded bool   `json:"Embedded,omitempty"`
+	Tag      string `json:"Tag,omitempty"`
+	Doc      string `json:"Doc,omitempty"`
+}
+
+// APIFunc is an exported function or method. Params and Results list a type
+// per parameter, Signature is the whole function type with parameter names.
+// Recv is T or *T for methods in the method set of T or only in the one of *T.
+// Promoted is the type a method promoted from an embedded field is declared
+// on.
+type APIFunc struct {
+	Name       string   `json:"Name"`
+	Recv       string   `json:"Recv,omitempty"`
+	Promoted   string   `json:"Promoted,omitempty"`
+	TypeParams string   `json:"TypeParams,omitempty"`
+	Params     []string `json:"Params"`
+	Results    []string `json:"Results"`
+	Signature  string   `json:"Signature"`
+	Doc        string   `json:"Doc,omitempty"`
+}
+
+// LoadPackage marshals the go files of the package in dir that match the
+// default build context, test files excluded.
+func LoadPackage(dir string, options Options) (*PackageNode, error) {
+	pkg, err := build.Default.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := &PackageNode{
+		Node:  Node{NodeType: "Package"},
+		Name:  pkg.Name,
+		Files: make(map[string]*FileNode),
+	}
+	filenames := append(append([]string(nil), pkg.GoFiles...), pkg.CgoFiles...)
+	for _, filename := range filenames {
+		marshaller := NewMarshaller(options)
+		path := filepath.Join(dir, filename)
+		mode := parser.SkipObjectResolution
+		if options.WithComments {
+			mode |= parser.ParseComments
+		}
+		tree, err := parser.ParseFile(marshaller.FileSet(), path, nil, mode)
+		if err != nil {
+			return nil, err
+		}
+		result.Files[path] = marshaller.MarshalFile(tree)
+	}
+	return result, nil
+}
+
+type apiCollector struct {
+	um      *Unmarshaller
+	api     *API
+	types   map[string]*APIType
+	methods map[string][]*APIFunc
+	// Constants and types of the package, unexported ones included, which
+	// exported constants and structs refer to.
+	consts    map[string]*apiConst
+	typeExprs map[string]IExprNode
+	values    map[*APIValue]*apiConst
+	structs   map[*APIType]*StructTypeNode
+}
+
+type apiConst struct {
+	expr      IExprNode
+	typ       IExprNode
+	iota      int
+	value     constant.Value
+	valueType constType
+	state     int
+}
+
+// CollectAPI describes the exported API of a package, which must be marshalled
+// with positions to tell aliases apart and with comments to get docs.
+func CollectAPI(pkg *PackageNode) *API {
+	c := &apiCollector{
+		um: NewUnmarshaller(Options{WithComments: true}),
+		api: &API{
+			Package:   pkg.Name,
+			Constants: make([]*APIValue, 0),
+			Variables: make([]*APIValue, 0),
+			Types:     make([]*APIType, 0),
+			Functions: make([]*APIFunc, 0),
+		},
+		types:     make(map[string]*APIType),
+		methods:   make(map[string][]*APIFunc),
+		consts:    make(map[string]*apiConst),
+		typeExprs: make(map[string]IExprNode),
+		values:    make(map[*APIValue]*apiConst),
+		structs:   make(map[*APIType]*StructTypeNode),
+	}
+	filenames := make([]string, 0, len(pkg.Files))
+	for filename := range pkg.Files {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+	var docs []string
+	for _, filename := range filenames {
+		file := pkg.Files[filename]
+		if doc := c.doc(file.Doc); doc != "" {
+			docs = append(docs, doc)
+		}
+		for _, decl := range file.Decls {
+			switch d := decl.(type) {
+			case *GenDeclNode:
+				c.genDecl(d)
+			case *FuncDeclNode:
+				c.funcDecl(d)
+			}
+		}
+	}
+	c.api.Doc = strings.Join(docs, "\n")
+
+	for value, entry := range c.values {
+		if result, _ := c.constant(entry); result.Kind() != constant.Unknown {
+			value.Constant = result.ExactString()
+		}
+	}
+	for apiType, structType := range c.structs {
+		apiType.Comparable = c.comparable(structType, make(map[string]bool))
+	}
+
+	for name, methods := range c.methods {
+		if apiType := c.types[name]; apiType != nil {
+			apiType.Methods = append(apiType.Methods, methods...)
+		}
+	}
+	for _, apiType := range c.api.Types {
+		if _, ok := c.typeExprs[apiType.Name].(*StructTypeNode); ok && !apiType.Alias {
+			apiType.Methods = append(apiType.Methods, c.promoted(apiType.Name)...)
+		}
+	}
+	sort.SliceStable(c.api.Constants, func(i, j int) bool { return c.api.Constants[i].Name < c.api.Constants[j].Name })
+	sort.SliceStable(c.api.Variables, func(i, j int) bool { return c.api.Variables[i].Name < c.api.Variables[j].Name })
+	sort.SliceStable(c.api.Functions, func(i, j int) bool { return c.api.Functions[i].Name < c.api.Functions[j].Name })
+	sort.SliceStable(c.api.Types, func(i, j int) bool { return c.api.Types[i].Name < c.api.Types[j].Name })
+	for _, apiType := range c.api.Types {
+		sort.SliceStable(apiType.Methods, func(i, j int) bool { return apiType.Methods[i].Name < apiType.Methods[j].Name })
+	}
+	return c.api
+}
+
+func (c *apiCollector) doc(group *CommentGroupNode) string {
+	if group == nil {
+		return ""
+	}
+	return c.um.UnmarshalCommentGroupNode(group).Text()
+}
+
+// specDoc returns the doc of a spec, or the one of its declaration if the
+// spec is the only one, like go/doc does.
+func (c *apiCollector) specDoc(decl *GenDeclNode, doc *CommentGroupNode) string {
+	if doc == nil && len(decl.Specs) == 1 {
+		doc = decl.Doc
+	}
+	return c.doc(doc)
+}
+
+func (c *apiCollector) print(node any) string {
+	var output bytes.Buffer
+	err := printer.Fprint(&output, c.um.FileSet(), node)
+	if err != nil {
+		panic(err)
+	}
+	return output.String()
+}
+
+// expr prints a type or a value. Types are normalized, so that the way fields
+// are grouped and parameters are named does not change them.
+func (c *apiCollector) expr(expr IExprNode) string {
+	if expr == nil {
+		return ""
+	}
+	node := c.um.UnmarshalExpr(expr)
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.StructType:
+			n.Fields.List = splitFields(n.Fields.List, false)
+		case *ast.FuncType:
+			if n.Params != nil {
+				n.Params.List = splitFields(n.Params.List, true)
+			}
+			if n.Results != nil {
+				n.Results.List = splitFields(n.Results.List, true)
+			}
+		}
+		return true
+	})
+	return c.print(node)
+}
+
+// splitFields makes a field of every name of fields, or drops the names.
+func splitFields(fields []*ast.Field, unnamed bool) []*ast.Field {
+	var result []*ast.Field
+	for _, field := range fields {
+		if len(field.Names) <= 1 && !unnamed {
+			result = append(result, field)
+			continue
+		}
+		count := len(field.Names)
+		if count == 0 {
+			count = 1
+		}
+		for index := 0; index < count; index++ {
+			split := *field
+			split.Names = nil
+			if !unnamed {
+				split.Names = []*ast.Ident{field.Names[index]}
+			}
+			result = append(result, &split)
+		}
+	}
+	return result
+}
+
+func (c *apiCollector) typeParams(list *FieldListNode) string {
+	if list == nil || len(list.List) == 0 {
+		return ""
+	}
+	params := make([]string, len(list.List))
+	for index, field := range list.List {
+		names := make([]string, len(field.Names))
+		for i, name := range field.Names {
+			names[i] = name.Name
+		}
+		params[index] = strings.Join(names, ", ") + " " + c.expr(field.Type)
+	}
+	return "[" + strings.Join(params, ", ") + "]"
+}
+
+// fieldTypes lists a type for every name of the fields, or one for unnamed
+// fields.
+func (c *apiCollector) fieldTypes(list *FieldListNode) []string {
+	result := make([]string, 0)
+	if list == nil {
+		return result
+	}
+	for _, field := range list.List {
+		count := len(field.Names)
+		if count == 0 {
+			count = 1
+		}
+		for index := 0; index < count; index++ {
+			result = append(result, c.expr(field.Type))
+		}
+	}
+	return result
+}
+
+func (c *apiCollector) funcType(name string, funcType *FuncTypeNode, doc *CommentGroupNode) *APIFunc {
+	signature := c.um.UnmarshalFuncTypeNode(funcType)
+	signature.TypeParams = nil
+	return &APIFunc{
+		Name:       name,
+		TypeParams: c.typeParams(funcType.TypeParams),
+		Params:     c.fieldTypes(funcType.Params),
+		Results:    c.fieldTypes(funcType.Results),
+		Signature:  c.print(signature),
+		Doc:        c.doc(doc),
+	}
+}
+
+func (c *apiCollector) genDecl(decl *GenDeclNode) {
+	var previous *ValueSpecNode
+	for specIndex, spec := range decl.Specs {
+		switch s := spec.(type) {
+		case *ValueSpecNode:
+			// Constants without values repeat the type and values of the
+			// previous spec.
+			typeSpec := s
+			if decl.Tok == token.CONST.String() && s.Type == nil && len(s.Values) == 0 && previous != nil {
+				typeSpec = previous
+			} else {
+				previous = s
+			}
+			for index, name := range s.Names {
+				var entry *apiConst
+				if decl.Tok == token.CONST.String() {
+					entry = &apiConst{typ: typeSpec.Type, iota: specIndex}
+					if index < len(typeSpec.Values) {
+						entry.expr = typeSpec.Values[index]
+					}
+					c.consts[name.Name] = entry
+				}
+				if !token.IsExported(name.Name) {
+					continue
+				}
+				value := &APIValue{Name: name.Name, Type: c.expr(typeSpec.Type), Doc: c.specDoc(decl, s.Doc)}
+				if entry != nil {
+					value.Value = c.expr(entry.expr)
+					c.values[value] = entry
+					c.api.Constants = append(c.api.Constants, value)
+					continue
+				}
+				if value.Type == "" && len(s.Values) > 0 {
+					// Values of several results are given by their call.
+					init := s.Values[0]
+					if index < len(s.Values) {
+						init = s.Values[index]
+					}
+					value.Type = c.varType(init)
+					if value.Type == "" {
+						value.Value = c.expr(init)
+					}
+				}
+				c.api.Variables = append(c.api.Variables, value)
+			}
+		case *TypeSpecNode:
+			c.typeExprs[s.Name.Name] = s.Type
+			if token.IsExported(s.Name.Name) {
+				c.typeSpec(decl, s)
+			}
+		}
+	}
+}
+
+// varType infers the type of a variable declared without one from its value
+// when it is a literal, a composite literal or a conversion.
+func (c *apiCollector) varType(value IExprNode) string {
+	switch v := value.(type) {
+	case *BasicLitNode:
+		switch StringToToken[v.Kind] {
+		case token.INT:
+			return "int"
+		case token.FLOAT:
+			return "float64"
+		case token.IMAG:
+			return "complex128"
+		case token.CHAR:
+			return "rune"
+		case token.STRING:
+			return "string"
+		}
+	case *IdentNode:
+		if v.Name == "true" || v.Name == "false" {
+			return "bool"
+		}
+	case *ParenExprNode:
+		return c.varType(v.X)
+	case *CompositeLitNode:
+		return c.expr(v.Type)
+	case *FuncLitNode:
+		return c.expr(v.Type)
+	case *UnaryExprNode:
+		switch v.Op {
+		case token.AND.String():
+			if composite, ok := v.X.(*CompositeLitNode); ok && composite.Type != nil {
+				return "*" + c.expr(composite.Type)
+			}
+		case token.ADD.String(), token.SUB.String(), token.XOR.String():
+			if _, ok := v.X.(*BasicLitNode); ok {
+				return c.varType(v.X)
+			}
+		}
+	case *CallExprNode:
+		if len(v.Args) == 1 && c.constType(v.Fun, make(map[string]bool)).kind != constant.Unknown {
+			return c.expr(v.Fun)
+		}
+	}
+	return ""
+}
+
+func (c *apiCollector) typeSpec(decl *GenDeclNode, spec *TypeSpecNode) {
+	apiType := &APIType{
+		Name:       spec.Name.Name,
+		TypeParams: c.typeParams(spec.TypeParams),
+		Alias:      spec.Assign != nil,
+		Doc:        c.specDoc(decl, spec.Doc),
+	}
+	switch t := spec.Type.(type) {
+	case *StructTypeNode:
+		apiType.Kind = "struct"
+		c.structs[apiType] = t
+		for _, field := range t.Fields.List {
+			c.structField(apiType, field)
+		}
+	case *InterfaceTypeNode:
+		apiType.Kind = "interface"
+		for _, field := range t.Methods.List {
+			if len(field.Names) == 0 {
+				apiType.Fields = append(apiType.Fields, &APIField{
+					Name:     c.expr(field.Type),
+					Type:     c.expr(field.Type),
+					Embedded: true,
+					Doc:      c.doc(field.Doc),
+				})
+				continue
+			}
+			for _, name := range field.Names {
+				if !token.IsExported(name.Name) {
+					apiType.Unexported = true
+					continue
+				}
+				if funcType, ok := field.Type.(*FuncTypeNode); ok {
+					apiType.Methods = append(apiType.Methods, c.funcType(name.Name, funcType, field.Doc))
+				}
+			}
+		}
+	default:
+		apiType.Kind = typeKind(spec.Type)
+		apiType.Type = c.expr(spec.Type)
+	}
+	c.types[apiType.Name] = apiType
+	c.api.Types = append(c.api.Types, apiType)
+}
+
+func (c *apiCollector) structField(apiType *APIType, field *FieldNode) {
+	tag := ""
+	if field.Tag != nil {
+		tag = field.Tag.Value
+	}
+	fieldType := c.expr(field.Type)
+	if len(field.Names) == 0 {
+		// Embedded fields are named after their type.
+		name, _ := baseTypeName(field.Type)
+		if token.IsExported(name) {
+			apiType.Fields = append(apiType.Fields, &APIField{
+				Name: name, Type: fieldType, Embedded: true, Tag: tag, Doc: c.doc(field.Doc),
+			})
+		}
+		return
+	}
+	for _, name := range field.Names {
+		if token.IsExported(name.Name) {
+			apiType.Fields = append(apiType.Fields, &APIField{
+				Name: name.Name, Type: fieldType, Tag: tag, Doc: c.doc(field.Doc),
+			})
+		}
+	}
+}
+
+// constant evaluates a constant of the package the way the compiler does.
+// Constants of other packages, of types other than basic ones and the types of
+// the package based on them, and calls of builtin functions are unknown.
+func (c *apiCollector) constant(entry *apiConst) (constant.Value, constType) {
+	switch entry.state {
+	case 1:
+		return constant.MakeUnknown(), constType{}
+	case 2:
+		return entry.value, entry.valueType
+	}
+	entry.state = 1
+	value, valueType := c.evaluate(entry.expr, entry.iota)
+	if entry.typ != nil {
+		valueType = c.constType(entry.typ, make(map[string]bool))
+		value = convertConstant(value, valueType)
+	}
+	entry.value, entry.valueType = value, valueType
+	entry.state = 2
+	return entry.value, entry.valueType
+}
+
+// constType is the type of a constant as far as its value is concerned. Typed
+// constants have values of kind, and unsigned integers the given size.
+// Unknown types are typed with an unknown kind.
+type constType struct {
+	typed    bool
+	kind     constant.Kind
+	unsigned uint
+}
+
+func (c *apiCollector) constType(expr IExprNode, seen map[string]bool) constType {
+	switch e := expr.(type) {
+	case *ParenExprNode:
+		return c.constType(e.X, seen)
+	case *IdentNode:
+		if typeExpr := c.typeExprs[e.Name]; typeExpr != nil {
+			if seen[e.Name] {
+				break
+			}
+			seen[e.Name] = true
+			return c.constType(typeExpr, seen)
+		}
+		switch e.Name {
+		case "int", "int8", "int16", "int32", "int64", "rune":
+			return constType{typed: true, kind: constant.Int}
+		case "uint", "uint64", "uintptr":
+			return constType{typed: true, kind: constant.Int, unsigned: 64}
+		case "uint8", "byte":
+			return constType{typed: true, kind: constant.Int, unsigned: 8}
+		case "uint16":
+			return constType{typed: true, kind: constant.Int, unsigned: 16}
+		case "uint32":
+			return constType{typed: true, kind: constant.Int, unsigned: 32}
+		case "float32", "float64":
+			return constType{typed: true, kind: constant.Float}
+		case "complex64", "complex128":
+			return constType{typed: true, kind: constant.Complex}
+		case "string":
+			return constType{typed: true, kind: constant.String}
+		case "bool":
+			return constType{typed: true, kind: constant.Bool}
+		}
+	}
+	return constType{typed: true, kind: constant.Unknown}
+}
+
+// convertConstant converts a value to a type, or makes it unknown if it can
+// not be.
+func convertConstant(value constant.Value, valueType constType) constant.Value {
+	if !valueType.typed {
+		return value
+	}
+	switch valueType.kind {
+	case constant.Int:
+		value = constant.ToInt(value)
+	case constant.Float:
+		value = constant.ToFloat(value)
+	case constant.Complex:
+		value = constant.ToComplex(value)
+	}
+	if value.Kind() != valueType.kind {
+		return constant.MakeUnknown()
+	}
+	return value
+}
+
+func (c *apiCollector) evaluate(expr IExprNode, iota int) (constant.Value, constType) {
+	unknown := constant.MakeUnknown()
+	switch e := expr.(type) {
+	case *BasicLitNode:
+		return constant.MakeFromLiteral(e.Value, StringToToken[e.Kind], 0), constType{}
+	case *IdentNode:
+		switch e.Name {
+		case "iota":
+			return constant.MakeInt64(int64(iota)), constType{}
+		case "true", "false":
+			return constant.MakeBool(e.Name == "true"), constType{}
+		}
+		if entry := c.consts[e.Name]; entry != nil {
+			return c.constant(entry)
+		}
+	case *ParenExprNode:
+		return c.evaluate(e.X, iota)
+	case *CallExprNode:
+		// Calls of builtin functions are not conversions and have unknown
+		// types.
+		if len(e.Args) == 1 && e.Ellipsis == nil {
+			x, _ := c.evaluate(e.Args[0], iota)
+			valueType := c.constType(e.Fun, make(map[string]bool))
+			return convertConstant(x, valueType), valueType
+		}
+	case *UnaryExprNode:
+		x, valueType := c.evaluate(e.X, iota)
+		op := StringToToken[e.Op]
+		if !unaryConstant(op, x) {
+			return unknown, valueType
+		}
+		return convertConstant(constant.UnaryOp(op, x, valueType.unsigned), valueType), valueType
+	case *BinaryExprNode:
+		return c.binary(e, iota)
+	}
+	return unknown, constType{}
+}
+
+func (c *apiCollector) binary(expr *BinaryExprNode, iota int) (constant.Value, constType) {
+	unknown := constant.MakeUnknown()
+	x, xType := c.evaluate(expr.X, iota)
+	y, yType := c.evaluate(expr.Y, iota)
+	op := StringToToken[expr.Op]
+	if op == token.SHL || op == token.SHR {
+		// The result has the type of x, an integer if untyped.
+		if !xType.typed {
+			x = constant.ToInt(x)
+		}
+		shift, ok := constant.Uint64Val(constant.ToInt(y))
+		if !ok || x.Kind() != constant.Int {
+			return unknown, xType
+		}
+		return convertConstant(constant.Shift(x, op, uint(shift)), xType), xType
+	}
+
+	// Untyped operands are converted to the type of the other one.
+	valueType := xType
+	if !valueType.typed {
+		valueType = yType
+	}
+	x, y = convertConstant(x, valueType), convertConstant(y, valueType)
+	if !binaryConstant(op, x, y) {
+		return unknown, valueType
+	}
+	switch op {
+	case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return constant.MakeBool(constant.Compare(x, op, y)), constType{}
+	case token.QUO, token.REM:
+		if constant.Sign(y) == 0 {
+			return unknown, valueType
+		}
+		// Integer operands, typed or not, are divided with truncation.
+		if op == token.QUO && x.Kind() == constant.Int && y.Kind() == constant.Int {
+			op = token.QUO_ASSIGN
+		}
+	}
+	return convertConstant(constant.BinaryOp(x, op, y), valueType), valueType
+}
+
+func numericConstant(value constant.Value) bool {
+	kind := value.Kind()
+	return kind == constant.Int || kind == constant.Float || kind == constant.Complex
+}
+
+// unaryConstant tells whether op applies to x, which constant.UnaryOp panics
+// for otherwise.
+func unaryConstant(op token.Token, x constant.Value) bool {
+	switch op {
+	case token.ADD, token.SUB:
+		return numericConstant(x)
+	case token.XOR:
+		return x.Kind() == constant.Int
+	case token.NOT:
+		return x.Kind() == constant.Bool
+	}
+	return false
+}
+
+// binaryConstant tells whether op applies to x and y, which
+// constant.BinaryOp and constant.Compare panic for otherwise.
+func binaryConstant(op token.Token, x, y constant.Value) bool {
+	numeric := numericConstant(x) && numericConstant(y)
+	switch op {
+	case token.ADD:
+		return numeric || x.Kind() == constant.String && y.Kind() == constant.String
+	case token.SUB, token.MUL, token.QUO:
+		return numeric
+	case token.REM, token.AND, token.OR, token.XOR, token.AND_NOT:
+		return x.Kind() == constant.Int && y.Kind() == constant.Int
+	case token.LAND, token.LOR:
+		return x.Kind() == constant.Bool && y.Kind() == constant.Bool
+	case token.EQL, token.NEQ:
+		return numeric || x.Kind() == y.Kind() && x.Kind() != constant.Unknown
+	case token.LSS, token.LEQ, token.GTR, token.GEQ:
+		return numeric && x.Kind() != constant.Complex && y.Kind() != constant.Complex ||
+			x.Kind() == constant.String && y.Kind() == constant.String
+	}
+	return false
+}
+
+// comparable tells whether values of a type may be compared with ==. Types
+// of other packages and type parameters are taken as comparable.
+func (c *apiCollector) comparable(expr IExprNode, seen map[string]bool) bool {
+	switch t := expr.(type) {
+	case *FuncTypeNode, *MapTypeNode:
+		return false
+	case *ArrayTypeNode:
+		return t.Len != nil && c.comparable(t.Elt, seen)
+	case *StructTypeNode:
+		for _, field := range t.Fields.List {
+			if !c.comparable(field.Type, seen) {
+				return false
+			}
+		}
+		return true
+	case *ParenExprNode:
+		return c.comparable(t.X, seen)
+	case *IndexExprNode:
+		return c.comparable(t.X, seen)
+	case *IndexListExprNode:
+		return c.comparable(t.X, seen)
+	case *IdentNode:
+		typeExpr := c.typeExprs[t.Name]
+		if typeExpr == nil || seen[t.Name] {
+			return true
+		}
+		seen[t.Name] = true
+		return c.comparable(typeExpr, seen)
+	}
+	return true
+}
+
+func typeKind(expr IExprNode) string {
+	switch t := expr.(type) {
+	case *FuncTypeNode:
+		return "func"
+	case *MapTypeNode:
+		return "map"
+	case *ArrayTypeNode:
+		if t.Len == nil {
+			return "slice"
+		}
+		return "array"
+	case *ChanTypeNode:
+		return "chan"
+	case *StarExprNode:
+		return "pointer"
+	case *ParenExprNode:
+		return typeKind(t.X)
+	}
+	return "defined"
+}
+
+func (c *apiCollector) funcDecl(decl *FuncDeclNode) {
+	if !token.IsExported(decl.Name.Name) {
+		return
+	}
+	function := c.funcType(decl.Name.Name, decl.Type, decl.Doc)
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		c.api.Functions = append(c.api.Functions, function)
+		return
+	}
+	// Methods of unexported types may be promoted to exported ones.
+	name, pointer := baseTypeName(decl.Recv.List[0].Type)
+	function.Recv = name
+	if pointer {
+		function.Recv = "*" + name
+	}
+	c.methods[name] = append(c.methods[name], function)
+}
+
+// promoted returns the exported methods promoted to a struct type from its
+// embedded fields of types of the package. Like selectors, fields and methods
+// found at a shallower depth hide the ones below and the ones found twice at
+// the same depth are ambiguous.
+func (c *apiCollector) promoted(typeName string) []*APIFunc {
+	type embedding struct {
+		name    string
+		pointer bool
+	}
+	hidden := make(map[string]bool)
+	for _, method := range c.methods[typeName] {
+		hidden[method.Name] = true
+	}
+	visited := make(map[string]bool)
+	level := []embedding{{name: typeName}}
+	var result []*APIFunc
+	for depth := 0; len(level) > 0; depth++ {
+		counts := make(map[string]int)
+		methods := make(map[string]*APIFunc)
+		pointers := make(map[string]bool)
+		var next []embedding
+		for _, e := range level {
+			if visited[e.name] {
+				continue
+			}
+			if depth > 0 {
+				for _, method := range c.methods[e.name] {
+					counts[method.Name]++
+					methods[method.Name] = method
+					pointers[method.Name] = e.pointer
+				}
+			}
+			structType, ok := c.typeExprs[e.name].(*StructTypeNode)
+			if !ok {
+				continue
+			}
+			for _, field := range structType.Fields.List {
+				for _, name := range field.Names {
+					counts[name.Name]++
+				}
+				if len(field.Names) == 0 {
+					name, pointer := baseTypeName(field.Type)
+					counts[name]++
+					if isLocalType(field.Type) {
+						next = append(next, embedding{name: name, pointer: e.pointer || pointer})
+					}
+				}
+			}
+		}
+		for _, e := range level {
+			visited[e.name] = true
+		}
+		for name, count := range counts {
+			if hidden[name] {
+				continue
+			}
+			hidden[name] = true
+			method := methods[name]
+			if count > 1 || method == nil {
+				continue
+			}
+			// Methods of *E are promoted to T only through pointers.
+			promoted := *method
+			promoted.Recv = typeName
+			if strings.HasPrefix(method.Recv, "*") && !pointers[name] {
+				promoted.Recv = "*" + typeName
+			}
+			promoted.Promoted = strings.TrimPrefix(method.Recv, "*")
+			result = append(result, &promoted)
+		}
+		level = next
+	}
+	return result
+}
+
+// isLocalType tells whether a type expression names a type of the package.
+func isLocalType(expr IExprNode) bool {
+	switch e := expr.(type) {
+	case *StarExprNode:
+		return isLocalType(e.X)
+	case *ParenExprNode:
+		return isLocalType(e.X)
+	case *IndexExprNode:
+		return isLocalType(e.X)
+	case *IndexListExprNode:
+		return isLocalType(e.X)
+	case *IdentNode:
+		return true
+	}
+	return false
+}
+
+// baseTypeName returns the name of a type without package, pointer and type
+// arguments, which names embedded fields and receivers, and whether it is a
+// pointer.
+func baseTypeName(expr IExprNode) (string, bool) {
+	pointer := false
+	for {
+		switch e := expr.(type) {
+		case *StarExprNode:
+			pointer = true
+			expr = e.X
+		case *ParenExprNode:
+			expr = e.X
+		case *IndexExprNode:
+			expr = e.X
+		case *IndexListExprNode:
+			expr = e.X
+		case *SelectorExprNode:
+			return e.Sel.Name, pointer
+		case *IdentNode:
+			return e.Name, pointer
+		default:
+			return "", pointer
+		}
+	}
+}
+
+func loadAPI(dir string) (*API, error) {
+	pkg, err := LoadPackage(dir, Options{WithPositions: true, WithComments: true})
+	if err != nil {
+		return nil, err
+	}
+	return CollectAPI(pkg), nil
+}
+
+func APIToJSON(dir, output string, indent string) error {
+	api, err := loadAPI(dir)
+	if err != nil {
+		return err
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	encoder := json.NewEncoder(outFile)
+	encoder.SetIndent("", indent)
+	return encoder.Encode(api)
+}
@@ -0,0 +1,279 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const apiSource = `// Package p is documented.
+package p
+
+import "io"
+
+// Kinds are documented on the group only.
+const (
+	A Kind = iota
+	B
+	c
+)
+
+const Pi = 3.14
+
+var (
+	// Default is the default.
+	Default, other = New(), 1
+)
+
+// Kind is a kind.
+type Kind int
+
+// Alias is an alias.
+type Alias = Kind
+
+type List[T any] []T
+
+type Reader interface {
+	io.Closer
+	// Read reads.
+	Read(p []byte) (n int, err error)
+	skip()
+}
+
+// T is a struct.
+type T struct {
+	io.Reader
+	*Kind
+	*List[io.Reader]
+	// X is a field.
+	X, Y int ` + "`json:\"x\"`" + `
+	hidden string
+}
+
+// New makes a T.
+func New() *T { return nil }
+
+func Map[T, U any](list []T, f func(T) U) []U { return nil }
+
+func (t *T) Get(index int, values ...string) string { return "" }
+
+func (k Kind) String() string { return "" }
+
+func (l List[T]) Len() int { return len(l) }
+
+func (t *T) unexported() {}
+
+func helper() {}
+`
+
+const apiOtherSource = `package p
+
+// Z comes from another file.
+func Z() {}
+`
+
+func writeAPIPackage(t *testing.T) string {
+	dir := t.TempDir()
+	for name, src := range map[string]string{"p.go": apiSource, "z.go": apiOtherSource} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestCollectAPI(t *testing.T) {
+	pkg, err := LoadPackage(writeAPIPackage(t), Options{WithPositions: true, WithComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := CollectAPI(pkg)
+	if api.Package != "p" || api.Doc != "Package p is documented.\n" {
+		t.Errorf("unexpected package %q, doc %q", api.Package, api.Doc)
+	}
+
+	expectedConstants := []*APIValue{
+		{Name: "A", Type: "Kind", Value: "iota", Constant: "0"},
+		{Name: "B", Type: "Kind", Value: "iota", Constant: "1"},
+		{Name: "Pi", Value: "3.14", Constant: "157/50"},
+	}
+	if !reflect.DeepEqual(api.Constants, expectedConstants) {
+		t.Errorf("unexpected constants %s", mustMarshal(t, api.Constants))
+	}
+	expectedVariables := []*APIValue{{Name: "Default", Value: "New()", Doc: "Default is the default.\n"}}
+	if !reflect.DeepEqual(api.Variables, expectedVariables) {
+		t.Errorf("unexpected variables %s", mustMarshal(t, api.Variables))
+	}
+
+	var names []string
+	for _, function := range api.Functions {
+		names = append(names, function.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Map", "New", "Z"}) {
+		t.Errorf("unexpected functions %v", names)
+	}
+	mapFunc := api.Functions[0]
+	if mapFunc.TypeParams != "[T, U any]" || mapFunc.Signature != "func(list []T, f func(T) U) []U" ||
+		!reflect.DeepEqual(mapFunc.Params, []string{"[]T", "func(T) U"}) ||
+		!reflect.DeepEqual(mapFunc.Results, []string{"[]U"}) {
+		t.Errorf("unexpected function %s", mustMarshal(t, mapFunc))
+	}
+
+	types := make(map[string]*APIType)
+	names = nil
+	for _, apiType := range api.Types {
+		types[apiType.Name] = apiType
+		names = append(names, apiType.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"Alias", "Kind", "List", "Reader", "T"}) {
+		t.Errorf("unexpected types %v", names)
+	}
+	if alias := types["Alias"]; !alias.Alias || alias.Kind != "defined" || alias.Type != "Kind" {
+		t.Errorf("unexpected alias %s", mustMarshal(t, alias))
+	}
+	if list := types["List"]; list.Kind != "slice" || list.TypeParams != "[T any]" || list.Type != "[]T" ||
+		len(list.Methods) != 1 || list.Methods[0].Recv != "List" {
+		t.Errorf("unexpected list %s", mustMarshal(t, list))
+	}
+
+	reader := types["Reader"]
+	expectedReader := &APIType{
+		Name:       "Reader",
+		Kind:       "interface",
+		Unexported: true,
+		Fields: []*APIField{
+			{Name: "io.Closer", Type: "io.Closer", Embedded: true},
+		},
+		Methods: []*APIFunc{{
+			Name:      "Read",
+			Params:    []string{"[]byte"},
+			Results:   []string{"int", "error"},
+			Signature: "func(p []byte) (n int, err error)",
+			Doc:       "Read reads.\n",
+		}},
+	}
+	if !reflect.DeepEqual(reader, expectedReader) {
+		t.Errorf("unexpected interface %s", mustMarshal(t, reader))
+	}
+
+	structType := types["T"]
+	expectedFields := []*APIField{
+		{Name: "Reader", Type: "io.Reader", Embedded: true},
+		{Name: "Kind", Type: "*Kind", Embedded: true},
+		{Name: "List", Type: "*List[io.Reader]", Embedded: true},
+		{Name: "X", Type: "int", Tag: "`json:\"x\"`", Doc: "X is a field.\n"},
+		{Name: "Y", Type: "int", Tag: "`json:\"x\"`", Doc: "X is a field.\n"},
+	}
+	if structType.Kind != "struct" || !structType.Comparable || structType.Doc != "T is a struct.\n" ||
+		!reflect.DeepEqual(structType.Fields, expectedFields) {
+		t.Errorf("unexpected struct %s", mustMarshal(t, structType))
+	}
+	// Methods of embedded types of the package are promoted.
+	if len(structType.Methods) != 3 || structType.Methods[0].Recv != "*T" ||
+		!reflect.DeepEqual(structType.Methods[0].Params, []string{"int", "...string"}) ||
+		structType.Methods[1].Name != "Len" || structType.Methods[1].Recv != "T" ||
+		structType.Methods[1].Promoted != "List" ||
+		structType.Methods[2].Name != "String" || structType.Methods[2].Promoted != "Kind" {
+		t.Errorf("unexpected methods %s", mustMarshal(t, structType.Methods))
+	}
+}
+
+const apiValuesSource = `package p
+
+import "time"
+
+type Size uint8
+
+const (
+	A float64 = 1
+	B         = A / 2
+	C         = float64(1) / 3
+	D         = 7 / 2
+	E         = ^Size(0)
+	F int     = 4.0 / 2
+	G         = 1 << 2.0
+	H         = len("abc")
+	I         = time.Second * 2
+	J         = "a" + 1
+)
+
+var (
+	K = 1
+	L = -1.5
+	M = []string{"x"}
+	N = &time.Timer{}
+	O = int64(1)
+	P = time.Now()
+)
+`
+
+func TestCollectAPIValues(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(apiValuesSource), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := loadAPI(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Typed constants are converted to their types, the ones of unknown
+	// types or values are only given by their expressions.
+	var constants []string
+	for _, value := range api.Constants {
+		constants = append(constants, value.Name+" "+value.Constant)
+	}
+	expectedConstants := []string{"A 1", "B 1/2", "C 1/3", "D 3", "E 255", "F 2", "G 4", "H ", "I ", "J "}
+	if !reflect.DeepEqual(constants, expectedConstants) {
+		t.Errorf("unexpected constants %v", constants)
+	}
+	var variables []string
+	for _, value := range api.Variables {
+		variables = append(variables, value.Name+" "+value.Type+" "+value.Value)
+	}
+	expectedVariables := []string{
+		"K int ", "L float64 ", "M []string ", "N *time.Timer ", "O int64 ", "P  time.Now()",
+	}
+	if !reflect.DeepEqual(variables, expectedVariables) {
+		t.Errorf("unexpected variables %v", variables)
+	}
+}
+
+func TestAPIToJSON(t *testing.T) {
+	dir := writeAPIPackage(t)
+	var outputs [][]byte
+	for i := 0; i < 3; i++ {
+		output := filepath.Join(t.TempDir(), "api.json")
+		err := APIToJSON(dir, output, "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, data)
+	}
+	for _, data := range outputs[1:] {
+		if !bytes.Equal(data, outputs[0]) {
+			t.Fatalf("output is not deterministic\n%s\n%s", outputs[0], data)
+		}
+	}
+	api := &API{}
+	err := json.Unmarshal(outputs[0], api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(api.Types) != 5 || len(api.Functions) != 3 {
+		t.Errorf("unexpected api %s", outputs[0])
+	}
+
+	err = APIToJSON(filepath.Join(dir, "missing"), filepath.Join(t.TempDir(), "api.json"), "")
+	if err == nil {
+		t.Error("error expected for a missing directory")
+	}
+}
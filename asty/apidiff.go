@@ -0,0 +1,379 @@
+package asty
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// APIChange is a change of an exported object between two versions of a
+// package. Kind is package, const, var, type, func, method, field or embedded
+// for the embedded elements of interfaces. Change is added, removed or
+// changed. Old and New describe the object in each version.
+type APIChange struct {
+	Kind     string `json:"Kind"`
+	Name     string `json:"Name"`
+	Change   string `json:"Change"`
+	Old      string `json:"Old,omitempty"`
+	New      string `json:"New,omitempty"`
+	Breaking bool   `json:"Breaking"`
+}
+
+// APIDiff lists the changes between two versions of a package, breaking ones
+// first.
+type APIDiff struct {
+	Breaking bool         `json:"Breaking"`
+	Changes  []*APIChange `json:"Changes"`
+}
+
+type apiDiffer struct {
+	changes []*APIChange
+}
+
+// DiffAPI compares two versions of a package. Removed objects, changed types,
+// values and signatures are breaking, as are methods added to interfaces,
+// unexported methods added to interfaces without them, structs that are no
+// longer comparable and methods moved from value to pointer receivers. Added
+// objects, changed tags and methods moved from pointer to value receivers are
+// compatible. Variables of types that can not be inferred are compared by
+// their initializers.
+func DiffAPI(old, new *API) *APIDiff {
+	d := &apiDiffer{}
+	if old.Package != new.Package {
+		d.change("package", old.Package, "changed", old.Package, new.Package, true)
+	}
+	d.values("const", old.Constants, new.Constants)
+	d.values("var", old.Variables, new.Variables)
+	d.types(old.Types, new.Types)
+	d.funcs("func", "", old.Functions, new.Functions, false)
+
+	sort.SliceStable(d.changes, func(i, j int) bool {
+		return d.changes[i].Breaking && !d.changes[j].Breaking
+	})
+	diff := &APIDiff{Changes: d.changes}
+	if diff.Changes == nil {
+		diff.Changes = make([]*APIChange, 0)
+	}
+	for _, change := range diff.Changes {
+		diff.Breaking = diff.Breaking || change.Breaking
+	}
+	return diff
+}
+
+func (d *apiDiffer) change(kind, name, change, old, new string, breaking bool) {
+	d.changes = append(d.changes, &APIChange{
+		Kind:     kind,
+		Name:     name,
+		Change:   change,
+		Old:      old,
+		New:      new,
+		Breaking: breaking,
+	})
+}
+
+// apiNames returns the sorted union of the names of two lists.
+func apiNames(old, new []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, name := range append(append([]string(nil), old...), new...) {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func valueDescription(value *APIValue) string {
+	result := value.Type
+	if value.Value != "" {
+		if result != "" {
+			result += " "
+		}
+		result += "= " + value.Value
+	}
+	return result
+}
+
+func (d *apiDiffer) values(kind string, old, new []*APIValue) {
+	oldValues := make(map[string]*APIValue)
+	newValues := make(map[string]*APIValue)
+	var oldNames, newNames []string
+	for _, value := range old {
+		oldValues[value.Name] = value
+		oldNames = append(oldNames, value.Name)
+	}
+	for _, value := range new {
+		newValues[value.Name] = value
+		newNames = append(newNames, value.Name)
+	}
+	for _, name := range apiNames(oldNames, newNames) {
+		oldValue, newValue := oldValues[name], newValues[name]
+		switch {
+		case newValue == nil:
+			d.change(kind, name, "removed", valueDescription(oldValue), "", true)
+		case oldValue == nil:
+			d.change(kind, name, "added", "", valueDescription(newValue), false)
+		case oldValue.Type != newValue.Type || !sameValue(oldValue, newValue):
+			d.change(kind, name, "changed", valueDescription(oldValue), valueDescription(newValue), true)
+		}
+	}
+}
+
+// sameValue compares constants by their values, or by their expressions if
+// they could not be evaluated.
+func sameValue(old, new *APIValue) bool {
+	if old.Constant != "" && new.Constant != "" {
+		return old.Constant == new.Constant
+	}
+	return old.Value == new.Value
+}
+
+func typeDescription(apiType *APIType) string {
+	result := apiType.TypeParams
+	if result != "" {
+		result += " "
+	}
+	if apiType.Alias {
+		result += "= "
+	}
+	if apiType.Type != "" {
+		return result + apiType.Type
+	}
+	return result + apiType.Kind
+}
+
+func (d *apiDiffer) types(old, new []*APIType) {
+	oldTypes := make(map[string]*APIType)
+	newTypes := make(map[string]*APIType)
+	var oldNames, newNames []string
+	for _, apiType := range old {
+		oldTypes[apiType.Name] = apiType
+		oldNames = append(oldNames, apiType.Name)
+	}
+	for _, apiType := range new {
+		newTypes[apiType.Name] = apiType
+		newNames = append(newNames, apiType.Name)
+	}
+	for _, name := range apiNames(oldNames, newNames) {
+		oldType, newType := oldTypes[name], newTypes[name]
+		switch {
+		case newType == nil:
+			d.change("type", name, "removed", typeDescription(oldType), "", true)
+			continue
+		case oldType == nil:
+			d.change("type", name, "added", "", typeDescription(newType), false)
+			continue
+		}
+		oldDescription, newDescription := typeDescription(oldType), typeDescription(newType)
+		if oldDescription != newDescription {
+			d.change("type", name, "changed", oldDescription, newDescription, true)
+		}
+		if oldType.Kind != newType.Kind {
+			continue
+		}
+		// Structs may no longer be compared, interfaces no longer be
+		// implemented by other packages.
+		if oldType.Comparable != newType.Comparable {
+			d.change("type", name, "changed", structDescription(oldType), structDescription(newType), oldType.Comparable)
+		}
+		if oldType.Unexported != newType.Unexported {
+			d.change("type", name, "changed", interfaceDescription(oldType), interfaceDescription(newType),
+				newType.Unexported)
+		}
+		// Interfaces that can only be implemented by the package itself may
+		// get new methods.
+		implemented := oldType.Kind == "interface" && !oldType.Unexported
+		d.fields(name, oldType.Fields, newType.Fields, oldType.Kind == "interface", implemented)
+		d.funcs("method", name+".", oldType.Methods, newType.Methods, implemented)
+	}
+}
+
+func structDescription(apiType *APIType) string {
+	if apiType.Comparable {
+		return "comparable struct"
+	}
+	return "struct"
+}
+
+func interfaceDescription(apiType *APIType) string {
+	if apiType.Unexported {
+		return "interface with unexported methods"
+	}
+	return "interface"
+}
+
+func fieldDescription(field *APIField) string {
+	if field.Tag != "" {
+		return field.Type + " " + field.Tag
+	}
+	return field.Type
+}
+
+// fields compares the fields of structs, or the embedded elements of
+// interfaces, which add methods or restrict the type set of implemented ones.
+func (d *apiDiffer) fields(typeName string, old, new []*APIField, interfaceType, implemented bool) {
+	oldFields := make(map[string]*APIField)
+	newFields := make(map[string]*APIField)
+	var oldNames, newNames []string
+	for _, field := range old {
+		oldFields[field.Name] = field
+		oldNames = append(oldNames, field.Name)
+	}
+	for _, field := range new {
+		newFields[field.Name] = field
+		newNames = append(newNames, field.Name)
+	}
+	kind := "field"
+	if interfaceType {
+		kind = "embedded"
+	}
+	for _, name := range apiNames(oldNames, newNames) {
+		oldField, newField := oldFields[name], newFields[name]
+		qualified := typeName + "." + name
+		switch {
+		case newField == nil:
+			d.change(kind, qualified, "removed", fieldDescription(oldField), "", true)
+		case oldField == nil:
+			d.change(kind, qualified, "added", "", fieldDescription(newField), implemented)
+		case oldField.Type != newField.Type || oldField.Embedded != newField.Embedded:
+			d.change(kind, qualified, "changed", fieldDescription(oldField), fieldDescription(newField), true)
+		case oldField.Tag != newField.Tag:
+			d.change(kind, qualified, "changed", fieldDescription(oldField), fieldDescription(newField), false)
+		}
+	}
+}
+
+func funcDescription(function *APIFunc) string {
+	result := function.Signature
+	if function.TypeParams != "" {
+		result = "func" + function.TypeParams + strings.TrimPrefix(result, "func")
+	}
+	if function.Recv != "" {
+		result = "(" + function.Recv + ") " + result
+	}
+	return result
+}
+
+func sameSignature(old, new *APIFunc) bool {
+	return old.TypeParams == new.TypeParams &&
+		strings.Join(old.Params, ", ") == strings.Join(new.Params, ", ") &&
+		strings.Join(old.Results, ", ") == strings.Join(new.Results, ", ")
+}
+
+// funcs compares functions, methods declared on a type or the methods of an
+// interface, to which nothing can be added without breaking implementations
+// when it is implemented by other packages.
+func (d *apiDiffer) funcs(kind, prefix string, old, new []*APIFunc, implemented bool) {
+	oldFuncs := make(map[string]*APIFunc)
+	newFuncs := make(map[string]*APIFunc)
+	var oldNames, newNames []string
+	for _, function := range old {
+		oldFuncs[function.Name] = function
+		oldNames = append(oldNames, function.Name)
+	}
+	for _, function := range new {
+		newFuncs[function.Name] = function
+		newNames = append(newNames, function.Name)
+	}
+	for _, name := range apiNames(oldNames, newNames) {
+		oldFunc, newFunc := oldFuncs[name], newFuncs[name]
+		switch {
+		case newFunc == nil:
+			d.change(kind, prefix+name, "removed", funcDescription(oldFunc), "", true)
+		case oldFunc == nil:
+			d.change(kind, prefix+name, "added", "", funcDescription(newFunc), implemented)
+		case !sameSignature(oldFunc, newFunc):
+			d.change(kind, prefix+name, "changed", funcDescription(oldFunc), funcDescription(newFunc), true)
+		case oldFunc.Recv != newFunc.Recv:
+			// Methods of T are also methods of *T, but not the other way around.
+			breaking := !strings.HasPrefix(oldFunc.Recv, "*")
+			d.change(kind, prefix+name, "changed", funcDescription(oldFunc), funcDescription(newFunc), breaking)
+		}
+	}
+}
+
+func diffDirs(oldDir, newDir string) (*APIDiff, error) {
+	oldAPI, err := loadAPI(oldDir)
+	if err != nil {
+		return nil, err
+	}
+	newAPI, err := loadAPI(newDir)
+	if err != nil {
+		return nil, err
+	}
+	return DiffAPI(oldAPI, newAPI), nil
+}
+
+// APIDiffToJSON writes the changes of the API of the package in oldDir found
+// in newDir and reports whether any of them is breaking.
+func APIDiffToJSON(oldDir, newDir, output string, indent string) (bool, error) {
+	diff, err := diffDirs(oldDir, newDir)
+	if err != nil {
+		return false, err
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return false, err
+	}
+	defer closeOut()
+
+	encoder := json.NewEncoder(outFile)
+	encoder.SetIndent("", indent)
+	return diff.Breaking, encoder.Encode(diff)
+}
+
+// APIDiffToText is APIDiffToJSON writing a report for humans.
+func APIDiffToText(oldDir, newDir, output string) (bool, error) {
+	diff, err := diffDirs(oldDir, newDir)
+	if err != nil {
+		return false, err
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return false, err
+	}
+	defer closeOut()
+
+	return diff.Breaking, writeAPIDiffReport(outFile, diff)
+}
+
+func writeAPIDiffReport(w io.Writer, diff *APIDiff) error {
+	if len(diff.Changes) == 0 {
+		_, err := fmt.Fprintln(w, "No API changes.")
+		return err
+	}
+	var title string
+	for _, change := range diff.Changes {
+		changeTitle := "Compatible changes:"
+		if change.Breaking {
+			changeTitle = "Breaking changes:"
+		}
+		if changeTitle != title {
+			title = changeTitle
+			_, err := fmt.Fprintln(w, title)
+			if err != nil {
+				return err
+			}
+		}
+		var line string
+		switch change.Change {
+		case "added":
+			line = fmt.Sprintf("  %s %s: added %s", change.Kind, change.Name, change.New)
+		case "removed":
+			line = fmt.Sprintf("  %s %s: removed %s", change.Kind, change.Name, change.Old)
+		default:
+			line = fmt.Sprintf("  %s %s: changed from %s to %s", change.Kind, change.Name, change.Old, change.New)
+		}
+		_, err := fmt.Fprintln(w, strings.TrimRight(line, " "))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const apiDiffOldSource = `package p
+
+const A = 1
+
+const B = 2
+
+var V int
+
+type I interface {
+	M()
+}
+
+type C interface {
+	~int
+}
+
+type S struct {
+	X int
+	Y string ` + "`json:\"y\"`" + `
+}
+
+func (s *S) P() {}
+
+func (s S) V() {}
+
+func F(a int) error { return nil }
+
+func G() {}
+`
+
+const apiDiffNewSource = `package p
+
+const A = 1
+
+const B = 3
+
+var V int64
+
+type I interface {
+	M()
+	N()
+}
+
+type C interface {
+	~int
+	fmt.Stringer
+}
+
+type S struct {
+	X int64
+	Y string ` + "`json:\"yy\"`" + `
+	Z bool
+}
+
+func (s S) P() {}
+
+func (s *S) V() {}
+
+func F(a, b int) error { return nil }
+
+func H() {}
+`
+
+func writeAPIDiffPackages(t *testing.T) (string, string) {
+	oldDir, newDir := t.TempDir(), t.TempDir()
+	for dir, src := range map[string]string{oldDir: apiDiffOldSource, newDir: apiDiffNewSource} {
+		err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return oldDir, newDir
+}
+
+func TestDiffAPI(t *testing.T) {
+	oldDir, newDir := writeAPIDiffPackages(t)
+	oldAPI, err := loadAPI(oldDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAPI, err := loadAPI(newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := DiffAPI(oldAPI, newAPI)
+	var actual []string
+	for _, change := range diff.Changes {
+		breaking := "compatible"
+		if change.Breaking {
+			breaking = "breaking"
+		}
+		actual = append(actual, strings.Join([]string{breaking, change.Kind, change.Name, change.Change}, " "))
+	}
+	expected := []string{
+		"breaking const B changed",
+		"breaking var V changed",
+		"breaking embedded C.fmt.Stringer added",
+		"breaking method I.N added",
+		"breaking field S.X changed",
+		"breaking method S.V changed",
+		"breaking func F changed",
+		"breaking func G removed",
+		"compatible field S.Y changed",
+		"compatible field S.Z added",
+		"compatible method S.P changed",
+		"compatible func H added",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected changes\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+	if !diff.Breaking {
+		t.Error("breaking diff expected")
+	}
+	change := diff.Changes[6]
+	if change.Old != "func(a int) error" || change.New != "func(a, b int) error" {
+		t.Errorf("unexpected signatures %+v", change)
+	}
+
+	same := DiffAPI(oldAPI, oldAPI)
+	if same.Breaking || len(same.Changes) != 0 {
+		t.Errorf("no changes expected, got %s", mustMarshal(t, same))
+	}
+	compatible := DiffAPI(oldAPI, &API{
+		Package:   oldAPI.Package,
+		Constants: oldAPI.Constants,
+		Variables: oldAPI.Variables,
+		Types:     oldAPI.Types,
+		Functions: append(append([]*APIFunc(nil), oldAPI.Functions...), &APIFunc{Name: "Z", Signature: "func()"}),
+	})
+	if compatible.Breaking || len(compatible.Changes) != 1 {
+		t.Errorf("one compatible change expected, got %s", mustMarshal(t, compatible))
+	}
+}
+
+const apiDiffNormalizedOldSource = `package p
+
+const C = 1 << 2
+
+const D = "a" + "b"
+
+const (
+	E = iota * 10
+	F
+)
+
+const (
+	G    float64 = 1
+	Half         = G / 2
+)
+
+var V = 1
+
+type Outer struct {
+	Inner struct{ X int; Y int }
+	F     func(a int, b int) error
+}
+
+type H func(x, y int)
+
+type Sealed interface {
+	M()
+	m()
+}
+
+type Open interface {
+	M()
+}
+
+type Plain struct {
+	X int
+}
+
+type Loose struct {
+	X int
+	F []int
+}
+
+type Base struct{}
+
+type Derived struct {
+	Base
+}
+
+func (Derived) N() {}
+
+func (*Derived) P() {}
+`
+
+const apiDiffNormalizedNewSource = `package p
+
+const C = 4
+
+const D = "ab"
+
+const (
+	E = 0
+	F = E + 10
+)
+
+const (
+	G    float64 = 1
+	Half         = 0.0
+)
+
+var V = "x"
+
+type Outer struct {
+	Inner struct {
+		X, Y int
+	}
+	F func(int, int) error
+}
+
+type H func(a int, b int)
+
+type Sealed interface {
+	M()
+	N()
+	m()
+}
+
+type Open interface {
+	M()
+	m()
+}
+
+type Plain struct {
+	X int
+	f func()
+}
+
+type Loose struct {
+	X int
+	F []int
+	g map[int]int
+}
+
+type Base struct{}
+
+type Derived struct {
+	Base
+}
+
+func (Base) N() {}
+
+func (*Base) P() {}
+`
+
+func TestDiffAPINormalized(t *testing.T) {
+	var apis []*API
+	for _, src := range []string{apiDiffNormalizedOldSource, apiDiffNormalizedNewSource} {
+		dir := t.TempDir()
+		err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		api, err := loadAPI(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		apis = append(apis, api)
+	}
+
+	// Regrouped fields, renamed parameters, constants of the same value and
+	// methods moved to embedded types are not changes, while typed constants
+	// and variables of other values or types, structs that may no longer be
+	// compared and interfaces that may no longer be implemented are breaking.
+	diff := DiffAPI(apis[0], apis[1])
+	var actual []string
+	for _, change := range diff.Changes {
+		actual = append(actual, strings.Join([]string{change.Kind, change.Name, change.Old, change.New}, " | "))
+	}
+	expected := []string{
+		"const | Half | = G / 2 | = 0.0",
+		"var | V | int | string",
+		"type | Open | interface | interface with unexported methods",
+		"type | Plain | comparable struct | struct",
+		"method | Base.N |  | (Base) func()",
+		"method | Base.P |  | (*Base) func()",
+		"method | Sealed.N |  | func()",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected changes\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+	if !diff.Breaking || !diff.Changes[3].Breaking || diff.Changes[4].Breaking {
+		t.Errorf("unexpected diff %s", mustMarshal(t, diff))
+	}
+}
+
+func TestAPIDiffToJSON(t *testing.T) {
+	oldDir, newDir := writeAPIDiffPackages(t)
+	output := filepath.Join(t.TempDir(), "apidiff.json")
+	breaking, err := APIDiffToJSON(oldDir, newDir, output, "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !breaking {
+		t.Error("breaking changes expected")
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := &APIDiff{}
+	err = json.Unmarshal(data, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !diff.Breaking || len(diff.Changes) != 12 {
+		t.Errorf("unexpected diff %s", data)
+	}
+
+	breaking, err = APIDiffToJSON(oldDir, oldDir, output, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if breaking {
+		t.Error("no breaking changes expected")
+	}
+	_, err = APIDiffToJSON(oldDir, filepath.Join(newDir, "missing"), output, "")
+	if err == nil {
+		t.Error("error expected for a missing directory")
+	}
+}
+
+func TestAPIDiffToText(t *testing.T) {
+	oldDir, newDir := writeAPIDiffPackages(t)
+	output := filepath.Join(t.TempDir(), "apidiff.txt")
+	breaking, err := APIDiffToText(oldDir, newDir, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !breaking {
+		t.Error("breaking changes expected")
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"Breaking changes:\n  const B: changed from = 2 to = 3\n",
+		"  func G: removed func()\nCompatible changes:\n",
+		"  method S.P: changed from (*S) func() to (S) func()\n",
+		"  func H: added func()\n",
+	} {
+		if !bytes.Contains(data, []byte(line)) {
+			t.Errorf("expected %q in report\n%s", line, data)
+		}
+	}
+
+	_, err = APIDiffToText(oldDir, oldDir, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "No API changes.\n" {
+		t.Errorf("unexpected report %q", data)
+	}
+}
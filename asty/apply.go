@@ -0,0 +1,437 @@
+package asty
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// An ApplyFunc is invoked by Apply for each node n, even if n is nil,
+// before and/or after the node's children, using a Cursor describing
+// the current node and providing operations on it.
+//
+// The return value of ApplyFunc controls the syntax tree traversal.
+// See Apply for details.
+type ApplyFunc func(*Cursor) bool
+
+// Apply traverses a node tree recursively, starting with root, and calling
+// pre and post for each node as described below. Apply returns the node tree,
+// possibly modified. It mirrors astutil.Apply from golang.org/x/tools.
+//
+// If pre is not nil, it is called for each node before the node's children
+// are traversed (pre-order). If pre returns false, no children are traversed,
+// and post is not called for that node.
+//
+// If post is not nil, and a prior call of pre didn't return false, post is
+// called for each node after its children are traversed (post-order). If post
+// returns false, traversal is terminated and Apply returns immediately.
+//
+// Only fields that refer to INode nodes are traversed; positions are not.
+// Children are traversed in the order in which they appear in the respective
+// node's struct definition. A replacement node installed by Cursor.Replace is
+// not walked by Apply.
+func Apply(root INode, pre, post ApplyFunc) (result INode) {
+	defer func() {
+		if r := recover(); r != nil && r != errAbortApply {
+			panic(r)
+		}
+		result = root
+	}()
+
+	a := &application{pre: pre, post: post}
+	applyField(a, nil, "", &root)
+	return root
+}
+
+var errAbortApply = new(int)
+
+// A Cursor describes a node encountered during Apply. Information about the
+// node and its parent is available from the Node, Parent, Name, and Index
+// methods.
+type Cursor struct {
+	parent INode
+	name   string
+	iter   *iterator
+	node   INode
+	editor nodeEditor
+}
+
+// Node returns the current node.
+func (c *Cursor) Node() INode {
+	return c.node
+}
+
+// Parent returns the parent of the current node, or nil for the root.
+func (c *Cursor) Parent() INode {
+	return c.parent
+}
+
+// Name returns the name of the parent node field that contains the current
+// node.
+func (c *Cursor) Name() string {
+	return c.name
+}
+
+// Index reports the index >= 0 of the current node in the slice of nodes that
+// contains it, or a value < 0 if the current node is not part of a slice.
+func (c *Cursor) Index() int {
+	if c.iter != nil {
+		return c.iter.index
+	}
+	return -1
+}
+
+// Replace replaces the current node with n. The replacement node is not walked
+// by Apply. It panics if n cannot be stored in the parent field.
+func (c *Cursor) Replace(n INode) {
+	c.editor.replace(c.Index(), n)
+	c.node = n
+}
+
+// Delete deletes the current node from its containing slice. If the current
+// node is not part of a slice, Delete panics.
+func (c *Cursor) Delete() {
+	i := c.Index()
+	if i < 0 {
+		panic("Delete node not contained in slice")
+	}
+	c.editor.delete(i)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current node in its containing slice. If the
+// current node is not part of a slice, InsertAfter panics. Apply does not walk
+// n.
+func (c *Cursor) InsertAfter(n INode) {
+	i := c.Index()
+	if i < 0 {
+		panic("InsertAfter node not contained in slice")
+	}
+	c.editor.insert(i+1, n)
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current node in its containing slice. If
+// the current node is not part of a slice, InsertBefore panics. Apply will not
+// walk n.
+func (c *Cursor) InsertBefore(n INode) {
+	i := c.Index()
+	if i < 0 {
+		panic("InsertBefore node not contained in slice")
+	}
+	c.editor.insert(i, n)
+	c.iter.index++
+}
+
+// ---------------------------------------------------------------------------
+
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+	iter      iterator
+}
+
+type iterator struct {
+	index, step int
+}
+
+type nodeEditor interface {
+	replace(index int, n INode)
+	delete(index int)
+	insert(index int, n INode)
+}
+
+type fieldEditor[T INode] struct {
+	field *T
+}
+
+func (e fieldEditor[T]) replace(_ int, n INode) {
+	*e.field = castNode[T](n)
+}
+
+func (e fieldEditor[T]) delete(int) {
+	panic("unreachable")
+}
+
+func (e fieldEditor[T]) insert(int, INode) {
+	panic("unreachable")
+}
+
+type listEditor[T INode] struct {
+	list *[]T
+}
+
+func (e listEditor[T]) replace(index int, n INode) {
+	(*e.list)[index] = castNode[T](n)
+}
+
+func (e listEditor[T]) delete(index int) {
+	list := *e.list
+	copy(list[index:], list[index+1:])
+	var zero T
+	list[len(list)-1] = zero
+	*e.list = list[:len(list)-1]
+}
+
+func (e listEditor[T]) insert(index int, n INode) {
+	var zero T
+	list := append(*e.list, zero)
+	copy(list[index+1:], list[index:])
+	list[index] = castNode[T](n)
+	*e.list = list
+}
+
+func castNode[T INode](n INode) T {
+	var result T
+	if n == nil {
+		return result
+	}
+	result, ok := n.(T)
+	if !ok {
+		panic(fmt.Sprintf("asty: cannot use %T as %s", n, reflect.TypeOf(&result).Elem()))
+	}
+	return result
+}
+
+func (a *application) apply(parent INode, name string, iter *iterator, n INode, editor nodeEditor) {
+	saved := a.cursor
+	a.cursor = Cursor{parent: parent, name: name, iter: iter, node: n, editor: editor}
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		a.cursor = saved
+		return
+	}
+
+	if n != nil {
+		applyChildren(a, n)
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(errAbortApply)
+	}
+
+	a.cursor = saved
+}
+
+func applyField[T INode](a *application, parent INode, name string, field *T) {
+	a.apply(parent, name, nil, *field, fieldEditor[T]{field: field})
+}
+
+func applyNode[T any, P interface {
+	*T
+	INode
+}](a *application, parent INode, name string, field *P) {
+	var node INode
+	if *field != nil {
+		node = *field
+	}
+	a.apply(parent, name, nil, node, fieldEditor[P]{field: field})
+}
+
+func applyList[T INode](a *application, parent INode, name string, list *[]T) {
+	saved := a.iter
+	a.iter.index = 0
+	for a.iter.index < len(*list) {
+		a.iter.step = 1
+		a.apply(parent, name, &a.iter, (*list)[a.iter.index], listEditor[T]{list: list})
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
+
+func applyNodeList[T any, P interface {
+	*T
+	INode
+}](a *application, parent INode, name string, list *[]P) {
+	saved := a.iter
+	a.iter.index = 0
+	for a.iter.index < len(*list) {
+		a.iter.step = 1
+		var node INode
+		if item := (*list)[a.iter.index]; item != nil {
+			node = item
+		}
+		a.apply(parent, name, &a.iter, node, listEditor[P]{list: list})
+		a.iter.index += a.iter.step
+	}
+	a.iter = saved
+}
+
+func applyFiles(a *application, parent INode, name string, files map[string]*FileNode) {
+	for _, filename := range sortedFileNames(files) {
+		file := files[filename]
+		applyNode(a, parent, name, &file)
+		if file == nil {
+			delete(files, filename)
+		} else {
+			files[filename] = file
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func applyChildren(a *application, node INode) {
+	switch n := node.(type) {
+	case *CommentNode, *BadExprNode, *IdentNode, *BasicLitNode,
+		*BadStmtNode, *EmptyStmtNode, *BadDeclNode:
+	case *CommentGroupNode:
+		applyNodeList(a, n, "List", &n.List)
+	case *FieldNode:
+		applyNode(a, n, "Doc", &n.Doc)
+		applyNodeList(a, n, "Names", &n.Names)
+		applyField(a, n, "Type", &n.Type)
+		applyNode(a, n, "Tag", &n.Tag)
+		applyNode(a, n, "Comment", &n.Comment)
+	case *FieldListNode:
+		applyNodeList(a, n, "List", &n.List)
+	case *EllipsisNode:
+		applyField(a, n, "Elt", &n.Elt)
+	case *FuncLitNode:
+		applyNode(a, n, "Type", &n.Type)
+		applyNode(a, n, "Body", &n.Body)
+	case *CompositeLitNode:
+		applyField(a, n, "Type", &n.Type)
+		applyList(a, n, "Elts", &n.Elts)
+	case *ParenExprNode:
+		applyField(a, n, "X", &n.X)
+	case *SelectorExprNode:
+		applyField(a, n, "X", &n.X)
+		applyNode(a, n, "Sel", &n.Sel)
+	case *IndexExprNode:
+		applyField(a, n, "X", &n.X)
+		applyField(a, n, "Index", &n.Index)
+	case *IndexListExprNode:
+		applyField(a, n, "X", &n.X)
+		applyList(a, n, "Indices", &n.Indices)
+	case *SliceExprNode:
+		applyField(a, n, "X", &n.X)
+		applyField(a, n, "Low", &n.Low)
+		applyField(a, n, "High", &n.High)
+		applyField(a, n, "Max", &n.Max)
+	case *TypeAssertExprNode:
+		applyField(a, n, "X", &n.X)
+		applyField(a, n, "Type", &n.Type)
+	case *CallExprNode:
+		applyField(a, n, "Fun", &n.Fun)
+		applyList(a, n, "Args", &n.Args)
+	case *StarExprNode:
+		applyField(a, n, "X", &n.X)
+	case *UnaryExprNode:
+		applyField(a, n, "X", &n.X)
+	case *BinaryExprNode:
+		applyField(a, n, "X", &n.X)
+		applyField(a, n, "Y", &n.Y)
+	case *KeyValueExprNode:
+		applyField(a, n, "Key", &n.Key)
+		applyField(a, n, "Value", &n.Value)
+	case *ArrayTypeNode:
+		applyField(a, n, "Len", &n.Len)
+		applyField(a, n, "Elt", &n.Elt)
+	case *StructTypeNode:
+		applyNode(a, n, "Fields", &n.Fields)
+	case *FuncTypeNode:
+		applyNode(a, n, "TypeParams", &n.TypeParams)
+		applyNode(a, n, "Params", &n.Params)
+		applyNode(a, n, "Results", &n.Results)
+	case *InterfaceTypeNode:
+		applyNode(a, n, "Methods", &n.Methods)
+	case *MapTypeNode:
+		applyField(a, n, "Key", &n.Key)
+		applyField(a, n, "Value", &n.Value)
+	case *ChanTypeNode:
+		applyField(a, n, "Value", &n.Value)
+	case *DeclStmtNode:
+		applyField(a, n, "Decl", &n.Decl)
+	case *LabeledStmtNode:
+		applyNode(a, n, "Label", &n.Label)
+		applyField(a, n, "Stmt", &n.Stmt)
+	case *ExprStmtNode:
+		applyField(a, n, "X", &n.X)
+	case *SendStmtNode:
+		applyField(a, n, "Chan", &n.Chan)
+		applyField(a, n, "Value", &n.Value)
+	case *IncDecStmtNode:
+		applyField(a, n, "X", &n.X)
+	case *AssignStmtNode:
+		applyList(a, n, "Lhs", &n.Lhs)
+		applyList(a, n, "Rhs", &n.Rhs)
+	case *GoStmtNode:
+		applyNode(a, n, "Call", &n.Call)
+	case *DeferStmtNode:
+		applyNode(a, n, "Call", &n.Call)
+	case *ReturnStmtNode:
+		applyList(a, n, "Results", &n.Results)
+	case *BranchStmtNode:
+		applyNode(a, n, "Label", &n.Label)
+	case *BlockStmtNode:
+		applyList(a, n, "List", &n.List)
+	case *IfStmtNode:
+		applyField(a, n, "Init", &n.Init)
+		applyField(a, n, "Cond", &n.Cond)
+		applyNode(a, n, "Body", &n.Body)
+		applyField(a, n, "Else", &n.Else)
+	case *CaseClauseNode:
+		applyList(a, n, "List", &n.List)
+		applyList(a, n, "Body", &n.Body)
+	case *SwitchStmtNode:
+		applyField(a, n, "Init", &n.Init)
+		applyField(a, n, "Tag", &n.Tag)
+		applyNode(a, n, "Body", &n.Body)
+	case *TypeSwitchStmtNode:
+		applyField(a, n, "Init", &n.Init)
+		applyField(a, n, "Assign", &n.Assign)
+		applyNode(a, n, "Body", &n.Body)
+	case *CommClauseNode:
+		applyField(a, n, "Comm", &n.Comm)
+		applyList(a, n, "Body", &n.Body)
+	case *SelectStmtNode:
+		applyNode(a, n, "Body", &n.Body)
+	case *ForStmtNode:
+		applyField(a, n, "Init", &n.Init)
+		applyField(a, n, "Cond", &n.Cond)
+		applyField(a, n, "Post", &n.Post)
+		applyNode(a, n, "Body", &n.Body)
+	case *RangeStmtNode:
+		applyField(a, n, "Key", &n.Key)
+		applyField(a, n, "Value", &n.Value)
+		applyField(a, n, "X", &n.X)
+		applyNode(a, n, "Body", &n.Body)
+	case *ImportSpecNode:
+		applyNode(a, n, "Doc", &n.Doc)
+		applyNode(a, n, "Name", &n.Name)
+		applyNode(a, n, "Path", &n.Path)
+		applyNode(a, n, "Comment", &n.Comment)
+	case *ValueSpecNode:
+		applyNode(a, n, "Doc", &n.Doc)
+		applyNodeList(a, n, "Names", &n.Names)
+		applyField(a, n, "Type", &n.Type)
+		applyList(a, n, "Values", &n.Values)
+		applyNode(a, n, "Comment", &n.Comment)
+	case *TypeSpecNode:
+		applyNode(a, n, "Doc", &n.Doc)
+		applyNode(a, n, "Name", &n.Name)
+		applyNode(a, n, "TypeParams", &n.TypeParams)
+		applyField(a, n, "Type", &n.Type)
+		applyNode(a, n, "Comment", &n.Comment)
+	case *GenDeclNode:
+		applyNode(a, n, "Doc", &n.Doc)
+		applyList(a, n, "Specs", &n.Specs)
+	case *FuncDeclNode:
+		applyNode(a, n, "Doc", &n.Doc)
+		applyNode(a, n, "Recv", &n.Recv)
+		applyNode(a, n, "Name", &n.Name)
+		applyNode(a, n, "Type", &n.Type)
+		applyNode(a, n, "Body", &n.Body)
+	case *FileNode:
+		applyNode(a, n, "Doc", &n.Doc)
+		applyNode(a, n, "Name", &n.Name)
+		applyList(a, n, "Decls", &n.Decls)
+		applyNodeList(a, n, "Imports", &n.Imports)
+		applyNodeList(a, n, "Unresolved", &n.Unresolved)
+		applyNodeList(a, n, "Comments", &n.Comments)
+	case *PackageNode:
+		applyFiles(a, n, "Files", n.Files)
+	default:
+		panic("implement me " + reflect.TypeOf(node).String())
+	}
+}
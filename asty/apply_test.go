@@ -0,0 +1,167 @@
+package asty
+
+import (
+	"bytes"
+	"go/parser"
+	"go/printer"
+	"testing"
+)
+
+const applySource = `package p
+
+func f(x int) int {
+	println("a")
+	x++
+	println("b")
+	return x
+}
+`
+
+func marshalSourceForTest(t *testing.T, src string) *FileNode {
+	marshaller := NewMarshaller(Options{})
+	tree, err := parser.ParseFile(marshaller.FileSet(), "test.go", src, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return marshaller.MarshalFile(tree)
+}
+
+func printNodeForTest(t *testing.T, node *FileNode) string {
+	unmarshaller := NewUnmarshaller(Options{})
+	tree := unmarshaller.UnmarshalFileNode(node)
+	var buf bytes.Buffer
+	err := printer.Fprint(&buf, unmarshaller.FileSet(), tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func isPrintln(node INode) bool {
+	stmt, ok := node.(*ExprStmtNode)
+	if !ok {
+		return false
+	}
+	call, ok := stmt.X.(*CallExprNode)
+	if !ok {
+		return false
+	}
+	ident, ok := call.Fun.(*IdentNode)
+	return ok && ident.Name == "println"
+}
+
+func TestApplyReplace(t *testing.T) {
+	root := marshalSourceForTest(t, applySource)
+	result := Apply(root, func(c *Cursor) bool {
+		if ident, ok := c.Node().(*IdentNode); ok && ident.Name == "x" {
+			c.Replace(&IdentNode{Node: Node{NodeType: "Ident"}, Name: "y"})
+		}
+		return true
+	}, nil)
+
+	expected := `package p
+
+func f(y int) int {
+	println("a")
+	y++
+	println("b")
+	return y
+}
+`
+	if actual := printNodeForTest(t, result.(*FileNode)); actual != expected {
+		t.Errorf("unexpected result:\n%s", actual)
+	}
+}
+
+func TestApplyListEditing(t *testing.T) {
+	root := marshalSourceForTest(t, applySource)
+	Apply(root, nil, func(c *Cursor) bool {
+		if !isPrintln(c.Node()) {
+			return true
+		}
+		call := c.Node().(*ExprStmtNode).X.(*CallExprNode)
+		if call.Args[0].(*BasicLitNode).Value == `"a"` {
+			c.InsertBefore(&ExprStmtNode{Node: Node{NodeType: "ExprStmt"}, X: &IdentNode{Name: "before"}})
+			c.InsertAfter(&ExprStmtNode{Node: Node{NodeType: "ExprStmt"}, X: &IdentNode{Name: "after"}})
+		} else {
+			c.Delete()
+		}
+		return true
+	})
+
+	expected := `package p
+
+func f(x int) int {
+	before
+	println("a")
+	after
+	x++
+	return x
+}
+`
+	if actual := printNodeForTest(t, root); actual != expected {
+		t.Errorf("unexpected result:\n%s", actual)
+	}
+}
+
+func TestApplyCursor(t *testing.T) {
+	root := marshalSourceForTest(t, applySource)
+	visited := 0
+	Apply(root, func(c *Cursor) bool {
+		if c.Node() == nil {
+			return true
+		}
+		visited++
+		if c.Node() == root {
+			if c.Parent() != nil || c.Index() >= 0 {
+				t.Errorf("unexpected root cursor %+v", c)
+			}
+			return true
+		}
+		if c.Parent() == nil || c.Name() == "" {
+			t.Errorf("missing parent for %T", c.Node())
+		}
+		if _, ok := c.Node().(*BlockStmtNode); ok {
+			return false
+		}
+		return true
+	}, nil)
+	if visited == 0 {
+		t.Error("no nodes visited")
+	}
+}
+
+func TestApplyAbort(t *testing.T) {
+	root := marshalSourceForTest(t, applySource)
+	posts := 0
+	result := Apply(root, nil, func(c *Cursor) bool {
+		posts++
+		return !isPrintln(c.Node())
+	})
+	if result != root {
+		t.Error("root expected as result")
+	}
+	count := 0
+	Apply(root, nil, func(c *Cursor) bool {
+		count++
+		return true
+	})
+	if posts >= count {
+		t.Errorf("traversal was not terminated: %d of %d", posts, count)
+	}
+}
+
+func TestApplyInvalidReplace(t *testing.T) {
+	root := marshalSourceForTest(t, applySource)
+	defer func() {
+		if recover() == nil {
+			t.Error("panic expected")
+		}
+	}()
+	Apply(root, func(c *Cursor) bool {
+		if _, ok := c.Node().(*IdentNode); ok {
+			c.Replace(&BlockStmtNode{})
+		}
+		return true
+	}, nil)
+}
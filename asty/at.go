@@ -0,0 +1,268 @@
+package asty
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnclosingNode is an element of the result of asty at. Field and Index tell
+// how the node is reached from the next element, its parent. Only the
+// innermost node is marshalled as a whole in Node, the others are described
+// by their type and span.
+type EnclosingNode struct {
+	Field    string        `json:"Field,omitempty"`
+	Index    int           `json:"Index"`
+	NodeType string        `json:"NodeType"`
+	Pos      *PositionNode `json:"Pos,omitempty"`
+	End      *PositionNode `json:"End,omitempty"`
+	Node     INode         `json:"Node,omitempty"`
+}
+
+// pathEnclosing returns the path to the innermost node enclosing the interval
+// [start, end) along with the go/ast node it was marshalled from. An empty
+// interval selects the innermost node containing start.
+func pathEnclosing(file *FileNode, tree *ast.File, start, end token.Pos) ([]Step, ast.Node) {
+	var path []Step
+	var innermost ast.Node
+	inspectWithAST(file, tree, func(current []Step, node ast.Node) bool {
+		if start < node.Pos() || end > node.End() || start == end && start == node.End() {
+			return false
+		}
+		path = append(path[:0], current...)
+		innermost = node
+		return true
+	})
+	return path, innermost
+}
+
+// astStep is a step of a path of go/ast nodes, see Step.
+type astStep struct {
+	Node  ast.Node
+	Field string
+	Index int
+}
+
+// astPathEnclosing is pathEnclosing on the go/ast tree alone, so that the
+// file does not have to be marshalled. Comments are skipped unless they are
+// marshalled.
+func astPathEnclosing(tree *ast.File, start, end token.Pos, comments bool) []astStep {
+	var path, result []astStep
+	var visit func(step astStep)
+	visit = func(step astStep) {
+		node := step.Node
+		if start < node.Pos() || end > node.End() || start == end && start == node.End() {
+			return
+		}
+		path = append(path, step)
+		result = append(result[:0], path...)
+		for _, child := range astChildren(node) {
+			if _, ok := child.(*ast.CommentGroup); ok && !comments {
+				continue
+			}
+			field, index := astField(node, child)
+			visit(astStep{Node: child, Field: field, Index: index})
+		}
+		path = path[:len(path)-1]
+	}
+	visit(astStep{Node: tree, Index: -1})
+	return result
+}
+
+// astField returns the field of parent holding child and its index for list
+// fields or -1 otherwise. Node structs keep the field names of go/ast.
+func astField(parent, child ast.Node) (string, int) {
+	value := reflect.ValueOf(parent).Elem()
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Field(index)
+		name := value.Type().Field(index).Name
+		switch field.Kind() {
+		case reflect.Interface, reflect.Pointer:
+			if !field.IsNil() && field.Interface() == any(child) {
+				return name, -1
+			}
+		case reflect.Slice:
+			for i := 0; i < field.Len(); i++ {
+				elem := field.Index(i)
+				if (elem.Kind() == reflect.Interface || elem.Kind() == reflect.Pointer) &&
+					!elem.IsNil() && elem.Interface() == any(child) {
+					return name, i
+				}
+			}
+		}
+	}
+	return "", -1
+}
+
+// marshalAny marshals a node of any type found in a file.
+func marshalAny(m *Marshaller, node ast.Node) INode {
+	switch n := node.(type) {
+	case *ast.File:
+		return m.MarshalFile(n)
+	case *ast.Comment:
+		return m.MarshalComment(n)
+	case *ast.CommentGroup:
+		return m.MarshalCommentGroup(n)
+	case *ast.Field:
+		return m.MarshalField(n)
+	case *ast.FieldList:
+		return m.MarshalFieldList(n)
+	case ast.Expr:
+		return m.MarshalExpr(n)
+	case ast.Stmt:
+		return m.MarshalStmt(n)
+	case ast.Spec:
+		return m.MarshalSpec(n)
+	case ast.Decl:
+		return m.MarshalDecl(n)
+	}
+	panic("implement me " + reflect.TypeOf(node).String())
+}
+
+// PositionQuery selects a position or a range of a file. It is written as
+// "file.go:line:column", "file.go:#offset" or "file.go:#start,#end", where
+// lines and columns start at 1 and columns and offsets count bytes.
+type PositionQuery struct {
+	Filename string
+	Line     int
+	Column   int
+	Start    int
+	End      int
+}
+
+func ParsePositionQuery(query string) (*PositionQuery, error) {
+	invalid := fmt.Errorf("invalid position %q, expected file.go:line:column, file.go:#offset or file.go:#start,#end", query)
+
+	if index := strings.LastIndex(query, ":#"); index >= 0 {
+		result := &PositionQuery{Filename: query[:index]}
+		start, end, isRange := strings.Cut(query[index+2:], ",")
+		var err error
+		result.Start, err = strconv.Atoi(start)
+		if err != nil || result.Start < 0 {
+			return nil, invalid
+		}
+		result.End = result.Start
+		if isRange {
+			result.End, err = strconv.Atoi(strings.TrimPrefix(end, "#"))
+			if err != nil || result.End < result.Start {
+				return nil, invalid
+			}
+		}
+		return result, nil
+	}
+
+	parts := strings.Split(query, ":")
+	if len(parts) < 3 {
+		return nil, invalid
+	}
+	line, err := strconv.Atoi(parts[len(parts)-2])
+	if err != nil || line < 1 {
+		return nil, invalid
+	}
+	column, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil || column < 1 {
+		return nil, invalid
+	}
+	return &PositionQuery{
+		Filename: strings.Join(parts[:len(parts)-2], ":"),
+		Line:     line,
+		Column:   column,
+	}, nil
+}
+
+// interval converts the query into positions of file.
+func (q *PositionQuery) interval(file *token.File) (token.Pos, token.Pos, error) {
+	start, end := q.Start, q.End
+	if q.Line > 0 {
+		if q.Line > file.LineCount() {
+			return token.NoPos, token.NoPos, fmt.Errorf("line %d is out of range", q.Line)
+		}
+		// The column may select the newline ending the line, or the end of
+		// the file on the last line, but nothing past them.
+		lineEnd := file.Size()
+		if q.Line < file.LineCount() {
+			lineEnd = file.Offset(file.LineStart(q.Line+1)) - 1
+		}
+		start = file.Offset(file.LineStart(q.Line)) + q.Column - 1
+		if start > lineEnd {
+			return token.NoPos, token.NoPos, fmt.Errorf("column %d is out of range", q.Column)
+		}
+		end = start
+	}
+	if end > file.Size() {
+		return token.NoPos, token.NoPos, fmt.Errorf("offset %d is out of range", end)
+	}
+	return file.Pos(start), file.Pos(end), nil
+}
+
+// EnclosingNodes returns the chain of nodes enclosing the queried position or
+// range of a file, innermost first, the way astutil.PathEnclosingInterval does.
+// Positions of the table format, which refer to a table of the whole file, are
+// not supported.
+func EnclosingNodes(query *PositionQuery, options Options) ([]*EnclosingNode, error) {
+	if options.PositionFormat == PositionTable {
+		return nil, fmt.Errorf("%s position format is not supported for asty at", PositionTable)
+	}
+	src, err := os.ReadFile(query.Filename)
+	if err != nil {
+		return nil, err
+	}
+	marshaller := NewMarshaller(options)
+	marshaller.SetSource(src)
+	mode := parser.SkipObjectResolution
+	if options.WithComments || options.WithDirectives {
+		mode |= parser.ParseComments
+	}
+	tree, err := parser.ParseFile(marshaller.FileSet(), query.Filename, src, mode)
+	if err != nil {
+		return nil, err
+	}
+	start, end, err := query.interval(marshaller.FileSet().File(tree.Pos()))
+	if err != nil {
+		return nil, err
+	}
+
+	path := astPathEnclosing(tree, start, end, options.WithComments)
+	result := make([]*EnclosingNode, len(path))
+	for index, step := range path {
+		node := &EnclosingNode{
+			Field:    step.Field,
+			Index:    step.Index,
+			NodeType: reflect.TypeOf(step.Node).Elem().Name(),
+			Pos:      marshaller.marshalPosition(step.Node.Pos()),
+			End:      marshaller.marshalPosition(step.Node.End()),
+		}
+		if index == len(path)-1 {
+			node.Node = marshalAny(marshaller, step.Node)
+		}
+		result[len(path)-1-index] = node
+	}
+	return result, nil
+}
+
+func EnclosingToJSON(position string, output string, indent string, options Options) error {
+	query, err := ParsePositionQuery(position)
+	if err != nil {
+		return err
+	}
+	nodes, err := EnclosingNodes(query, options)
+	if err != nil {
+		return err
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	encoder := json.NewEncoder(outFile)
+	encoder.SetIndent("", indent)
+	return encoder.Encode(nodes)
+}
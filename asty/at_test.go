@@ -0,0 +1,158 @@
+package asty
+
+import (
+	"encoding/json"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const atSource = `package p
+
+func f(a, b int) int {
+	return a + b*2
+}
+`
+
+func TestParsePositionQuery(t *testing.T) {
+	queries := map[string]*PositionQuery{
+		"f.go:3:10":           {Filename: "f.go", Line: 3, Column: 10},
+		"c:\\dir\\f.go:1:2":   {Filename: "c:\\dir\\f.go", Line: 1, Column: 2},
+		"f.go:#12":            {Filename: "f.go", Start: 12, End: 12},
+		"dir/f.go:#12,#20":    {Filename: "dir/f.go", Start: 12, End: 20},
+		"f.go:3":              nil,
+		"f.go:0:1":            nil,
+		"f.go:#x":             nil,
+		"f.go:#20,#12":        nil,
+		"f.go:line:column:10": nil,
+	}
+	for query, expected := range queries {
+		actual, err := ParsePositionQuery(query)
+		if expected == nil {
+			if err == nil {
+				t.Errorf("%s: error expected", query)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: unexpected result %+v %v", query, actual, err)
+		}
+	}
+}
+
+func enclosingForTest(t *testing.T, filename, position string) []string {
+	query, err := ParsePositionQuery(filename + position)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := EnclosingNodes(query, Options{WithPositions: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []string
+	for _, node := range nodes {
+		result = append(result, node.Field+":"+node.NodeType)
+	}
+	return result
+}
+
+func TestEnclosingNodes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "at.go")
+	err := os.WriteFile(filename, []byte(atSource), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outer := []string{"Results:BinaryExpr", "List:ReturnStmt", "Body:BlockStmt", "Decls:FuncDecl", ":File"}
+	expected := append([]string{"X:Ident"}, outer...)
+	if actual := enclosingForTest(t, filename, ":4:9"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected path %v", actual)
+	}
+
+	// "b*2" and "a + b" are selected by ranges.
+	expected = append([]string{"Y:BinaryExpr"}, outer...)
+	if actual := enclosingForTest(t, filename, ":#46,#49"); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("unexpected path %v", actual)
+	}
+	if actual := enclosingForTest(t, filename, ":#42,#47"); !reflect.DeepEqual(actual, outer) {
+		t.Errorf("unexpected path %v", actual)
+	}
+
+	output := filepath.Join(t.TempDir(), "at.json")
+	err = EnclosingToJSON(filename+":3:8", output, "", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []struct {
+		Field    string
+		Index    int
+		NodeType string
+		Pos      *PositionNode
+		Node     json.RawMessage
+	}
+	err = json.Unmarshal(data, &nodes)
+	if err != nil || len(nodes) != 6 || nodes[0].Field != "Names" || nodes[0].Index != 0 ||
+		string(nodes[0].Node) != `{"NodeType":"Ident","Name":"a"}` {
+		t.Errorf("unexpected output %s", data)
+	}
+	// Enclosing nodes are only described.
+	for _, node := range nodes[1:] {
+		if node.Node != nil || node.NodeType == "" || node.Pos == nil {
+			t.Errorf("unexpected output %s", data)
+		}
+	}
+
+	// Columns may select the newline ending a line, but nothing past it.
+	if actual := enclosingForTest(t, filename, ":4:16"); !reflect.DeepEqual(actual, outer[2:]) {
+		t.Errorf("unexpected path %v", actual)
+	}
+	for _, position := range []string{":10:1", ":4:17", ":5:4", ":#1000", "-missing.go:1:1"} {
+		err = EnclosingToJSON(filename+position, "", "", Options{})
+		if err == nil {
+			t.Errorf("%s: error expected", position)
+		}
+	}
+	err = EnclosingToJSON(filename+":4:9", "", "", Options{WithPositions: true, PositionFormat: PositionTable})
+	if err == nil {
+		t.Error("error expected for the table position format")
+	}
+}
+
+// TestEnclosingMatchesMarshalled checks that paths found in go/ast are the
+// ones of the marshalled file.
+func TestEnclosingMatchesMarshalled(t *testing.T) {
+	inputs, err := listDir(getTestDataRoot(), ".input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, comments := range []bool{false, true} {
+		for _, input := range append(inputs, "cli.go") {
+			tree, file := marshalFileForTest(t, input, Options{WithComments: comments})
+			size := int(tree.FileEnd - tree.FileStart)
+			for offset := 0; offset <= size; offset += 7 {
+				pos := tree.FileStart + token.Pos(offset)
+				path, _ := pathEnclosing(file, tree, pos, pos+token.Pos(offset%2))
+				expected := StepsToPath(path)
+				astPath := astPathEnclosing(tree, pos, pos+token.Pos(offset%2), comments)
+				actual := make([]*PathElement, len(astPath))
+				for index, step := range astPath {
+					actual[index] = &PathElement{
+						NodeType: reflect.TypeOf(step.Node).Elem().Name(),
+						Field:    step.Field,
+						Index:    step.Index,
+					}
+				}
+				if !reflect.DeepEqual(actual, expected) {
+					t.Fatalf("%s:#%d: expected %s, got %s", input, offset,
+						mustMarshal(t, expected), mustMarshal(t, actual))
+				}
+			}
+		}
+	}
+}
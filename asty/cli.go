@@ -1,10 +1,15 @@
 package asty
 
 import (
-	"encoding/json"
+	"bufio"
+	"errors"
+	"fmt"
+	"go/ast"
 	"go/parser"
 	"go/printer"
+	"go/scanner"
 	"go/token"
+	"io"
 )
 
 type Options struct {
@@ -12,71 +17,238 @@ type Options struct {
 	WithComments   bool
 	WithReferences bool
 	WithImports    bool
+	WithSpans      bool
+	WithDirectives bool
+	WithDocs       bool
+	Tolerant       bool
+	PositionFormat string
+	WithSource     string
+	TabWidth       int
+	PrintMode      string
+	Spaces         bool
+	Gofmt          bool
+	FixImports     bool
 }
 
-func SourceToJSON(input, output string, indent string, options Options) error {
-	marshaller := NewMarshaller(options)
+// SourceError is a single syntax error reported for go source.
+type SourceError struct {
+	Filename string `json:"Filename,omitempty"`
+	Line     int    `json:"Line"`
+	Column   int    `json:"Column"`
+	Offset   int    `json:"Offset"`
+	Message  string `json:"Message"`
+}
+
+func sourceErrors(err error) []*SourceError {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return nil
+	}
+	// Errors reported twice at the same position are listed once.
+	result := make([]*SourceError, 0, len(list))
+	for index, item := range list {
+		if index > 0 && item.Pos == list[index-1].Pos && item.Msg == list[index-1].Msg {
+			continue
+		}
+		result = append(result, &SourceError{
+			Filename: item.Pos.Filename,
+			Line:     item.Pos.Line,
+			Column:   item.Pos.Column,
+			Offset:   item.Pos.Offset,
+			Message:  item.Msg,
+		})
+	}
+	return result
+}
+
+// EncodeSource parses go source and encodes it into an Encoder ready to Flush.
+func EncodeSource(filename string, src io.Reader, options Options) (*Encoder, error) {
+	err := checkPositionFormat(options.PositionFormat)
+	if err != nil {
+		return nil, err
+	}
+	err = checkSourceSelection(options.WithSource)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	encoder := NewEncoder(options)
+	encoder.SetSource(data)
 
 	mode := parser.SkipObjectResolution
-	if options.WithComments {
+	if options.WithComments || options.WithDirectives {
 		mode |= parser.ParseComments
 	}
+	if options.Tolerant {
+		mode |= parser.AllErrors
+	}
+
+	tree, err := parser.ParseFile(encoder.FileSet(), filename, data, mode)
+	// In tolerant mode syntax errors are kept along with the partial tree,
+	// other errors still fail.
+	list := sourceErrors(err)
+	if err != nil && (!options.Tolerant || tree == nil || list == nil) {
+		return nil, err
+	}
+
+	err = encoder.EncodePartialFile(tree, list)
+	if err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
+
+// DecodeSource decodes a json document and converts it back into go syntax
+// along with the file set needed to print it. The document is a single node
+// of any type accepted by MakeNode, giving an ast.Node, or an array of them,
+// giving []ast.Node. The result is printed with FprintNode. Imports of a file
+// are fixed first when FixImports is set.
+func DecodeSource(src io.Reader, options Options) (*token.FileSet, any, error) {
+	reader := bufio.NewReader(src)
+	first, err := peekNonSpace(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decoder := NewDecoder(reader)
+	unmarshaler := NewUnmarshaller(options)
+	if first == '[' {
+		nodes, err := decoder.DecodeNodes()
+		if err != nil {
+			return nil, nil, err
+		}
+		result := make([]ast.Node, len(nodes))
+		for index, node := range nodes {
+			if node == nil {
+				return nil, nil, fmt.Errorf("asty: null node at index %d", index)
+			}
+			result[index] = unmarshaler.UnmarshalNode(node)
+		}
+		return unmarshaler.FileSet(), result, nil
+	}
+
+	node, err := decoder.DecodeNode()
+	if err != nil {
+		return nil, nil, err
+	}
+	if node == nil {
+		return nil, nil, errors.New("asty: null document")
+	}
+	if file, ok := node.(*FileNode); ok && options.FixImports {
+		FixImports(file, options.WithImports)
+	}
+	tree := unmarshaler.UnmarshalNode(node)
+	return unmarshaler.FileSet(), tree, nil
+}
+
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, reader.UnreadByte()
+	}
+}
+
+// FprintNode prints the result of DecodeSource. Lists of declarations or
+// statements are printed by go/printer as a whole, other lists node by node.
+// Output always ends with a newline.
+func FprintNode(w io.Writer, fset *token.FileSet, node any) error {
+	return fprintNode(w, &printer.Config{Tabwidth: DefaultTabWidth}, fset, node)
+}
+
+func fprintNode(w io.Writer, config *printer.Config, fset *token.FileSet, node any) error {
+	if file, ok := node.(*ast.File); ok {
+		return config.Fprint(w, fset, file)
+	}
+	nodes, ok := node.([]ast.Node)
+	if !ok {
+		err := config.Fprint(w, fset, node)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, "\n")
+		return err
+	}
+
+	decls := make([]ast.Decl, 0, len(nodes))
+	stmts := make([]ast.Stmt, 0, len(nodes))
+	for _, item := range nodes {
+		if decl, ok := item.(ast.Decl); ok {
+			decls = append(decls, decl)
+		}
+		if stmt, ok := item.(ast.Stmt); ok {
+			stmts = append(stmts, stmt)
+		}
+	}
+	switch {
+	case len(nodes) == 0:
+		return nil
+	case len(decls) == len(nodes):
+		return fprintNode(w, config, fset, decls)
+	case len(stmts) == len(nodes):
+		return fprintNode(w, config, fset, stmts)
+	}
+	for _, item := range nodes {
+		err := fprintNode(w, config, fset, item)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+func SourceToJSON(input, output string, indent string, options Options) error {
 	inFile, closeIn, err := OpenRead(input)
 	if err != nil {
 		return err
 	}
 	defer closeIn()
 
-	tree, err := parser.ParseFile(marshaller.FileSet(), input, inFile, mode)
+	encoder, err := EncodeSource(input, inFile, options)
 	if err != nil {
 		return err
 	}
 
-	node := marshaller.MarshalFile(tree)
-
 	outFile, closeOut, err := OpenOrCreateWrite(output)
 	if err != nil {
 		return err
 	}
 	defer closeOut()
 
-	encoder := json.NewEncoder(outFile)
-	encoder.SetIndent("", indent)
-	err = encoder.Encode(node)
-	if err != nil {
-		return err
-	}
-	return nil
+	return encoder.Flush(outFile, indent)
 }
 
 func JSONToSource(input, output string, options Options) error {
+	err := checkPrintOptions(options)
+	if err != nil {
+		return err
+	}
 	inFile, closeIn, err := OpenRead(input)
 	if err != nil {
 		return err
 	}
 	defer closeIn()
 
-	var node FileNode
-	decoder := json.NewDecoder(inFile)
-	err = decoder.Decode(&node)
+	fset, tree, err := DecodeSource(inFile, options)
 	if err != nil {
 		return err
 	}
 
-	unmarshaler := NewUnmarshaller(options)
-	tree := unmarshaler.UnmarshalFileNode(&node)
-
 	outFile, closeOut, err := OpenOrCreateWrite(output)
 	if err != nil {
 		return err
 	}
 	defer closeOut()
-	err = printer.Fprint(outFile, unmarshaler.FileSet(), tree)
-	if err != nil {
-		return err
-	}
-	return nil
+	return PrintSource(outFile, fset, tree, options)
 }
 
 func Loop(input, output string, comments bool) error {
@@ -1,6 +1,7 @@
 package asty
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/sergi/go-diff/diffmatchpatch"
 	"go/build"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 const (
@@ -277,3 +279,35 @@ func TestRoundTripParamsMatrix(t *testing.T) {
 		})
 	}
 }
+
+func TestTolerant(t *testing.T) {
+	src := "package p\n\nfunc f() {\n\tx := \n\treturn 1 +\n}\n"
+	_, err := EncodeSource("broken.go", strings.NewReader(src), Options{})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+
+	encoder, err := EncodeSource("broken.go", strings.NewReader(src), Options{Tolerant: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := NewDecoder(bytes.NewReader(encoder.Bytes())).DecodeNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := node.(*FileNode)
+	if len(file.Errors) != 5 || file.Errors[0].Line != 5 || file.Errors[0].Offset != 30 ||
+		file.Errors[2].Line != 6 || file.Errors[2].Message != "expected operand, found '}'" {
+		t.Errorf("unexpected errors %s", encoder.Bytes())
+	}
+
+	output := printDocumentForTest(t, string(encoder.Bytes()), Options{})
+	if !strings.Contains(output, "return 1 + BadExpr") {
+		t.Errorf("unexpected output %q", output)
+	}
+
+	_, err = EncodeSource("broken.go", iotest.ErrReader(io.ErrUnexpectedEOF), Options{Tolerant: true})
+	if err == nil {
+		t.Error("error expected for unreadable source")
+	}
+}
@@ -0,0 +1,213 @@
+package asty
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"sort"
+)
+
+type CloneOptions struct {
+	MinNodes       int
+	IgnoreIdents   bool
+	IgnoreLiterals bool
+}
+
+type CloneInstance struct {
+	Filename  string `json:"Filename"`
+	StartLine int    `json:"StartLine"`
+	EndLine   int    `json:"EndLine"`
+}
+
+type CloneGroup struct {
+	NodeType  string           `json:"NodeType"`
+	Nodes     int              `json:"Nodes"`
+	Hash      string           `json:"Hash"`
+	Instances []*CloneInstance `json:"Instances"`
+}
+
+type CloneReport struct {
+	Files  int           `json:"Files"`
+	Groups []*CloneGroup `json:"Groups"`
+}
+
+type cloneCandidate struct {
+	node  INode
+	hash  uint64
+	size  int
+	first *PositionNode
+	last  *PositionNode
+}
+
+func (c *cloneCandidate) cover(first, last *PositionNode) {
+	if first != nil && (c.first == nil || first.Offset < c.first.Offset) {
+		c.first = first
+	}
+	if last != nil && (c.last == nil || last.Offset > c.last.Offset) {
+		c.last = last
+	}
+}
+
+type cloneDetector struct {
+	CloneOptions
+	compare    CompareOptions
+	candidates []*cloneCandidate
+}
+
+func (d *cloneDetector) visit(node INode) *cloneCandidate {
+	candidate := &cloneCandidate{node: node, size: 1}
+	walkPositions(node, func(_ string, position *PositionNode) {
+		candidate.cover(position, position)
+	})
+	candidate.hash = d.compare.hash(node, func(child INode) uint64 {
+		sub := d.visit(child)
+		candidate.size += sub.size
+		candidate.cover(sub.first, sub.last)
+		return sub.hash
+	})
+
+	switch node.(type) {
+	case IExprNode, IStmtNode, IDeclNode:
+		if candidate.size >= d.MinNodes && candidate.first != nil {
+			d.candidates = append(d.candidates, candidate)
+		}
+	}
+	return candidate
+}
+
+func (d *cloneDetector) groups() [][]*cloneCandidate {
+	byHash := make(map[uint64][]*cloneCandidate)
+	for _, candidate := range d.candidates {
+		byHash[candidate.hash] = append(byHash[candidate.hash], candidate)
+	}
+
+	var groups [][]*cloneCandidate
+	for _, candidates := range byHash {
+		// Hash collisions are possible, so members are confirmed with Equal.
+		for len(candidates) > 1 {
+			var group, rest []*cloneCandidate
+			for _, candidate := range candidates {
+				if Equal(candidates[0].node, candidate.node, d.compare) {
+					group = append(group, candidate)
+				} else {
+					rest = append(rest, candidate)
+				}
+			}
+			if len(group) > 1 {
+				groups = append(groups, group)
+			}
+			candidates = rest
+		}
+	}
+
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			return lessPosition(group[i].first, group[j].first)
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i][0].size != groups[j][0].size {
+			return groups[i][0].size > groups[j][0].size
+		}
+		return lessPosition(groups[i][0].first, groups[j][0].first)
+	})
+	return groups
+}
+
+func lessPosition(a, b *PositionNode) bool {
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	return a.Offset < b.Offset
+}
+
+// DetectClones reports groups of structurally equal subtrees having at least
+// MinNodes nodes. Files must be marshalled with positions. Groups whose members
+// all lie inside members of a larger reported group are omitted.
+func DetectClones(files []*FileNode, options CloneOptions) []*CloneGroup {
+	detector := &cloneDetector{
+		CloneOptions: options,
+		compare: CompareOptions{
+			IgnoreIdents:   options.IgnoreIdents,
+			IgnoreLiterals: options.IgnoreLiterals,
+		},
+	}
+	for _, file := range files {
+		detector.visit(file)
+	}
+
+	covered := make(map[INode]bool)
+	result := make([]*CloneGroup, 0)
+	for _, group := range detector.groups() {
+		uncovered := false
+		for _, candidate := range group {
+			if !covered[candidate.node] {
+				uncovered = true
+			}
+		}
+		if !uncovered {
+			continue
+		}
+
+		instances := make([]*CloneInstance, len(group))
+		for index, candidate := range group {
+			instances[index] = &CloneInstance{
+				Filename:  candidate.first.Filename,
+				StartLine: candidate.first.Line,
+				EndLine:   candidate.last.Line,
+			}
+			Inspect(candidate.node, func(node INode) bool {
+				if node != nil {
+					covered[node] = true
+				}
+				return true
+			})
+		}
+		result = append(result, &CloneGroup{
+			NodeType:  nodeTypeOf(group[0].node),
+			Nodes:     group[0].size,
+			Hash:      fmt.Sprintf("%016x", group[0].hash),
+			Instances: instances,
+		})
+	}
+	return result
+}
+
+func nodeTypeOf(node INode) string {
+	if node, ok := node.(decodable); ok {
+		return node.base().NodeType
+	}
+	return ""
+}
+
+func ClonesToJSON(patterns []string, output string, indent string, options CloneOptions) error {
+	filenames, err := ListGoFiles(patterns)
+	if err != nil {
+		return err
+	}
+
+	files := make([]*FileNode, len(filenames))
+	for index, filename := range filenames {
+		marshaller := NewMarshaller(Options{WithPositions: true})
+		tree, err := parser.ParseFile(marshaller.FileSet(), filename, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return err
+		}
+		files[index] = marshaller.MarshalFile(tree)
+	}
+
+	report := &CloneReport{
+		Files:  len(files),
+		Groups: DetectClones(files, options),
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	encoder := json.NewEncoder(outFile)
+	encoder.SetIndent("", indent)
+	return encoder.Encode(report)
+}
@@ -0,0 +1,155 @@
+package asty
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const clonesSourceA = `package p
+
+func sum(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}
+`
+
+const clonesSourceB = `package p
+
+func add(items []int) int {
+	result := 0
+	for _, item := range items {
+		if item > 0 {
+			result += item
+		}
+	}
+	return result
+}
+
+func positive(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}
+`
+
+func writeClonesPackage(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.go":               clonesSourceA,
+		"b.go":               clonesSourceB,
+		"testdata/c.go":      clonesSourceA,
+		"sub/d.go":           clonesSourceA,
+		"sub/.hidden/e.go":   clonesSourceA,
+		"sub/notes.txt":      "",
+		"sub/vendor/x/f.go":  clonesSourceA,
+		"sub/_skipped/g.go":  clonesSourceA,
+		"sub/nested/h_go.go": "package nested\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(content), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestListGoFiles(t *testing.T) {
+	dir := writeClonesPackage(t)
+	files, err := ListGoFiles([]string{dir + "/...", filepath.Join(dir, "a.go")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, "a.go"),
+		filepath.Join(dir, "b.go"),
+		filepath.Join(dir, "sub", "d.go"),
+		filepath.Join(dir, "sub", "nested", "h_go.go"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("unexpected files %v", files)
+	}
+
+	files, err = ListGoFiles([]string{filepath.Join(dir, "sub")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{filepath.Join(dir, "sub", "d.go")}) {
+		t.Errorf("unexpected files %v", files)
+	}
+
+	_, err = ListGoFiles([]string{filepath.Join(dir, "missing")})
+	if err == nil {
+		t.Error("error expected")
+	}
+}
+
+func runClones(t *testing.T, patterns []string, options CloneOptions) *CloneReport {
+	output := filepath.Join(t.TempDir(), "clones.json")
+	err := ClonesToJSON(patterns, output, "", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report CloneReport
+	err = json.Unmarshal(data, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &report
+}
+
+func TestClones(t *testing.T) {
+	dir := writeClonesPackage(t)
+	patterns := []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")}
+
+	report := runClones(t, patterns, CloneOptions{MinNodes: 15})
+	if report.Files != 2 || len(report.Groups) != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	group := report.Groups[0]
+	expected := []*CloneInstance{
+		{Filename: patterns[0], StartLine: 3, EndLine: 11},
+		{Filename: patterns[1], StartLine: 13, EndLine: 21},
+	}
+	if group.NodeType != "BlockStmt" || group.Nodes != 19 || !reflect.DeepEqual(group.Instances, expected) {
+		t.Errorf("unexpected group %+v", group)
+	}
+
+	report = runClones(t, patterns, CloneOptions{MinNodes: 15, IgnoreIdents: true})
+	if len(report.Groups) != 1 || report.Groups[0].NodeType != "FuncDecl" || len(report.Groups[0].Instances) != 3 {
+		t.Errorf("type-2 clones expected, got %+v", report.Groups)
+	}
+
+	report = runClones(t, patterns, CloneOptions{MinNodes: 1000})
+	if len(report.Groups) != 0 {
+		t.Errorf("no clones expected, got %+v", report.Groups)
+	}
+}
+
+func TestClonesInvalidInput(t *testing.T) {
+	err := ClonesToJSON([]string{InvalidGoFile}, "", "", CloneOptions{})
+	if err == nil {
+		t.Error("error expected")
+	}
+}
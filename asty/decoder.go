@@ -0,0 +1,1348 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// Decoder builds node structs in a single pass over a JSON token stream. It
+// accepts the same documents as the UnmarshalJSON methods of the node types,
+// but does not re-scan nested objects at each level of the tree.
+type Decoder struct {
+	dec *json.Decoder
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &Decoder{dec: dec}
+}
+
+func (d *Decoder) DecodeFile() (*FileNode, error) {
+	return decodeNode[FileNode](d)
+}
+
+func (d *Decoder) DecodeExpr() (IExprNode, error) {
+	var result IExprNode
+	err := d.decodeObject(func(nodeType string) decodable {
+		result = newExpr(nodeType)
+		node, _ := result.(decodable)
+		return node
+	})
+	return result, err
+}
+
+func (d *Decoder) DecodeStmt() (IStmtNode, error) {
+	var result IStmtNode
+	err := d.decodeObject(func(nodeType string) decodable {
+		result = newStmt(nodeType)
+		node, _ := result.(decodable)
+		return node
+	})
+	return result, err
+}
+
+func (d *Decoder) DecodeSpec() (ISpecNode, error) {
+	var result ISpecNode
+	err := d.decodeObject(func(nodeType string) decodable {
+		result = newSpec(nodeType)
+		node, _ := result.(decodable)
+		return node
+	})
+	return result, err
+}
+
+func (d *Decoder) DecodeDecl() (IDeclNode, error) {
+	var result IDeclNode
+	err := d.decodeObject(func(nodeType string) decodable {
+		result = newDecl(nodeType)
+		node, _ := result.(decodable)
+		return node
+	})
+	return result, err
+}
+
+// DecodeNode decodes a document of any type accepted by MakeNode.
+func (d *Decoder) DecodeNode() (INode, error) {
+	var result INode
+	err := d.decodeObject(func(nodeType string) decodable {
+		result = MakeNode(nodeType)
+		node, _ := result.(decodable)
+		return node
+	})
+	return result, err
+}
+
+// DecodeNodes decodes an array of documents accepted by DecodeNode.
+func (d *Decoder) DecodeNodes() ([]INode, error) {
+	return decodeList(d, (*Decoder).DecodeNode)
+}
+
+// ---------------------------------------------------------------------------
+
+type decodable interface {
+	base() *Node
+}
+
+type pendingField struct {
+	key   string
+	value json.RawMessage
+}
+
+func decodeNode[T any, P interface {
+	*T
+	decodable
+}](d *Decoder) (P, error) {
+	var result P
+	err := d.decodeObject(func(string) decodable {
+		result = new(T)
+		return result
+	})
+	return result, err
+}
+
+func decodeList[T any](d *Decoder, decodeItem func(*Decoder) (T, error)) ([]T, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if tok != json.Delim('[') {
+		return nil, d.unexpected(tok, "array")
+	}
+	result := make([]T, 0)
+	for d.dec.More() {
+		item, err := decodeItem(d)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	_, err = d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// decodeObject reads a single node object. The node is created as soon as its
+// NodeType is known; fields preceding NodeType are buffered and replayed.
+func (d *Decoder) decodeObject(create func(nodeType string) decodable) error {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('{') {
+		return d.unexpected(tok, "object")
+	}
+	return d.decodeObjectBody(create)
+}
+
+// decodeObjectBody reads the rest of a node object after its opening brace.
+func (d *Decoder) decodeObjectBody(create func(nodeType string) decodable) error {
+	var tok json.Token
+	var err error
+	var header Node
+	var node decodable
+	var pending []pendingField
+	for d.dec.More() {
+		tok, err = d.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return d.unexpected(tok, "object key")
+		}
+		switch {
+		case key == "NodeType":
+			header.NodeType, err = d.decodeString()
+			if err == nil && node == nil {
+				node = create(header.NodeType)
+				if node == nil {
+					return fmt.Errorf("asty: unsupported NodeType %q", header.NodeType)
+				}
+				err = d.replay(node, pending)
+				pending = nil
+			}
+		case key == "RefId":
+			header.RefId, err = d.decodeInt()
+		case key == "Pos":
+			header.Pos, err = d.decodePosition()
+		case key == "End":
+			header.End, err = d.decodePosition()
+		case key == "Source":
+			header.Source, err = d.decodeString()
+		case node != nil:
+			err = d.decodeField(node, key)
+		default:
+			var value json.RawMessage
+			err = d.dec.Decode(&value)
+			pending = append(pending, pendingField{key: key, value: value})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err = d.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if node == nil {
+		node = create(header.NodeType)
+		if node == nil {
+			return fmt.Errorf("asty: unsupported NodeType %q", header.NodeType)
+		}
+		err = d.replay(node, pending)
+		if err != nil {
+			return err
+		}
+	}
+	*node.base() = header
+	if file, ok := node.(*FileNode); ok && file.FileSet == nil {
+		file.FileSet = token.NewFileSet()
+	}
+	return nil
+}
+
+// decodePosition reads a position in any of the encodings accepted by
+// PositionNode.UnmarshalJSON.
+func (d *Decoder) decodePosition() (*PositionNode, error) {
+	tok, err := d.dec.Token()
+	if err != nil || tok == nil {
+		return nil, err
+	}
+	switch value := tok.(type) {
+	case json.Number:
+		offset, err := strconv.Atoi(value.String())
+		if err != nil {
+			return nil, err
+		}
+		return &PositionNode{Node: Node{NodeType: "Position"}, Format: PositionOffset, Offset: offset}, nil
+	case string:
+		return parseCompactPosition(value)
+	}
+	if tok != json.Delim('{') {
+		return nil, d.unexpected(tok, "position")
+	}
+	result := &PositionNode{}
+	err = d.decodeObjectBody(func(string) decodable {
+		return result
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (d *Decoder) replay(node decodable, pending []pendingField) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	outer := d.dec
+	defer func() {
+		d.dec = outer
+	}()
+	for _, field := range pending {
+		d.dec = json.NewDecoder(bytes.NewReader(field.value))
+		d.dec.UseNumber()
+		err := d.decodeField(node, field.key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decoder) unexpected(tok json.Token, expected string) error {
+	return fmt.Errorf("asty: unexpected %v at offset %d, expected %s", tok, d.dec.InputOffset(), expected)
+}
+
+func (d *Decoder) skip() error {
+	var value json.RawMessage
+	return d.dec.Decode(&value)
+}
+
+func (d *Decoder) decodeString() (string, error) {
+	tok, err := d.dec.Token()
+	if err != nil || tok == nil {
+		return "", err
+	}
+	value, ok := tok.(string)
+	if !ok {
+		return "", d.unexpected(tok, "string")
+	}
+	return value, nil
+}
+
+func (d *Decoder) decodeInt() (int, error) {
+	tok, err := d.dec.Token()
+	if err != nil || tok == nil {
+		return 0, err
+	}
+	value, ok := tok.(json.Number)
+	if !ok {
+		return 0, d.unexpected(tok, "number")
+	}
+	return strconv.Atoi(value.String())
+}
+
+func (d *Decoder) decodeBool() (bool, error) {
+	tok, err := d.dec.Token()
+	if err != nil || tok == nil {
+		return false, err
+	}
+	value, ok := tok.(bool)
+	if !ok {
+		return false, d.unexpected(tok, "boolean")
+	}
+	return value, nil
+}
+
+func (d *Decoder) decodeFileSet() (*token.FileSet, error) {
+	var data json.RawMessage
+	err := d.dec.Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	if string(data) == "null" {
+		return fset, nil
+	}
+	err = fset.Read(func(dest any) error {
+		return json.Unmarshal(data, dest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fset, nil
+}
+
+func (d *Decoder) decodeFiles() (map[string]*FileNode, error) {
+	tok, err := d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if tok != json.Delim('{') {
+		return nil, d.unexpected(tok, "object")
+	}
+	files := make(map[string]*FileNode)
+	for d.dec.More() {
+		tok, err = d.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return nil, d.unexpected(tok, "object key")
+		}
+		files[name], err = d.DecodeFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = d.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ---------------------------------------------------------------------------
+
+func (d *Decoder) decodeField(node decodable, key string) error {
+	switch n := node.(type) {
+	case *PositionNode:
+		return d.decodePositionNodeField(n, key)
+	case *CommentNode:
+		return d.decodeCommentNodeField(n, key)
+	case *CommentGroupNode:
+		return d.decodeCommentGroupNodeField(n, key)
+	case *FieldNode:
+		return d.decodeFieldNodeField(n, key)
+	case *FieldListNode:
+		return d.decodeFieldListNodeField(n, key)
+	case *BadExprNode:
+		return d.decodeBadExprNodeField(n, key)
+	case *IdentNode:
+		return d.decodeIdentNodeField(n, key)
+	case *EllipsisNode:
+		return d.decodeEllipsisNodeField(n, key)
+	case *BasicLitNode:
+		return d.decodeBasicLitNodeField(n, key)
+	case *FuncLitNode:
+		return d.decodeFuncLitNodeField(n, key)
+	case *CompositeLitNode:
+		return d.decodeCompositeLitNodeField(n, key)
+	case *ParenExprNode:
+		return d.decodeParenExprNodeField(n, key)
+	case *SelectorExprNode:
+		return d.decodeSelectorExprNodeField(n, key)
+	case *IndexExprNode:
+		return d.decodeIndexExprNodeField(n, key)
+	case *IndexListExprNode:
+		return d.decodeIndexListExprNodeField(n, key)
+	case *SliceExprNode:
+		return d.decodeSliceExprNodeField(n, key)
+	case *TypeAssertExprNode:
+		return d.decodeTypeAssertExprNodeField(n, key)
+	case *CallExprNode:
+		return d.decodeCallExprNodeField(n, key)
+	case *StarExprNode:
+		return d.decodeStarExprNodeField(n, key)
+	case *UnaryExprNode:
+		return d.decodeUnaryExprNodeField(n, key)
+	case *BinaryExprNode:
+		return d.decodeBinaryExprNodeField(n, key)
+	case *KeyValueExprNode:
+		return d.decodeKeyValueExprNodeField(n, key)
+	case *ArrayTypeNode:
+		return d.decodeArrayTypeNodeField(n, key)
+	case *StructTypeNode:
+		return d.decodeStructTypeNodeField(n, key)
+	case *FuncTypeNode:
+		return d.decodeFuncTypeNodeField(n, key)
+	case *InterfaceTypeNode:
+		return d.decodeInterfaceTypeNodeField(n, key)
+	case *MapTypeNode:
+		return d.decodeMapTypeNodeField(n, key)
+	case *ChanTypeNode:
+		return d.decodeChanTypeNodeField(n, key)
+	case *BadStmtNode:
+		return d.decodeBadStmtNodeField(n, key)
+	case *DeclStmtNode:
+		return d.decodeDeclStmtNodeField(n, key)
+	case *EmptyStmtNode:
+		return d.decodeEmptyStmtNodeField(n, key)
+	case *LabeledStmtNode:
+		return d.decodeLabeledStmtNodeField(n, key)
+	case *ExprStmtNode:
+		return d.decodeExprStmtNodeField(n, key)
+	case *SendStmtNode:
+		return d.decodeSendStmtNodeField(n, key)
+	case *IncDecStmtNode:
+		return d.decodeIncDecStmtNodeField(n, key)
+	case *AssignStmtNode:
+		return d.decodeAssignStmtNodeField(n, key)
+	case *GoStmtNode:
+		return d.decodeGoStmtNodeField(n, key)
+	case *DeferStmtNode:
+		return d.decodeDeferStmtNodeField(n, key)
+	case *ReturnStmtNode:
+		return d.decodeReturnStmtNodeField(n, key)
+	case *BranchStmtNode:
+		return d.decodeBranchStmtNodeField(n, key)
+	case *BlockStmtNode:
+		return d.decodeBlockStmtNodeField(n, key)
+	case *IfStmtNode:
+		return d.decodeIfStmtNodeField(n, key)
+	case *CaseClauseNode:
+		return d.decodeCaseClauseNodeField(n, key)
+	case *SwitchStmtNode:
+		return d.decodeSwitchStmtNodeField(n, key)
+	case *TypeSwitchStmtNode:
+		return d.decodeTypeSwitchStmtNodeField(n, key)
+	case *CommClauseNode:
+		return d.decodeCommClauseNodeField(n, key)
+	case *SelectStmtNode:
+		return d.decodeSelectStmtNodeField(n, key)
+	case *ForStmtNode:
+		return d.decodeForStmtNodeField(n, key)
+	case *RangeStmtNode:
+		return d.decodeRangeStmtNodeField(n, key)
+	case *ImportSpecNode:
+		return d.decodeImportSpecNodeField(n, key)
+	case *ValueSpecNode:
+		return d.decodeValueSpecNodeField(n, key)
+	case *TypeSpecNode:
+		return d.decodeTypeSpecNodeField(n, key)
+	case *BadDeclNode:
+		return d.decodeBadDeclNodeField(n, key)
+	case *GenDeclNode:
+		return d.decodeGenDeclNodeField(n, key)
+	case *FuncDeclNode:
+		return d.decodeFuncDeclNodeField(n, key)
+	case *FileNode:
+		return d.decodeFileNodeField(n, key)
+	case *PackageNode:
+		return d.decodePackageNodeField(n, key)
+	default:
+		panic("implement me " + reflect.TypeOf(node).String())
+	}
+}
+
+func (d *Decoder) decodePositionNodeField(node *PositionNode, key string) (err error) {
+	switch key {
+	case "Filename":
+		node.Filename, err = d.decodeString()
+	case "Offset":
+		node.Offset, err = d.decodeInt()
+	case "Line":
+		node.Line, err = d.decodeInt()
+	case "Column":
+		node.Column, err = d.decodeInt()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeCommentNodeField(node *CommentNode, key string) (err error) {
+	switch key {
+	case "Slash":
+		node.Slash, err = d.decodePosition()
+	case "Text":
+		node.Text, err = d.decodeString()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeCommentGroupNodeField(node *CommentGroupNode, key string) (err error) {
+	switch key {
+	case "List":
+		node.List, err = decodeList(d, decodeNode[CommentNode])
+	case "Parsed":
+		err = d.dec.Decode(&node.Parsed)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeFieldNodeField(node *FieldNode, key string) (err error) {
+	switch key {
+	case "Doc":
+		node.Doc, err = decodeNode[CommentGroupNode](d)
+	case "Names":
+		node.Names, err = decodeList(d, decodeNode[IdentNode])
+	case "Type":
+		node.Type, err = d.DecodeExpr()
+	case "Tag":
+		node.Tag, err = decodeNode[BasicLitNode](d)
+	case "Comment":
+		node.Comment, err = decodeNode[CommentGroupNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeFieldListNodeField(node *FieldListNode, key string) (err error) {
+	switch key {
+	case "Opening":
+		node.Opening, err = d.decodePosition()
+	case "List":
+		node.List, err = decodeList(d, decodeNode[FieldNode])
+	case "Closing":
+		node.Closing, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeBadExprNodeField(node *BadExprNode, key string) (err error) {
+	switch key {
+	case "From":
+		node.From, err = d.decodePosition()
+	case "To":
+		node.To, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeIdentNodeField(node *IdentNode, key string) (err error) {
+	switch key {
+	case "NamePos":
+		node.NamePos, err = d.decodePosition()
+	case "Name":
+		node.Name, err = d.decodeString()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeEllipsisNodeField(node *EllipsisNode, key string) (err error) {
+	switch key {
+	case "Ellipsis":
+		node.Ellipsis, err = d.decodePosition()
+	case "Elt":
+		node.Elt, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeBasicLitNodeField(node *BasicLitNode, key string) (err error) {
+	switch key {
+	case "ValuePos":
+		node.ValuePos, err = d.decodePosition()
+	case "Kind":
+		node.Kind, err = d.decodeString()
+	case "Value":
+		node.Value, err = d.decodeString()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeFuncLitNodeField(node *FuncLitNode, key string) (err error) {
+	switch key {
+	case "Type":
+		node.Type, err = decodeNode[FuncTypeNode](d)
+	case "Body":
+		node.Body, err = decodeNode[BlockStmtNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeCompositeLitNodeField(node *CompositeLitNode, key string) (err error) {
+	switch key {
+	case "Type":
+		node.Type, err = d.DecodeExpr()
+	case "Lbrace":
+		node.Lbrace, err = d.decodePosition()
+	case "Elts":
+		node.Elts, err = decodeList(d, (*Decoder).DecodeExpr)
+	case "Rbrace":
+		node.Rbrace, err = d.decodePosition()
+	case "Incomplete":
+		node.Incomplete, err = d.decodeBool()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeParenExprNodeField(node *ParenExprNode, key string) (err error) {
+	switch key {
+	case "Lparen":
+		node.Lparen, err = d.decodePosition()
+	case "X":
+		node.X, err = d.DecodeExpr()
+	case "Rparen":
+		node.Rparen, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeSelectorExprNodeField(node *SelectorExprNode, key string) (err error) {
+	switch key {
+	case "X":
+		node.X, err = d.DecodeExpr()
+	case "Sel":
+		node.Sel, err = decodeNode[IdentNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeIndexExprNodeField(node *IndexExprNode, key string) (err error) {
+	switch key {
+	case "X":
+		node.X, err = d.DecodeExpr()
+	case "Lbrack":
+		node.Lbrack, err = d.decodePosition()
+	case "Index":
+		node.Index, err = d.DecodeExpr()
+	case "Rbrack":
+		node.Rbrack, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeIndexListExprNodeField(node *IndexListExprNode, key string) (err error) {
+	switch key {
+	case "X":
+		node.X, err = d.DecodeExpr()
+	case "Lbrack":
+		node.Lbrack, err = d.decodePosition()
+	case "Indices":
+		node.Indices, err = decodeList(d, (*Decoder).DecodeExpr)
+	case "Rbrack":
+		node.Rbrack, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeSliceExprNodeField(node *SliceExprNode, key string) (err error) {
+	switch key {
+	case "X":
+		node.X, err = d.DecodeExpr()
+	case "Lbrack":
+		node.Lbrack, err = d.decodePosition()
+	case "Low":
+		node.Low, err = d.DecodeExpr()
+	case "High":
+		node.High, err = d.DecodeExpr()
+	case "Max":
+		node.Max, err = d.DecodeExpr()
+	case "Slice3":
+		node.Slice3, err = d.decodeBool()
+	case "Rbrack":
+		node.Rbrack, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeTypeAssertExprNodeField(node *TypeAssertExprNode, key string) (err error) {
+	switch key {
+	case "X":
+		node.X, err = d.DecodeExpr()
+	case "Lparen":
+		node.Lparen, err = d.decodePosition()
+	case "Type":
+		node.Type, err = d.DecodeExpr()
+	case "Rparen":
+		node.Rparen, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeCallExprNodeField(node *CallExprNode, key string) (err error) {
+	switch key {
+	case "Fun":
+		node.Fun, err = d.DecodeExpr()
+	case "Lparen":
+		node.Lparen, err = d.decodePosition()
+	case "Args":
+		node.Args, err = decodeList(d, (*Decoder).DecodeExpr)
+	case "Ellipsis":
+		node.Ellipsis, err = d.decodePosition()
+	case "Rparen":
+		node.Rparen, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeStarExprNodeField(node *StarExprNode, key string) (err error) {
+	switch key {
+	case "Star":
+		node.Star, err = d.decodePosition()
+	case "X":
+		node.X, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeUnaryExprNodeField(node *UnaryExprNode, key string) (err error) {
+	switch key {
+	case "OpPos":
+		node.OpPos, err = d.decodePosition()
+	case "Op":
+		node.Op, err = d.decodeString()
+	case "X":
+		node.X, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeBinaryExprNodeField(node *BinaryExprNode, key string) (err error) {
+	switch key {
+	case "X":
+		node.X, err = d.DecodeExpr()
+	case "OpPos":
+		node.OpPos, err = d.decodePosition()
+	case "Op":
+		node.Op, err = d.decodeString()
+	case "Y":
+		node.Y, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeKeyValueExprNodeField(node *KeyValueExprNode, key string) (err error) {
+	switch key {
+	case "Key":
+		node.Key, err = d.DecodeExpr()
+	case "Colon":
+		node.Colon, err = d.decodePosition()
+	case "Value":
+		node.Value, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeArrayTypeNodeField(node *ArrayTypeNode, key string) (err error) {
+	switch key {
+	case "Lbrack":
+		node.Lbrack, err = d.decodePosition()
+	case "Len":
+		node.Len, err = d.DecodeExpr()
+	case "Elt":
+		node.Elt, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeStructTypeNodeField(node *StructTypeNode, key string) (err error) {
+	switch key {
+	case "Struct":
+		node.Struct, err = d.decodePosition()
+	case "Fields":
+		node.Fields, err = decodeNode[FieldListNode](d)
+	case "Incomplete":
+		node.Incomplete, err = d.decodeBool()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeFuncTypeNodeField(node *FuncTypeNode, key string) (err error) {
+	switch key {
+	case "Func":
+		node.Func, err = d.decodePosition()
+	case "TypeParams":
+		node.TypeParams, err = decodeNode[FieldListNode](d)
+	case "Params":
+		node.Params, err = decodeNode[FieldListNode](d)
+	case "Results":
+		node.Results, err = decodeNode[FieldListNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeInterfaceTypeNodeField(node *InterfaceTypeNode, key string) (err error) {
+	switch key {
+	case "Interface":
+		node.Interface, err = d.decodePosition()
+	case "Methods":
+		node.Methods, err = decodeNode[FieldListNode](d)
+	case "Incomplete":
+		node.Incomplete, err = d.decodeBool()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeMapTypeNodeField(node *MapTypeNode, key string) (err error) {
+	switch key {
+	case "Map":
+		node.Map, err = d.decodePosition()
+	case "Key":
+		node.Key, err = d.DecodeExpr()
+	case "Value":
+		node.Value, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeChanTypeNodeField(node *ChanTypeNode, key string) (err error) {
+	switch key {
+	case "Begin":
+		node.Begin, err = d.decodePosition()
+	case "Arrow":
+		node.Arrow, err = d.decodePosition()
+	case "Dir":
+		node.Dir, err = d.decodeString()
+	case "Value":
+		node.Value, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeBadStmtNodeField(node *BadStmtNode, key string) (err error) {
+	switch key {
+	case "From":
+		node.From, err = d.decodePosition()
+	case "To":
+		node.To, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeDeclStmtNodeField(node *DeclStmtNode, key string) (err error) {
+	switch key {
+	case "Decl":
+		node.Decl, err = d.DecodeDecl()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeEmptyStmtNodeField(node *EmptyStmtNode, key string) (err error) {
+	switch key {
+	case "Semicolon":
+		node.Semicolon, err = d.decodePosition()
+	case "Implicit":
+		node.Implicit, err = d.decodeBool()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeLabeledStmtNodeField(node *LabeledStmtNode, key string) (err error) {
+	switch key {
+	case "Label":
+		node.Label, err = decodeNode[IdentNode](d)
+	case "Colon":
+		node.Colon, err = d.decodePosition()
+	case "Stmt":
+		node.Stmt, err = d.DecodeStmt()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeExprStmtNodeField(node *ExprStmtNode, key string) (err error) {
+	switch key {
+	case "X":
+		node.X, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeSendStmtNodeField(node *SendStmtNode, key string) (err error) {
+	switch key {
+	case "Chan":
+		node.Chan, err = d.DecodeExpr()
+	case "Arrow":
+		node.Arrow, err = d.decodePosition()
+	case "Value":
+		node.Value, err = d.DecodeExpr()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeIncDecStmtNodeField(node *IncDecStmtNode, key string) (err error) {
+	switch key {
+	case "X":
+		node.X, err = d.DecodeExpr()
+	case "TokPos":
+		node.TokPos, err = d.decodePosition()
+	case "Tok":
+		node.Tok, err = d.decodeString()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeAssignStmtNodeField(node *AssignStmtNode, key string) (err error) {
+	switch key {
+	case "Lhs":
+		node.Lhs, err = decodeList(d, (*Decoder).DecodeExpr)
+	case "TokPos":
+		node.TokPos, err = d.decodePosition()
+	case "Tok":
+		node.Tok, err = d.decodeString()
+	case "Rhs":
+		node.Rhs, err = decodeList(d, (*Decoder).DecodeExpr)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeGoStmtNodeField(node *GoStmtNode, key string) (err error) {
+	switch key {
+	case "Go":
+		node.Go, err = d.decodePosition()
+	case "Call":
+		node.Call, err = decodeNode[CallExprNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeDeferStmtNodeField(node *DeferStmtNode, key string) (err error) {
+	switch key {
+	case "Defer":
+		node.Defer, err = d.decodePosition()
+	case "Call":
+		node.Call, err = decodeNode[CallExprNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeReturnStmtNodeField(node *ReturnStmtNode, key string) (err error) {
+	switch key {
+	case "Return":
+		node.Return, err = d.decodePosition()
+	case "Results":
+		node.Results, err = decodeList(d, (*Decoder).DecodeExpr)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeBranchStmtNodeField(node *BranchStmtNode, key string) (err error) {
+	switch key {
+	case "TokPos":
+		node.TokPos, err = d.decodePosition()
+	case "Tok":
+		node.Tok, err = d.decodeString()
+	case "Label":
+		node.Label, err = decodeNode[IdentNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeBlockStmtNodeField(node *BlockStmtNode, key string) (err error) {
+	switch key {
+	case "Lbrace":
+		node.Lbrace, err = d.decodePosition()
+	case "List":
+		node.List, err = decodeList(d, (*Decoder).DecodeStmt)
+	case "Rbrace":
+		node.Rbrace, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeIfStmtNodeField(node *IfStmtNode, key string) (err error) {
+	switch key {
+	case "If":
+		node.If, err = d.decodePosition()
+	case "Init":
+		node.Init, err = d.DecodeStmt()
+	case "Cond":
+		node.Cond, err = d.DecodeExpr()
+	case "Body":
+		node.Body, err = decodeNode[BlockStmtNode](d)
+	case "Else":
+		node.Else, err = d.DecodeStmt()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeCaseClauseNodeField(node *CaseClauseNode, key string) (err error) {
+	switch key {
+	case "Case":
+		node.Case, err = d.decodePosition()
+	case "List":
+		node.List, err = decodeList(d, (*Decoder).DecodeExpr)
+	case "Colon":
+		node.Colon, err = d.decodePosition()
+	case "Body":
+		node.Body, err = decodeList(d, (*Decoder).DecodeStmt)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeSwitchStmtNodeField(node *SwitchStmtNode, key string) (err error) {
+	switch key {
+	case "Switch":
+		node.Switch, err = d.decodePosition()
+	case "Init":
+		node.Init, err = d.DecodeStmt()
+	case "Tag":
+		node.Tag, err = d.DecodeExpr()
+	case "Body":
+		node.Body, err = decodeNode[BlockStmtNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeTypeSwitchStmtNodeField(node *TypeSwitchStmtNode, key string) (err error) {
+	switch key {
+	case "Switch":
+		node.Switch, err = d.decodePosition()
+	case "Init":
+		node.Init, err = d.DecodeStmt()
+	case "Assign":
+		node.Assign, err = d.DecodeStmt()
+	case "Body":
+		node.Body, err = decodeNode[BlockStmtNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeCommClauseNodeField(node *CommClauseNode, key string) (err error) {
+	switch key {
+	case "Case":
+		node.Case, err = d.decodePosition()
+	case "Comm":
+		node.Comm, err = d.DecodeStmt()
+	case "Colon":
+		node.Colon, err = d.decodePosition()
+	case "Body":
+		node.Body, err = decodeList(d, (*Decoder).DecodeStmt)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeSelectStmtNodeField(node *SelectStmtNode, key string) (err error) {
+	switch key {
+	case "Select":
+		node.Select, err = d.decodePosition()
+	case "Body":
+		node.Body, err = decodeNode[BlockStmtNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeForStmtNodeField(node *ForStmtNode, key string) (err error) {
+	switch key {
+	case "For":
+		node.For, err = d.decodePosition()
+	case "Init":
+		node.Init, err = d.DecodeStmt()
+	case "Cond":
+		node.Cond, err = d.DecodeExpr()
+	case "Post":
+		node.Post, err = d.DecodeStmt()
+	case "Body":
+		node.Body, err = decodeNode[BlockStmtNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeRangeStmtNodeField(node *RangeStmtNode, key string) (err error) {
+	switch key {
+	case "For":
+		node.For, err = d.decodePosition()
+	case "Key":
+		node.Key, err = d.DecodeExpr()
+	case "Value":
+		node.Value, err = d.DecodeExpr()
+	case "TokPos":
+		node.TokPos, err = d.decodePosition()
+	case "Tok":
+		node.Tok, err = d.decodeString()
+	case "X":
+		node.X, err = d.DecodeExpr()
+	case "Body":
+		node.Body, err = decodeNode[BlockStmtNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeImportSpecNodeField(node *ImportSpecNode, key string) (err error) {
+	switch key {
+	case "Doc":
+		node.Doc, err = decodeNode[CommentGroupNode](d)
+	case "Name":
+		node.Name, err = decodeNode[IdentNode](d)
+	case "Path":
+		node.Path, err = decodeNode[BasicLitNode](d)
+	case "Comment":
+		node.Comment, err = decodeNode[CommentGroupNode](d)
+	case "EndPos":
+		node.EndPos, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeValueSpecNodeField(node *ValueSpecNode, key string) (err error) {
+	switch key {
+	case "Doc":
+		node.Doc, err = decodeNode[CommentGroupNode](d)
+	case "Names":
+		node.Names, err = decodeList(d, decodeNode[IdentNode])
+	case "Type":
+		node.Type, err = d.DecodeExpr()
+	case "Values":
+		node.Values, err = decodeList(d, (*Decoder).DecodeExpr)
+	case "Comment":
+		node.Comment, err = decodeNode[CommentGroupNode](d)
+	case "Directives":
+		err = d.dec.Decode(&node.Directives)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeTypeSpecNodeField(node *TypeSpecNode, key string) (err error) {
+	switch key {
+	case "Doc":
+		node.Doc, err = decodeNode[CommentGroupNode](d)
+	case "Name":
+		node.Name, err = decodeNode[IdentNode](d)
+	case "TypeParams":
+		node.TypeParams, err = decodeNode[FieldListNode](d)
+	case "Assign":
+		node.Assign, err = d.decodePosition()
+	case "Type":
+		node.Type, err = d.DecodeExpr()
+	case "Comment":
+		node.Comment, err = decodeNode[CommentGroupNode](d)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeBadDeclNodeField(node *BadDeclNode, key string) (err error) {
+	switch key {
+	case "From":
+		node.From, err = d.decodePosition()
+	case "To":
+		node.To, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeGenDeclNodeField(node *GenDeclNode, key string) (err error) {
+	switch key {
+	case "Doc":
+		node.Doc, err = decodeNode[CommentGroupNode](d)
+	case "TokPos":
+		node.TokPos, err = d.decodePosition()
+	case "Tok":
+		node.Tok, err = d.decodeString()
+	case "Lparen":
+		node.Lparen, err = d.decodePosition()
+	case "Specs":
+		node.Specs, err = decodeList(d, (*Decoder).DecodeSpec)
+	case "Rparen":
+		node.Rparen, err = d.decodePosition()
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeFuncDeclNodeField(node *FuncDeclNode, key string) (err error) {
+	switch key {
+	case "Doc":
+		node.Doc, err = decodeNode[CommentGroupNode](d)
+	case "Recv":
+		node.Recv, err = decodeNode[FieldListNode](d)
+	case "Name":
+		node.Name, err = decodeNode[IdentNode](d)
+	case "Type":
+		node.Type, err = decodeNode[FuncTypeNode](d)
+	case "Body":
+		node.Body, err = decodeNode[BlockStmtNode](d)
+	case "Directives":
+		err = d.dec.Decode(&node.Directives)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodeFileNodeField(node *FileNode, key string) (err error) {
+	switch key {
+	case "Doc":
+		node.Doc, err = decodeNode[CommentGroupNode](d)
+	case "Package":
+		node.Package, err = d.decodePosition()
+	case "Name":
+		node.Name, err = decodeNode[IdentNode](d)
+	case "Decls":
+		node.Decls, err = decodeList(d, (*Decoder).DecodeDecl)
+	case "Imports":
+		node.Imports, err = decodeList(d, decodeNode[ImportSpecNode])
+	case "Unresolved":
+		node.Unresolved, err = decodeList(d, decodeNode[IdentNode])
+	case "Comments":
+		node.Comments, err = decodeList(d, decodeNode[CommentGroupNode])
+	case "FileSet":
+		node.FileSet, err = d.decodeFileSet()
+	case "Positions":
+		err = d.dec.Decode(&node.Positions)
+	case "Directives":
+		err = d.dec.Decode(&node.Directives)
+	case "Errors":
+		err = d.dec.Decode(&node.Errors)
+	default:
+		err = d.skip()
+	}
+	return err
+}
+
+func (d *Decoder) decodePackageNodeField(node *PackageNode, key string) (err error) {
+	switch key {
+	case "Name":
+		node.Name, err = d.decodeString()
+	case "Files":
+		node.Files, err = d.decodeFiles()
+	default:
+		err = d.skip()
+	}
+	return err
+}
@@ -0,0 +1,185 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoderMatchesUnmarshalJSON(t *testing.T) {
+	for _, input := range encoderCorpus(t) {
+		src, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			data, err := encodeDirectly(input, src, benchmarkOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var expected FileNode
+			err = json.Unmarshal(data, &expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := NewDecoder(bytes.NewReader(data)).DecodeFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedData, err := json.Marshal(&expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actualData, err := json.Marshal(actual)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expectedData, actualData) {
+				t.Fatal("decoded trees differ")
+			}
+		})
+	}
+}
+
+func TestDecoderFieldOrder(t *testing.T) {
+	data := `{"X": {"Name": "a", "NodeType": "Ident"}, "Op": "+", "NodeType": "BinaryExpr", "RefId": 3,
+		"Y": {"NodeType": "BasicLit", "Kind": "INT", "Value": "1", "Unknown": [1, {"a": null}]}}`
+	expr, err := NewDecoder(strings.NewReader(data)).DecodeExpr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, ok := expr.(*BinaryExprNode)
+	if !ok {
+		t.Fatalf("expected *BinaryExprNode, got %T", expr)
+	}
+	if binary.RefId != 3 || binary.Op != "+" {
+		t.Errorf("unexpected header %+v", binary.Node)
+	}
+	if ident, ok := binary.X.(*IdentNode); !ok || ident.Name != "a" {
+		t.Errorf("unexpected X %#v", binary.X)
+	}
+	if lit, ok := binary.Y.(*BasicLitNode); !ok || lit.Value != "1" {
+		t.Errorf("unexpected Y %#v", binary.Y)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	inputs := []string{
+		``,
+		`[]`,
+		`{"NodeType": "File", "Name": 1}`,
+		`{"NodeType": "File", "Decls": {}}`,
+		`{"NodeType": "File", "Package": {"NodeType": "Position", "Line": "1"}}`,
+		`{"NodeType": "File", "Decls": [`,
+	}
+	for _, input := range inputs {
+		_, err := NewDecoder(strings.NewReader(input)).DecodeFile()
+		if err == nil {
+			t.Errorf("%q: error expected", input)
+		}
+	}
+
+	// Unknown node types are errors at any depth, not panics.
+	unknown := map[string]func(*Decoder) error{
+		`{"NodeType":"BinaryExpr","X":{"NodeType":"Nope"}}`: func(d *Decoder) error {
+			_, err := d.DecodeExpr()
+			return err
+		},
+		`{"NodeType":"ExprStmt","X":{"NodeType":"IfStmt"}}`: func(d *Decoder) error {
+			_, err := d.DecodeStmt()
+			return err
+		},
+		`{"NodeType":"BlockStmt","List":[{"NodeType":"Nope"}]}`: func(d *Decoder) error {
+			_, err := d.DecodeStmt()
+			return err
+		},
+		`{"NodeType":"GenDecl","Specs":[{"NodeType":"Nope"}]}`: func(d *Decoder) error {
+			_, err := d.DecodeDecl()
+			return err
+		},
+		`{"NodeType":"File","Decls":[{"NodeType":"Nope"}]}`: func(d *Decoder) error {
+			_, err := d.DecodeFile()
+			return err
+		},
+		`{"NodeType":"Nope"}`: func(d *Decoder) error {
+			_, err := d.DecodeSpec()
+			return err
+		},
+	}
+	for input, decode := range unknown {
+		err := decode(NewDecoder(strings.NewReader(input)))
+		if err == nil || !strings.Contains(err.Error(), "unsupported NodeType") {
+			t.Errorf("%s: unsupported NodeType error expected, got %v", input, err)
+		}
+	}
+}
+
+func nestedExprJSON(tb testing.TB, depth int) []byte {
+	src := "package p\n\nvar x = " + strings.Repeat("(", depth) + "1" + strings.Repeat(")", depth) + "\n"
+	data, err := encodeDirectly("nested.go", []byte(src), benchmarkOptions)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+var nestingDepths = []int{16, 64, 256, 1024}
+
+func BenchmarkUnmarshalJSONNested(b *testing.B) {
+	for _, depth := range nestingDepths {
+		data := nestedExprJSON(b, depth)
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var node FileNode
+				err := json.Unmarshal(data, &node)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecoderNested(b *testing.B) {
+	for _, depth := range nestingDepths {
+		data := nestedExprJSON(b, depth)
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := NewDecoder(bytes.NewReader(data)).DecodeFile()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMakeNode(t *testing.T) {
+	for nodeType, expected := range map[string]INode{
+		"File":      &FileNode{},
+		"Ident":     &IdentNode{},
+		"IfStmt":    &IfStmtNode{},
+		"ValueSpec": &ValueSpecNode{},
+		"FuncDecl":  &FuncDeclNode{},
+	} {
+		if node := MakeNode(nodeType); !reflect.DeepEqual(node, expected) {
+			t.Errorf("%s: expected %T, got %T", nodeType, expected, node)
+		}
+	}
+	for _, nodeType := range []string{"", "Nope", "Field", "CommentGroup", "Package"} {
+		if node := MakeNode(nodeType); node != nil {
+			t.Errorf("%s: nil expected, got %T", nodeType, node)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package asty
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/build/constraint"
+	"go/token"
+	"strings"
+)
+
+// Directive is a comment directive like //go:build, //go:embed, //line or
+// //nolint, listed by the node it belongs to when Options.WithDirectives is
+// set. Name is the part before the arguments, "go:build" or "nolint" for
+// instance, and Constraint the parsed expression of build constraints.
+type Directive struct {
+	Name       string      `json:"Name"`
+	Args       string      `json:"Args,omitempty"`
+	Line       int         `json:"Line"`
+	Column     int         `json:"Column"`
+	Constraint *Constraint `json:"Constraint,omitempty"`
+}
+
+// Constraint is a node of a build constraint expression. Op is one of "&&",
+// "||", "!" with operands X and Y, or "tag" for a single Tag.
+type Constraint struct {
+	Op  string      `json:"Op"`
+	Tag string      `json:"Tag,omitempty"`
+	X   *Constraint `json:"X,omitempty"`
+	Y   *Constraint `json:"Y,omitempty"`
+}
+
+func makeConstraint(expr constraint.Expr) *Constraint {
+	switch e := expr.(type) {
+	case *constraint.AndExpr:
+		return &Constraint{Op: "&&", X: makeConstraint(e.X), Y: makeConstraint(e.Y)}
+	case *constraint.OrExpr:
+		return &Constraint{Op: "||", X: makeConstraint(e.X), Y: makeConstraint(e.Y)}
+	case *constraint.NotExpr:
+		return &Constraint{Op: "!", X: makeConstraint(e.X)}
+	case *constraint.TagExpr:
+		return &Constraint{Op: "tag", Tag: e.Tag}
+	default:
+		panic("implement me")
+	}
+}
+
+// parseDirective parses a single comment, returning nil if it is not a
+// directive. Directives follow the //tool:name form go/ast recognizes, along
+// with //line, //export, //extern, //nolint and // +build lines.
+func parseDirective(text string) *Directive {
+	if !strings.HasPrefix(text, "//") {
+		return nil
+	}
+	if constraint.IsPlusBuild(text) {
+		result := &Directive{Name: "+build", Args: strings.TrimSpace(strings.TrimPrefix(text, "// +build"))}
+		if expr, err := constraint.Parse(text); err == nil {
+			result.Constraint = makeConstraint(expr)
+		}
+		return result
+	}
+
+	body := text[2:]
+	name, args, _ := strings.Cut(body, " ")
+	switch {
+	case name == "line" || name == "export" || name == "extern":
+	case name == "nolint" || strings.HasPrefix(name, "nolint:"):
+		// Linters follow the colon, anything after them is an explanation.
+		name, args = "nolint", strings.TrimPrefix(strings.TrimPrefix(name, "nolint"), ":")
+	case isToolDirective(name):
+	default:
+		return nil
+	}
+	result := &Directive{Name: name, Args: strings.TrimSpace(args)}
+	if constraint.IsGoBuild(text) {
+		if expr, err := constraint.Parse(text); err == nil {
+			result.Constraint = makeConstraint(expr)
+		}
+	}
+	return result
+}
+
+// isToolDirective reports whether name looks like tool:name, lower case
+// letters and digits on both sides of the colon.
+func isToolDirective(name string) bool {
+	tool, directive, ok := strings.Cut(name, ":")
+	if !ok || tool == "" || directive == "" {
+		return false
+	}
+	for _, c := range tool + directive {
+		if !('a' <= c && c <= 'z' || '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// groupDirectives returns the directives of comment groups.
+func groupDirectives(fset *token.FileSet, groups ...*ast.CommentGroup) []*Directive {
+	var result []*Directive
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		for _, comment := range group.List {
+			directive := parseDirective(comment.Text)
+			if directive == nil {
+				continue
+			}
+			position := fset.PositionFor(comment.Slash, false)
+			directive.Line, directive.Column = position.Line, position.Column
+			result = append(result, directive)
+		}
+	}
+	return result
+}
+
+// specDirectiveDoc returns the doc comment of a declaration that belongs to
+// its only spec, which is the case for declarations without parentheses.
+func specDirectiveDoc(decl *ast.GenDecl) *ast.CommentGroup {
+	if decl.Lparen.IsValid() || decl.Tok == token.IMPORT || decl.Tok == token.TYPE {
+		return nil
+	}
+	return decl.Doc
+}
+
+// fileDirectives returns the directives of a file that belong to none of its
+// function declarations and value specs, local ones included.
+func fileDirectives(fset *token.FileSet, file *ast.File) []*Directive {
+	owned := make(map[*ast.CommentGroup]bool)
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FuncDecl:
+			owned[n.Doc] = true
+		case *ast.GenDecl:
+			owned[specDirectiveDoc(n)] = true
+		case *ast.ValueSpec:
+			owned[n.Doc] = true
+			owned[n.Comment] = true
+		}
+		return true
+	})
+	var groups []*ast.CommentGroup
+	for _, group := range file.Comments {
+		if !owned[group] {
+			groups = append(groups, group)
+		}
+	}
+	return groupDirectives(fset, groups...)
+}
+
+func (m *Marshaller) marshalDirectives(groups ...*ast.CommentGroup) []*Directive {
+	if !m.WithDirectives {
+		return nil
+	}
+	return groupDirectives(m.fset, groups...)
+}
+
+func (m *Marshaller) marshalFileDirectives(file *ast.File) []*Directive {
+	if !m.WithDirectives {
+		return nil
+	}
+	return fileDirectives(m.fset, file)
+}
+
+func (e *Encoder) directivesField(directives []*Directive) {
+	if len(directives) == 0 {
+		return
+	}
+	e.key("Directives")
+	// Directives are plain structs, which encoding/json does not fail on.
+	data, _ := json.Marshal(directives)
+	e.buf = append(e.buf, data...)
+}
@@ -0,0 +1,127 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const directivesSource = `//go:build linux && (amd64 || !cgo)
+// +build linux
+
+//go:generate stringer -type=Kind
+package main
+
+import _ "embed"
+
+//go:embed hello.txt
+var hello string
+
+var (
+	//go:embed a.txt
+	a string
+	b = 1 //nolint:gochecknoglobals // config
+)
+
+// f is not a directive.
+//
+//go:noinline
+//go:linkname f runtime.f
+func f() {
+	//go:embed ignored.txt
+	var c string
+	_ = c
+}
+`
+
+func TestParseDirective(t *testing.T) {
+	cases := map[string]*Directive{
+		"//go:embed a.txt b.txt":  {Name: "go:embed", Args: "a.txt b.txt"},
+		"//go:noinline":           {Name: "go:noinline"},
+		"//nolint":                {Name: "nolint"},
+		"//nolint:errcheck,gosec": {Name: "nolint", Args: "errcheck,gosec"},
+		"//line a.go:10":          {Name: "line", Args: "a.go:10"},
+		"//export F":              {Name: "export", Args: "F"},
+		"//lint:ignore U1000 old": {Name: "lint:ignore", Args: "U1000 old"},
+		"//go:build !windows": {Name: "go:build", Args: "!windows",
+			Constraint: &Constraint{Op: "!", X: &Constraint{Op: "tag", Tag: "windows"}}},
+		"// go:embed a.txt":  nil,
+		"//Go:embed a.txt":   nil,
+		"// TODO: fix":       nil,
+		"/*go:embed a.txt*/": nil,
+	}
+	for text, expected := range cases {
+		directive := parseDirective(text)
+		if !reflect.DeepEqual(directive, expected) {
+			t.Errorf("%s: expected %+v, got %+v", text, expected, directive)
+		}
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	for _, options := range []Options{
+		{WithDirectives: true},
+		{WithDirectives: true, WithComments: true, WithPositions: true, WithReferences: true},
+	} {
+		marshalled, err := marshalWithReflection("directives.go", []byte(directivesSource), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := encodeDirectly("directives.go", []byte(directivesSource), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(marshalled, encoded) {
+			t.Fatalf("encoder output differs from marshaller output\nexpected: %s\nactual:   %s", marshalled, encoded)
+		}
+		if !options.WithComments && bytes.Contains(encoded, []byte(`"CommentGroup"`)) {
+			t.Error("comments are not expected without WithComments")
+		}
+
+		file, err := NewDecoder(bytes.NewReader(encoded)).DecodeFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		unmarshalled := &FileNode{}
+		err = json.Unmarshal(encoded, unmarshalled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range []*FileNode{file, unmarshalled} {
+			names := func(directives []*Directive) []string {
+				var result []string
+				for _, directive := range directives {
+					result = append(result, directive.Name)
+				}
+				return result
+			}
+			specs := node.Decls[2].(*GenDeclNode).Specs
+			fn := node.Decls[3].(*FuncDeclNode)
+			actual := [][]string{
+				names(node.Directives),
+				names(node.Decls[1].(*GenDeclNode).Specs[0].(*ValueSpecNode).Directives),
+				names(specs[0].(*ValueSpecNode).Directives),
+				names(specs[1].(*ValueSpecNode).Directives),
+				names(fn.Directives),
+				names(fn.Body.List[0].(*DeclStmtNode).Decl.(*GenDeclNode).Specs[0].(*ValueSpecNode).Directives),
+			}
+			expected := [][]string{
+				{"go:build", "+build", "go:generate"},
+				{"go:embed"},
+				{"go:embed"},
+				{"nolint"},
+				{"go:noinline", "go:linkname"},
+				{"go:embed"},
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				t.Errorf("expected directives %v, got %v", expected, actual)
+			}
+			build := node.Directives[0]
+			if build.Line != 1 || build.Constraint == nil || build.Constraint.Op != "&&" ||
+				build.Constraint.Y.Op != "||" || build.Constraint.Y.Y.X.Tag != "cgo" {
+				t.Errorf("unexpected build constraint %+v", build)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package asty
+
+import (
+	"go/ast"
+	"go/doc/comment"
+	"strconv"
+)
+
+// DocComment is a doc comment parsed by go/doc/comment. It is attached to the
+// comment groups found in Doc fields when Options.WithDocs is set.
+type DocComment struct {
+	Blocks []*DocBlock   `json:"Blocks"`
+	Links  []*DocLinkDef `json:"Links,omitempty"`
+}
+
+// DocBlock is a block of a doc comment. Kind is Paragraph or Heading, which
+// have Text, Code, which has Code, or List, which has Items. ID is the anchor
+// of a heading.
+type DocBlock struct {
+	Kind  string         `json:"Kind"`
+	ID    string         `json:"ID,omitempty"`
+	Text  []*DocText     `json:"Text,omitempty"`
+	Code  string         `json:"Code,omitempty"`
+	Items []*DocListItem `json:"Items,omitempty"`
+}
+
+// DocListItem is an item of a list, Number is empty in bullet lists.
+type DocListItem struct {
+	Number  string      `json:"Number,omitempty"`
+	Content []*DocBlock `json:"Content"`
+}
+
+// DocText is a span of text. Kind is Plain or Italic, which have Text, Link,
+// which has URL, or DocLink, which has ImportPath, Recv and Name. The text of
+// links is in Content.
+type DocText struct {
+	Kind       string     `json:"Kind"`
+	Text       string     `json:"Text,omitempty"`
+	URL        string     `json:"URL,omitempty"`
+	Auto       bool       `json:"Auto,omitempty"`
+	ImportPath string     `json:"ImportPath,omitempty"`
+	Recv       string     `json:"Recv,omitempty"`
+	Name       string     `json:"Name,omitempty"`
+	Content    []*DocText `json:"Content,omitempty"`
+}
+
+// DocLinkDef is a link definition, "[Text]: URL", of a doc comment.
+type DocLinkDef struct {
+	Text string `json:"Text"`
+	URL  string `json:"URL"`
+	Used bool   `json:"Used,omitempty"`
+}
+
+// newDocParser returns a parser resolving doc links to the top level
+// declarations and imports of file. Without a file only standard library
+// packages are linked.
+func newDocParser(file *ast.File) *comment.Parser {
+	parser := &comment.Parser{}
+	if file == nil {
+		return parser
+	}
+	symbols := make(map[[2]string]bool)
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			symbols[[2]string{receiverName(d.Recv), d.Name.Name}] = true
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					symbols[[2]string{"", s.Name.Name}] = true
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						symbols[[2]string{"", name.Name}] = true
+					}
+				}
+			}
+		}
+	}
+	packages := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := importPathName(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		packages[name] = path
+	}
+	parser.LookupSym = func(recv, name string) bool {
+		return symbols[[2]string{recv, name}]
+	}
+	parser.LookupPackage = func(name string) (string, bool) {
+		path, ok := packages[name]
+		return path, ok
+	}
+	return parser
+}
+
+// receiverName returns the name of the receiver type of a method, without
+// pointers and type parameters, or an empty string for functions.
+func receiverName(recv *ast.FieldList) string {
+	if recv == nil || len(recv.List) == 0 {
+		return ""
+	}
+	expr := recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+func parseDoc(parser *comment.Parser, group *ast.CommentGroup) *DocComment {
+	if parser == nil {
+		parser = &comment.Parser{}
+	}
+	doc := parser.Parse(group.Text())
+	result := &DocComment{Blocks: makeDocBlocks(doc.Content)}
+	for _, link := range doc.Links {
+		result.Links = append(result.Links, &DocLinkDef{Text: link.Text, URL: link.URL, Used: link.Used})
+	}
+	return result
+}
+
+func makeDocBlocks(blocks []comment.Block) []*DocBlock {
+	result := make([]*DocBlock, 0, len(blocks))
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case *comment.Paragraph:
+			result = append(result, &DocBlock{Kind: "Paragraph", Text: makeDocTexts(b.Text)})
+		case *comment.Heading:
+			result = append(result, &DocBlock{Kind: "Heading", ID: b.DefaultID(), Text: makeDocTexts(b.Text)})
+		case *comment.Code:
+			result = append(result, &DocBlock{Kind: "Code", Code: b.Text})
+		case *comment.List:
+			list := &DocBlock{Kind: "List", Items: make([]*DocListItem, len(b.Items))}
+			for index, item := range b.Items {
+				list.Items[index] = &DocListItem{Number: item.Number, Content: makeDocBlocks(item.Content)}
+			}
+			result = append(result, list)
+		default:
+			panic("implement me")
+		}
+	}
+	return result
+}
+
+func makeDocTexts(texts []comment.Text) []*DocText {
+	result := make([]*DocText, 0, len(texts))
+	for _, text := range texts {
+		switch t := text.(type) {
+		case comment.Plain:
+			result = append(result, &DocText{Kind: "Plain", Text: string(t)})
+		case comment.Italic:
+			result = append(result, &DocText{Kind: "Italic", Text: string(t)})
+		case *comment.Link:
+			result = append(result, &DocText{Kind: "Link", URL: t.URL, Auto: t.Auto, Content: makeDocTexts(t.Text)})
+		case *comment.DocLink:
+			result = append(result, &DocText{
+				Kind:       "DocLink",
+				ImportPath: t.ImportPath,
+				Recv:       t.Recv,
+				Name:       t.Name,
+				Content:    makeDocTexts(t.Text),
+			})
+		default:
+			panic("implement me")
+		}
+	}
+	return result
+}
@@ -0,0 +1,122 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const docsSource = `// Package p does things.
+//
+// # Usage
+//
+// Call [F] or [T.M], see [strings.Cut] and [the spec].
+//
+//	x := p.F()
+//
+// Steps:
+//  1. one
+//  2. two
+//
+// [the spec]: https://go.dev/ref/spec
+package p
+
+import "strings"
+
+var _ = strings.Cut
+
+// F returns _nothing_, unlike [G].
+func F() {}
+
+type T struct {
+	// X is a field.
+	X int
+}
+
+// M is a method.
+func (*T) M() {
+	// Not a doc comment.
+}
+`
+
+func TestDocs(t *testing.T) {
+	for _, options := range []Options{
+		{WithComments: true, WithDocs: true},
+		{WithComments: true, WithDocs: true, WithPositions: true, WithReferences: true},
+	} {
+		marshalled, err := marshalWithReflection("docs.go", []byte(docsSource), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := encodeDirectly("docs.go", []byte(docsSource), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(marshalled, encoded) {
+			t.Fatalf("encoder output differs from marshaller output\nexpected: %s\nactual:   %s", marshalled, encoded)
+		}
+
+		file, err := NewDecoder(bytes.NewReader(encoded)).DecodeFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		unmarshalled := &FileNode{}
+		err = json.Unmarshal(encoded, unmarshalled)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, node := range []*FileNode{file, unmarshalled} {
+			doc := node.Doc.Parsed
+			var kinds []string
+			for _, block := range doc.Blocks {
+				kinds = append(kinds, block.Kind)
+			}
+			if !reflect.DeepEqual(kinds, []string{"Paragraph", "Heading", "Paragraph", "Code", "Paragraph", "List"}) {
+				t.Errorf("unexpected blocks %v", kinds)
+			}
+			if doc.Blocks[1].ID != "hdr-Usage" || doc.Blocks[3].Code != "x := p.F()\n" ||
+				len(doc.Blocks[5].Items) != 2 || doc.Blocks[5].Items[1].Number != "2" {
+				t.Errorf("unexpected blocks %+v", doc.Blocks)
+			}
+			if len(doc.Links) != 1 || !doc.Links[0].Used {
+				t.Errorf("used link definition expected, got %+v", doc.Links)
+			}
+
+			var links []DocText
+			for _, text := range doc.Blocks[2].Text {
+				if text.Kind == "DocLink" || text.Kind == "Link" {
+					links = append(links, DocText{Kind: text.Kind, ImportPath: text.ImportPath,
+						Recv: text.Recv, Name: text.Name, URL: text.URL})
+				}
+			}
+			expected := []DocText{
+				{Kind: "DocLink", Name: "F"},
+				{Kind: "DocLink", Recv: "T", Name: "M"},
+				{Kind: "DocLink", ImportPath: "strings", Name: "Cut"},
+				{Kind: "Link", URL: "https://go.dev/ref/spec"},
+			}
+			if !reflect.DeepEqual(links, expected) {
+				t.Errorf("expected links %+v, got %+v", expected, links)
+			}
+
+			// Unknown symbols are not linked.
+			texts := node.Decls[2].(*FuncDeclNode).Doc.Parsed.Blocks[0].Text
+			if len(texts) != 1 || texts[0].Kind != "Plain" {
+				t.Errorf("plain text expected, got %+v", texts)
+			}
+			field := node.Decls[3].(*GenDeclNode).Specs[0].(*TypeSpecNode).Type.(*StructTypeNode).Fields.List[0]
+			if field.Doc.Parsed == nil || field.Doc.Parsed.Blocks[0].Text[0].Text != "X is a field." {
+				t.Errorf("parsed field doc expected, got %+v", field.Doc.Parsed)
+			}
+			if options.WithReferences {
+				continue
+			}
+			for _, group := range node.Comments {
+				if group.Parsed != nil {
+					t.Errorf("comments of the file are not expected to be parsed")
+				}
+			}
+		}
+	}
+}
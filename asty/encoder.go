@@ -0,0 +1,1382 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/doc/comment"
+	"go/token"
+	"io"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Encoder writes JSON directly while walking go/ast nodes. It produces the same
+// document as encoding the result of Marshaller with encoding/json, but skips
+// the intermediate node structs and reflection.
+type Encoder struct {
+	Options
+	fset       *token.FileSet
+	buf        []byte
+	start      int
+	references map[any]encodedSpan
+	refcount   int
+	positions  positionTable
+	src        []byte
+	specDoc    *ast.CommentGroup
+	docParser  *comment.Parser
+	err        error
+}
+
+type encodedSpan struct {
+	start int
+	end   int
+}
+
+func NewEncoder(options Options) *Encoder {
+	return &Encoder{
+		Options:    options,
+		fset:       token.NewFileSet(),
+		references: make(map[any]encodedSpan),
+		refcount:   0,
+	}
+}
+
+func (e *Encoder) FileSet() *token.FileSet {
+	return e.fset
+}
+
+// SetSource sets the source of the file being encoded, which is needed to
+// attach source text to nodes selected by WithSource.
+func (e *Encoder) SetSource(src []byte) {
+	e.src = src
+}
+
+// Reset prepares the Encoder for another file. The file set is replaced as
+// well, so the file is to be parsed into FileSet after Reset, and the source
+// set again.
+func (e *Encoder) Reset() {
+	e.buf = e.buf[:0]
+	e.start = 0
+	e.refcount = 0
+	for key := range e.references {
+		delete(e.references, key)
+	}
+	e.fset = token.NewFileSet()
+	e.positions.reset()
+	e.src = nil
+	e.specDoc = nil
+	e.docParser = nil
+	e.err = nil
+}
+
+func (e *Encoder) Bytes() []byte {
+	return e.buf[e.start:]
+}
+
+func (e *Encoder) Flush(w io.Writer, indent string) error {
+	data := e.Bytes()
+	if indent != "" {
+		var indented bytes.Buffer
+		indented.Grow(len(data) * 2)
+		err := json.Indent(&indented, data, "", indent)
+		if err != nil {
+			return err
+		}
+		data = indented.Bytes()
+	}
+	_, err := w.Write(data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte{'\n'})
+	return err
+}
+
+func wrapEncode[T any](e *Encoder, node *T, encode func()) {
+	if node == nil {
+		e.null()
+		return
+	}
+
+	if !e.WithReferences {
+		encode()
+		return
+	}
+
+	if span, ok := e.references[node]; ok {
+		e.buf = append(e.buf, e.buf[span.start:span.end]...)
+		return
+	}
+	start := len(e.buf)
+	encode()
+	e.references[node] = encodedSpan{start: start, end: len(e.buf)}
+}
+
+// ---------------------------------------------------------------------------
+
+func (e *Encoder) null() {
+	e.buf = append(e.buf, "null"...)
+}
+
+func (e *Encoder) key(name string) {
+	e.buf = append(e.buf, ',', '"')
+	e.buf = append(e.buf, name...)
+	e.buf = append(e.buf, '"', ':')
+}
+
+func (e *Encoder) appendString(s string) {
+	e.buf = appendJSONString(e.buf, s)
+}
+
+func (e *Encoder) appendInt(v int) {
+	e.buf = strconv.AppendInt(e.buf, int64(v), 10)
+}
+
+func (e *Encoder) appendBool(v bool) {
+	e.buf = strconv.AppendBool(e.buf, v)
+}
+
+func (e *Encoder) stringField(name, value string) {
+	e.key(name)
+	e.appendString(value)
+}
+
+func (e *Encoder) intField(name string, value int) {
+	e.key(name)
+	e.appendInt(value)
+}
+
+func (e *Encoder) boolField(name string, value bool) {
+	e.key(name)
+	e.appendBool(value)
+}
+
+func (e *Encoder) EncodeNode(nodeType string, node ast.Node) {
+	e.buf = append(e.buf, `{"NodeType":`...)
+	e.appendString(nodeType)
+	if e.WithReferences {
+		e.refcount++
+		e.intField("RefId", e.refcount)
+	}
+	if e.WithSpans && node != nil {
+		e.spanField("Pos", node.Pos())
+		e.spanField("End", node.End())
+	}
+	if e.WithSource != "" {
+		if source := nodeSource(e.fset, e.src, e.WithSource, node); source != "" {
+			e.stringField("Source", source)
+		}
+	}
+}
+
+func (e *Encoder) end() {
+	e.buf = append(e.buf, '}')
+}
+
+func (e *Encoder) EncodePosition(pos token.Pos) {
+	if !e.WithPositions || pos == token.NoPos {
+		e.null()
+		return
+	}
+	e.encodePosition(pos)
+}
+
+func (e *Encoder) encodePosition(pos token.Pos) {
+	position := e.fset.PositionFor(pos, false)
+	switch e.PositionFormat {
+	case PositionOffset:
+		e.appendInt(position.Offset)
+	case PositionCompact:
+		e.appendString(compactPosition(position.Line, position.Column))
+	case PositionTable:
+		e.appendInt(e.positions.index(pos, position))
+	default:
+		e.EncodeNode("Position", nil)
+		e.stringField("Filename", position.Filename)
+		e.intField("Offset", position.Offset)
+		e.intField("Line", position.Line)
+		e.intField("Column", position.Column)
+		e.end()
+		return
+	}
+	// Positions without objects keep counting references, so other nodes get
+	// the same RefId in every format.
+	if e.WithReferences {
+		e.refcount++
+	}
+}
+
+func (e *Encoder) positionField(name string, pos token.Pos) {
+	if !e.WithPositions || pos == token.NoPos {
+		return
+	}
+	e.key(name)
+	e.EncodePosition(pos)
+}
+
+// spanField encodes positions of spans, which do not depend on WithPositions.
+func (e *Encoder) spanField(name string, pos token.Pos) {
+	if pos == token.NoPos {
+		return
+	}
+	e.key(name)
+	e.encodePosition(pos)
+}
+
+func (e *Encoder) EncodeComment(comment *ast.Comment) {
+	wrapEncode(e, comment, func() {
+		e.EncodeNode("Comment", comment)
+		e.positionField("Slash", comment.Slash)
+		e.stringField("Text", comment.Text)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeComments(comments []*ast.Comment) {
+	if comments == nil {
+		e.null()
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for index, comment := range comments {
+		if index > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.EncodeComment(comment)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+func (e *Encoder) EncodeCommentGroup(group *ast.CommentGroup) {
+	e.encodeCommentGroup(group, false)
+}
+
+// encodeCommentGroup encodes a comment group, parsing it as a doc comment
+// when it is one and WithDocs is set.
+func (e *Encoder) encodeCommentGroup(group *ast.CommentGroup, doc bool) {
+	if !e.WithComments {
+		e.null()
+		return
+	}
+	wrapEncode(e, group, func() {
+		e.EncodeNode("CommentGroup", group)
+		if len(group.List) > 0 {
+			e.key("List")
+			e.EncodeComments(group.List)
+		}
+		if doc && e.WithDocs {
+			e.key("Parsed")
+			data, err := json.Marshal(parseDoc(e.docParser, group))
+			if err != nil {
+				// Reported by EncodePartialFile or EncodeFragment, the
+				// encoders of nodes do not return errors.
+				if e.err == nil {
+					e.err = err
+				}
+				e.null()
+			} else {
+				e.buf = append(e.buf, data...)
+			}
+		}
+		e.end()
+	})
+}
+
+func (e *Encoder) commentGroupField(name string, group *ast.CommentGroup) {
+	if !e.WithComments || group == nil {
+		return
+	}
+	e.key(name)
+	e.EncodeCommentGroup(group)
+}
+
+func (e *Encoder) docGroupField(group *ast.CommentGroup) {
+	if !e.WithComments || group == nil {
+		return
+	}
+	e.key("Doc")
+	e.encodeCommentGroup(group, true)
+}
+
+func (e *Encoder) EncodeCommentGroups(groups []*ast.CommentGroup) {
+	if groups == nil {
+		e.null()
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for index, group := range groups {
+		if index > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.EncodeCommentGroup(group)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+// ---------------------------------------------------------------------------
+
+func (e *Encoder) EncodeField(node *ast.Field) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("Field", node)
+		e.docGroupField(node.Doc)
+		e.key("Names")
+		e.EncodeIdents(node.Names)
+		e.key("Type")
+		e.EncodeExpr(node.Type)
+		if node.Tag != nil {
+			e.key("Tag")
+			e.EncodeBasicLit(node.Tag)
+		}
+		e.commentGroupField("Comment", node.Comment)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeFields(fields []*ast.Field) {
+	if fields == nil {
+		e.null()
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for index, field := range fields {
+		if index > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.EncodeField(field)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+func (e *Encoder) EncodeFieldList(node *ast.FieldList) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("FieldList", node)
+		e.positionField("Opening", node.Opening)
+		e.key("List")
+		e.EncodeFields(node.List)
+		e.positionField("Closing", node.Closing)
+		e.end()
+	})
+}
+
+// ---------------------------------------------------------------------------
+
+func (e *Encoder) EncodeBadExpr(node *ast.BadExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("BadExpr", node)
+		e.positionField("From", node.From)
+		e.positionField("To", node.To)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeIdent(node *ast.Ident) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("Ident", node)
+		e.positionField("NamePos", node.NamePos)
+		e.stringField("Name", node.Name)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeIdents(idents []*ast.Ident) {
+	if idents == nil {
+		e.null()
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for index, ident := range idents {
+		if index > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.EncodeIdent(ident)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+func (e *Encoder) EncodeEllipsis(node *ast.Ellipsis) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("Ellipsis", node)
+		e.positionField("Ellipsis", node.Ellipsis)
+		e.key("Elt")
+		e.EncodeExpr(node.Elt)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeBasicLit(node *ast.BasicLit) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("BasicLit", node)
+		e.positionField("ValuePos", node.ValuePos)
+		e.stringField("Kind", node.Kind.String())
+		e.stringField("Value", node.Value)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeFuncLit(node *ast.FuncLit) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("FuncLit", node)
+		e.key("Type")
+		e.EncodeFuncType(node.Type)
+		e.key("Body")
+		e.EncodeBlockStmt(node.Body)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeCompositeLit(node *ast.CompositeLit) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("CompositeLit", node)
+		e.key("Type")
+		e.EncodeExpr(node.Type)
+		e.positionField("Lbrace", node.Lbrace)
+		e.key("Elts")
+		e.EncodeExprs(node.Elts)
+		e.positionField("Rbrace", node.Rbrace)
+		e.boolField("Incomplete", node.Incomplete)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeParenExpr(node *ast.ParenExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("ParenExpr", node)
+		e.positionField("Lparen", node.Lparen)
+		e.key("X")
+		e.EncodeExpr(node.X)
+		e.positionField("Rparen", node.Rparen)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeSelectorExpr(node *ast.SelectorExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("SelectorExpr", node)
+		if node.X != nil {
+			e.key("X")
+			e.EncodeExpr(node.X)
+		}
+		if node.Sel != nil {
+			e.key("Sel")
+			e.EncodeIdent(node.Sel)
+		}
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeIndexExpr(node *ast.IndexExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("IndexExpr", node)
+		e.key("X")
+		e.EncodeExpr(node.X)
+		e.positionField("Lbrack", node.Lbrack)
+		e.key("Index")
+		e.EncodeExpr(node.Index)
+		e.positionField("Rbrack", node.Rbrack)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeIndexListExpr(node *ast.IndexListExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("IndexListExpr", node)
+		e.key("X")
+		e.EncodeExpr(node.X)
+		e.positionField("Lbrack", node.Lbrack)
+		e.key("Indices")
+		e.EncodeExprs(node.Indices)
+		e.positionField("Rbrack", node.Rbrack)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeSliceExpr(node *ast.SliceExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("SliceExpr", node)
+		e.key("X")
+		e.EncodeExpr(node.X)
+		e.positionField("Lbrack", node.Lbrack)
+		e.key("Low")
+		e.EncodeExpr(node.Low)
+		e.key("High")
+		e.EncodeExpr(node.High)
+		e.key("Max")
+		e.EncodeExpr(node.Max)
+		e.boolField("Slice3", node.Slice3)
+		e.positionField("Rbrack", node.Rbrack)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeTypeAssertExpr(node *ast.TypeAssertExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("TypeAssertExpr", node)
+		e.key("X")
+		e.EncodeExpr(node.X)
+		e.positionField("Lparen", node.Lparen)
+		e.key("Type")
+		e.EncodeExpr(node.Type)
+		e.positionField("Rparen", node.Rparen)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeCallExpr(node *ast.CallExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("CallExpr", node)
+		e.key("Fun")
+		e.EncodeExpr(node.Fun)
+		e.positionField("Lparen", node.Lparen)
+		e.key("Args")
+		e.EncodeExprs(node.Args)
+		e.positionField("Ellipsis", node.Ellipsis)
+		e.positionField("Rparen", node.Rparen)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeStarExpr(node *ast.StarExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("StarExpr", node)
+		e.positionField("Star", node.Star)
+		e.key("X")
+		e.EncodeExpr(node.X)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeUnaryExpr(node *ast.UnaryExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("UnaryExpr", node)
+		e.positionField("OpPos", node.OpPos)
+		e.stringField("Op", node.Op.String())
+		e.key("X")
+		e.EncodeExpr(node.X)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeBinaryExpr(node *ast.BinaryExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("BinaryExpr", node)
+		e.key("X")
+		e.EncodeExpr(node.X)
+		e.positionField("OpPos", node.OpPos)
+		e.stringField("Op", node.Op.String())
+		e.key("Y")
+		e.EncodeExpr(node.Y)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeKeyValueExpr(node *ast.KeyValueExpr) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("KeyValueExpr", node)
+		e.key("Key")
+		e.EncodeExpr(node.Key)
+		e.positionField("Colon", node.Colon)
+		e.key("Value")
+		e.EncodeExpr(node.Value)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeExpr(node ast.Expr) {
+	if node == nil {
+		e.null()
+		return
+	}
+	switch expr := node.(type) {
+	case *ast.BadExpr:
+		e.EncodeBadExpr(expr)
+	case *ast.Ident:
+		e.EncodeIdent(expr)
+	case *ast.Ellipsis:
+		e.EncodeEllipsis(expr)
+	case *ast.BasicLit:
+		e.EncodeBasicLit(expr)
+	case *ast.FuncLit:
+		e.EncodeFuncLit(expr)
+	case *ast.CompositeLit:
+		e.EncodeCompositeLit(expr)
+	case *ast.ParenExpr:
+		e.EncodeParenExpr(expr)
+	case *ast.SelectorExpr:
+		e.EncodeSelectorExpr(expr)
+	case *ast.IndexExpr:
+		e.EncodeIndexExpr(expr)
+	case *ast.IndexListExpr:
+		e.EncodeIndexListExpr(expr)
+	case *ast.SliceExpr:
+		e.EncodeSliceExpr(expr)
+	case *ast.TypeAssertExpr:
+		e.EncodeTypeAssertExpr(expr)
+	case *ast.CallExpr:
+		e.EncodeCallExpr(expr)
+	case *ast.StarExpr:
+		e.EncodeStarExpr(expr)
+	case *ast.UnaryExpr:
+		e.EncodeUnaryExpr(expr)
+	case *ast.BinaryExpr:
+		e.EncodeBinaryExpr(expr)
+	case *ast.KeyValueExpr:
+		e.EncodeKeyValueExpr(expr)
+	case *ast.ArrayType:
+		e.EncodeArrayType(expr)
+	case *ast.StructType:
+		e.EncodeStructType(expr)
+	case *ast.FuncType:
+		e.EncodeFuncType(expr)
+	case *ast.InterfaceType:
+		e.EncodeInterfaceType(expr)
+	case *ast.MapType:
+		e.EncodeMapType(expr)
+	case *ast.ChanType:
+		e.EncodeChanType(expr)
+	default:
+		panic("implement me " + reflect.TypeOf(expr).String())
+	}
+}
+
+func (e *Encoder) EncodeExprs(exprs []ast.Expr) {
+	if exprs == nil {
+		e.null()
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for index, expr := range exprs {
+		if index > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.EncodeExpr(expr)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+// ---------------------------------------------------------------------------
+
+func (e *Encoder) EncodeArrayType(node *ast.ArrayType) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("ArrayType", node)
+		e.positionField("Lbrack", node.Lbrack)
+		e.key("Len")
+		e.EncodeExpr(node.Len)
+		e.key("Elt")
+		e.EncodeExpr(node.Elt)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeStructType(node *ast.StructType) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("StructType", node)
+		e.positionField("Struct", node.Struct)
+		e.key("Fields")
+		e.EncodeFieldList(node.Fields)
+		e.boolField("Incomplete", node.Incomplete)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeFuncType(node *ast.FuncType) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("FuncType", node)
+		e.positionField("Func", node.Func)
+		e.key("TypeParams")
+		e.EncodeFieldList(node.TypeParams)
+		e.key("Params")
+		e.EncodeFieldList(node.Params)
+		e.key("Results")
+		e.EncodeFieldList(node.Results)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeInterfaceType(node *ast.InterfaceType) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("InterfaceType", node)
+		e.positionField("Interface", node.Interface)
+		e.key("Methods")
+		e.EncodeFieldList(node.Methods)
+		e.boolField("Incomplete", node.Incomplete)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeMapType(node *ast.MapType) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("MapType", node)
+		e.positionField("Map", node.Map)
+		e.key("Key")
+		e.EncodeExpr(node.Key)
+		e.key("Value")
+		e.EncodeExpr(node.Value)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeChanType(node *ast.ChanType) {
+	wrapEncode(e, node, func() {
+		e.EncodeNode("ChanType", node)
+		e.positionField("Begin", node.Begin)
+		e.positionField("Arrow", node.Arrow)
+		e.stringField("Dir", ChanDirToString[node.Dir])
+		e.key("Value")
+		e.EncodeExpr(node.Value)
+		e.end()
+	})
+}
+
+// ---------------------------------------------------------------------------
+
+func (e *Encoder) EncodeBadStmt(stmt *ast.BadStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("BadStmt", stmt)
+		e.positionField("From", stmt.From)
+		e.positionField("To", stmt.To)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeDeclStmt(stmt *ast.DeclStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("DeclStmt", stmt)
+		e.key("Decl")
+		e.EncodeDecl(stmt.Decl)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeEmptyStmt(stmt *ast.EmptyStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("EmptyStmt", stmt)
+		e.positionField("Semicolon", stmt.Semicolon)
+		e.boolField("Implicit", stmt.Implicit)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeLabeledStmt(stmt *ast.LabeledStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("LabeledStmt", stmt)
+		e.key("Label")
+		e.EncodeIdent(stmt.Label)
+		e.positionField("Colon", stmt.Colon)
+		e.key("Stmt")
+		e.EncodeStmt(stmt.Stmt)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeExprStmt(stmt *ast.ExprStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("ExprStmt", stmt)
+		if stmt.X != nil {
+			e.key("X")
+			e.EncodeExpr(stmt.X)
+		}
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeSendStmt(stmt *ast.SendStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("SendStmt", stmt)
+		e.key("Chan")
+		e.EncodeExpr(stmt.Chan)
+		e.positionField("Arrow", stmt.Arrow)
+		e.key("Value")
+		e.EncodeExpr(stmt.Value)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeIncDecStmt(stmt *ast.IncDecStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("IncDecStmt", stmt)
+		e.key("X")
+		e.EncodeExpr(stmt.X)
+		e.positionField("TokPos", stmt.TokPos)
+		e.stringField("Tok", stmt.Tok.String())
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeAssignStmt(stmt *ast.AssignStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("AssignStmt", stmt)
+		e.key("Lhs")
+		e.EncodeExprs(stmt.Lhs)
+		e.positionField("TokPos", stmt.TokPos)
+		e.stringField("Tok", stmt.Tok.String())
+		e.key("Rhs")
+		e.EncodeExprs(stmt.Rhs)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeGoStmt(stmt *ast.GoStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("GoStmt", stmt)
+		e.positionField("Go", stmt.Go)
+		e.key("Call")
+		e.EncodeCallExpr(stmt.Call)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeDeferStmt(stmt *ast.DeferStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("DeferStmt", stmt)
+		e.positionField("Defer", stmt.Defer)
+		e.key("Call")
+		e.EncodeCallExpr(stmt.Call)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeReturnStmt(stmt *ast.ReturnStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("ReturnStmt", stmt)
+		e.positionField("Return", stmt.Return)
+		e.key("Results")
+		e.EncodeExprs(stmt.Results)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeBranchStmt(stmt *ast.BranchStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("BranchStmt", stmt)
+		e.positionField("TokPos", stmt.TokPos)
+		e.stringField("Tok", stmt.Tok.String())
+		e.key("Label")
+		e.EncodeIdent(stmt.Label)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeBlockStmt(stmt *ast.BlockStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("BlockStmt", stmt)
+		e.positionField("Lbrace", stmt.Lbrace)
+		e.key("List")
+		e.EncodeStmts(stmt.List)
+		e.positionField("Rbrace", stmt.Rbrace)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeIfStmt(stmt *ast.IfStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("IfStmt", stmt)
+		e.positionField("If", stmt.If)
+		e.key("Init")
+		e.EncodeStmt(stmt.Init)
+		e.key("Cond")
+		e.EncodeExpr(stmt.Cond)
+		e.key("Body")
+		e.EncodeBlockStmt(stmt.Body)
+		e.key("Else")
+		e.EncodeStmt(stmt.Else)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeCaseClause(stmt *ast.CaseClause) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("CaseClause", stmt)
+		e.positionField("Case", stmt.Case)
+		e.key("List")
+		e.EncodeExprs(stmt.List)
+		e.positionField("Colon", stmt.Colon)
+		e.key("Body")
+		e.EncodeStmts(stmt.Body)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeSwitchStmt(stmt *ast.SwitchStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("SwitchStmt", stmt)
+		e.positionField("Switch", stmt.Switch)
+		e.key("Init")
+		e.EncodeStmt(stmt.Init)
+		e.key("Tag")
+		e.EncodeExpr(stmt.Tag)
+		e.key("Body")
+		e.EncodeBlockStmt(stmt.Body)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeTypeSwitchStmt(stmt *ast.TypeSwitchStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("TypeSwitchStmt", stmt)
+		e.positionField("Switch", stmt.Switch)
+		e.key("Init")
+		e.EncodeStmt(stmt.Init)
+		e.key("Assign")
+		e.EncodeStmt(stmt.Assign)
+		e.key("Body")
+		e.EncodeBlockStmt(stmt.Body)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeCommClause(stmt *ast.CommClause) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("CommClause", stmt)
+		e.positionField("Case", stmt.Case)
+		e.key("Comm")
+		e.EncodeStmt(stmt.Comm)
+		e.key("Body")
+		e.EncodeStmts(stmt.Body)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeSelectStmt(stmt *ast.SelectStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("SelectStmt", stmt)
+		e.positionField("Select", stmt.Select)
+		e.key("Body")
+		e.EncodeBlockStmt(stmt.Body)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeForStmt(stmt *ast.ForStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("ForStmt", stmt)
+		e.positionField("For", stmt.For)
+		e.key("Init")
+		e.EncodeStmt(stmt.Init)
+		e.key("Cond")
+		e.EncodeExpr(stmt.Cond)
+		e.key("Post")
+		e.EncodeStmt(stmt.Post)
+		e.key("Body")
+		e.EncodeBlockStmt(stmt.Body)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeRangeStmt(stmt *ast.RangeStmt) {
+	wrapEncode(e, stmt, func() {
+		e.EncodeNode("RangeStmt", stmt)
+		e.positionField("For", stmt.For)
+		e.key("Key")
+		e.EncodeExpr(stmt.Key)
+		e.key("Value")
+		e.EncodeExpr(stmt.Value)
+		e.positionField("TokPos", stmt.TokPos)
+		e.stringField("Tok", stmt.Tok.String())
+		e.key("X")
+		e.EncodeExpr(stmt.X)
+		e.key("Body")
+		e.EncodeBlockStmt(stmt.Body)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeStmt(node ast.Stmt) {
+	if node == nil {
+		e.null()
+		return
+	}
+	switch stmt := node.(type) {
+	case *ast.BadStmt:
+		e.EncodeBadStmt(stmt)
+	case *ast.DeclStmt:
+		e.EncodeDeclStmt(stmt)
+	case *ast.EmptyStmt:
+		e.EncodeEmptyStmt(stmt)
+	case *ast.LabeledStmt:
+		e.EncodeLabeledStmt(stmt)
+	case *ast.ExprStmt:
+		e.EncodeExprStmt(stmt)
+	case *ast.SendStmt:
+		e.EncodeSendStmt(stmt)
+	case *ast.IncDecStmt:
+		e.EncodeIncDecStmt(stmt)
+	case *ast.AssignStmt:
+		e.EncodeAssignStmt(stmt)
+	case *ast.GoStmt:
+		e.EncodeGoStmt(stmt)
+	case *ast.DeferStmt:
+		e.EncodeDeferStmt(stmt)
+	case *ast.ReturnStmt:
+		e.EncodeReturnStmt(stmt)
+	case *ast.BranchStmt:
+		e.EncodeBranchStmt(stmt)
+	case *ast.BlockStmt:
+		e.EncodeBlockStmt(stmt)
+	case *ast.IfStmt:
+		e.EncodeIfStmt(stmt)
+	case *ast.CaseClause:
+		e.EncodeCaseClause(stmt)
+	case *ast.SwitchStmt:
+		e.EncodeSwitchStmt(stmt)
+	case *ast.TypeSwitchStmt:
+		e.EncodeTypeSwitchStmt(stmt)
+	case *ast.CommClause:
+		e.EncodeCommClause(stmt)
+	case *ast.SelectStmt:
+		e.EncodeSelectStmt(stmt)
+	case *ast.ForStmt:
+		e.EncodeForStmt(stmt)
+	case *ast.RangeStmt:
+		e.EncodeRangeStmt(stmt)
+	default:
+		panic("implement me " + reflect.TypeOf(stmt).String())
+	}
+}
+
+func (e *Encoder) EncodeStmts(stmts []ast.Stmt) {
+	if stmts == nil {
+		e.null()
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for index, stmt := range stmts {
+		if index > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.EncodeStmt(stmt)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+// ---------------------------------------------------------------------------
+
+func (e *Encoder) EncodeImportSpec(spec *ast.ImportSpec) {
+	wrapEncode(e, spec, func() {
+		e.EncodeNode("ImportSpec", spec)
+		e.docGroupField(spec.Doc)
+		e.key("Name")
+		e.EncodeIdent(spec.Name)
+		e.key("Path")
+		e.EncodeBasicLit(spec.Path)
+		e.commentGroupField("Comment", spec.Comment)
+		e.positionField("EndPos", spec.EndPos)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeImportSpecs(imports []*ast.ImportSpec) {
+	if imports == nil {
+		e.null()
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for index, importSpec := range imports {
+		if index > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.EncodeImportSpec(importSpec)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+func (e *Encoder) EncodeValueSpec(spec *ast.ValueSpec) {
+	wrapEncode(e, spec, func() {
+		e.EncodeNode("ValueSpec", spec)
+		e.docGroupField(spec.Doc)
+		e.key("Names")
+		e.EncodeIdents(spec.Names)
+		e.key("Type")
+		e.EncodeExpr(spec.Type)
+		e.key("Values")
+		e.EncodeExprs(spec.Values)
+		e.commentGroupField("Comment", spec.Comment)
+		if e.WithDirectives {
+			e.directivesField(groupDirectives(e.fset, e.specDoc, spec.Doc, spec.Comment))
+		}
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeTypeSpec(spec *ast.TypeSpec) {
+	wrapEncode(e, spec, func() {
+		e.EncodeNode("TypeSpec", spec)
+		e.docGroupField(spec.Doc)
+		e.key("Name")
+		e.EncodeIdent(spec.Name)
+		e.key("TypeParams")
+		e.EncodeFieldList(spec.TypeParams)
+		e.positionField("Assign", spec.Assign)
+		e.key("Type")
+		e.EncodeExpr(spec.Type)
+		e.commentGroupField("Comment", spec.Comment)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeSpec(node ast.Spec) {
+	if node == nil {
+		e.null()
+		return
+	}
+	switch spec := node.(type) {
+	case *ast.ImportSpec:
+		e.EncodeImportSpec(spec)
+	case *ast.ValueSpec:
+		e.EncodeValueSpec(spec)
+	case *ast.TypeSpec:
+		e.EncodeTypeSpec(spec)
+	default:
+		panic("implement me " + reflect.TypeOf(spec).String())
+	}
+}
+
+func (e *Encoder) EncodeSpecs(specs []ast.Spec) {
+	if specs == nil {
+		e.null()
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for index, spec := range specs {
+		if index > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.EncodeSpec(spec)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+// ---------------------------------------------------------------------------
+
+func (e *Encoder) EncodeBadDecl(decl *ast.BadDecl) {
+	wrapEncode(e, decl, func() {
+		e.EncodeNode("BadDecl", decl)
+		e.positionField("From", decl.From)
+		e.positionField("To", decl.To)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeGenDecl(decl *ast.GenDecl) {
+	wrapEncode(e, decl, func() {
+		specDoc := e.specDoc
+		e.specDoc = specDirectiveDoc(decl)
+		defer func() { e.specDoc = specDoc }()
+		e.EncodeNode("GenDecl", decl)
+		e.docGroupField(decl.Doc)
+		e.positionField("TokPos", decl.TokPos)
+		e.stringField("Tok", decl.Tok.String())
+		e.positionField("Lparen", decl.Lparen)
+		e.key("Specs")
+		e.EncodeSpecs(decl.Specs)
+		e.positionField("Rparen", decl.Rparen)
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeFuncDecl(decl *ast.FuncDecl) {
+	wrapEncode(e, decl, func() {
+		e.EncodeNode("FuncDecl", decl)
+		e.docGroupField(decl.Doc)
+		e.key("Recv")
+		e.EncodeFieldList(decl.Recv)
+		e.key("Name")
+		e.EncodeIdent(decl.Name)
+		e.key("Type")
+		e.EncodeFuncType(decl.Type)
+		e.key("Body")
+		e.EncodeBlockStmt(decl.Body)
+		if e.WithDirectives {
+			e.directivesField(groupDirectives(e.fset, decl.Doc))
+		}
+		e.end()
+	})
+}
+
+func (e *Encoder) EncodeDecl(node ast.Decl) {
+	if node == nil {
+		e.null()
+		return
+	}
+	switch decl := node.(type) {
+	case *ast.BadDecl:
+		e.EncodeBadDecl(decl)
+	case *ast.GenDecl:
+		e.EncodeGenDecl(decl)
+	case *ast.FuncDecl:
+		e.EncodeFuncDecl(decl)
+	default:
+		panic("implement me " + reflect.TypeOf(decl).String())
+	}
+}
+
+func (e *Encoder) EncodeDecls(decls []ast.Decl) {
+	if decls == nil {
+		e.null()
+		return
+	}
+	e.buf = append(e.buf, '[')
+	for index, decl := range decls {
+		if index > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		e.EncodeDecl(decl)
+	}
+	e.buf = append(e.buf, ']')
+}
+
+// ---------------------------------------------------------------------------
+
+func (e *Encoder) EncodeFile(node *ast.File) error {
+	return e.EncodePartialFile(node, nil)
+}
+
+// EncodePartialFile encodes a file along with the syntax errors it was parsed
+// with.
+func (e *Encoder) EncodePartialFile(node *ast.File, errors []*SourceError) error {
+	if node == nil {
+		e.start = len(e.buf)
+		e.null()
+		return nil
+	}
+
+	// Marshaller numbers imports before the file itself, so they are encoded
+	// ahead of the document and copied into place when the field is reached.
+	e.positions.reset()
+	if e.WithDocs {
+		e.docParser = newDocParser(node)
+	}
+	var imports encodedSpan
+	if e.WithImports {
+		imports.start = len(e.buf)
+		e.EncodeImportSpecs(node.Imports)
+		imports.end = len(e.buf)
+	}
+
+	e.start = len(e.buf)
+	e.EncodeNode("File", node)
+	e.key("Doc")
+	e.encodeCommentGroup(node.Doc, true)
+	e.key("Package")
+	e.EncodePosition(node.Package)
+	e.key("Name")
+	e.EncodeIdent(node.Name)
+	e.key("Decls")
+	e.EncodeDecls(node.Decls)
+	e.key("Imports")
+	if e.WithImports {
+		e.buf = append(e.buf, e.buf[imports.start:imports.end]...)
+	} else {
+		e.null()
+	}
+	e.key("Unresolved")
+	e.EncodeIdents(node.Unresolved)
+	e.key("Comments")
+	e.EncodeCommentGroups(node.Comments)
+	if e.WithDirectives {
+		e.directivesField(fileDirectives(e.fset, node))
+	}
+	e.key("FileSet")
+	err := e.fset.Write(func(src any) error {
+		data, err := json.Marshal(src)
+		if err != nil {
+			return err
+		}
+		e.buf = append(e.buf, data...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if (e.WithPositions || e.WithSpans) && e.PositionFormat == PositionTable && len(e.positions.items) > 0 {
+		e.key("Positions")
+		e.buf = append(e.buf, '[')
+		for index, item := range e.positions.items {
+			if index > 0 {
+				e.buf = append(e.buf, ',')
+			}
+			e.buf = append(e.buf, '[')
+			e.appendInt(item[0])
+			e.buf = append(e.buf, ',')
+			e.appendInt(item[1])
+			e.buf = append(e.buf, ',')
+			e.appendInt(item[2])
+			e.buf = append(e.buf, ']')
+		}
+		e.buf = append(e.buf, ']')
+	}
+	if len(errors) > 0 {
+		e.key("Errors")
+		data, err := json.Marshal(errors)
+		if err != nil {
+			return err
+		}
+		e.buf = append(e.buf, data...)
+	}
+	e.end()
+	return e.err
+}
+
+// ---------------------------------------------------------------------------
+
+// appendJSONString follows the escaping rules of encoding/json with HTML
+// escaping enabled, so output stays byte-compatible with json.Encoder. Rare
+// cases whose escaping differs between Go releases (control characters,
+// invalid UTF-8, line separators) are delegated to encoding/json itself.
+func appendJSONString(dst []byte, s string) []byte {
+	start := len(dst)
+	dst = append(dst, '"')
+	last := 0
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 || r == '\u2028' || r == '\u2029' {
+				return appendJSONStringSlow(dst[:start], s)
+			}
+			i += size
+			continue
+		}
+		var escaped string
+		switch b {
+		case '"':
+			escaped = `\"`
+		case '\\':
+			escaped = `\\`
+		case '\n':
+			escaped = `\n`
+		case '\r':
+			escaped = `\r`
+		case '\t':
+			escaped = `\t`
+		case '<':
+			escaped = `\u003c`
+		case '>':
+			escaped = `\u003e`
+		case '&':
+			escaped = `\u0026`
+		default:
+			if b < ' ' {
+				return appendJSONStringSlow(dst[:start], s)
+			}
+			i++
+			continue
+		}
+		dst = append(dst, s[last:i]...)
+		dst = append(dst, escaped...)
+		i++
+		last = i
+	}
+	dst = append(dst, s[last:]...)
+	dst = append(dst, '"')
+	return dst
+}
+
+func appendJSONStringSlow(dst []byte, s string) []byte {
+	data, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	return append(dst, data...)
+}
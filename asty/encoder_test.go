@@ -0,0 +1,276 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parseForEncoding(fset *token.FileSet, filename string, src []byte, options Options) (*ast.File, []*SourceError, error) {
+	mode := parser.SkipObjectResolution
+	if options.WithComments || options.WithDirectives {
+		mode |= parser.ParseComments
+	}
+	if options.Tolerant {
+		mode |= parser.AllErrors
+	}
+	tree, err := parser.ParseFile(fset, filename, src, mode)
+	if err != nil && options.Tolerant && tree != nil {
+		return tree, sourceErrors(err), nil
+	}
+	return tree, nil, err
+}
+
+func marshalWithReflection(filename string, src []byte, options Options) ([]byte, error) {
+	marshaller := NewMarshaller(options)
+	marshaller.SetSource(src)
+	tree, errors, err := parseForEncoding(marshaller.FileSet(), filename, src, options)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = json.NewEncoder(&buf).Encode(marshaller.MarshalPartialFile(tree, errors))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeDirectly(filename string, src []byte, options Options) ([]byte, error) {
+	encoder := NewEncoder(options)
+	encoder.SetSource(src)
+	tree, errors, err := parseForEncoding(encoder.FileSet(), filename, src, options)
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.EncodePartialFile(tree, errors)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = encoder.Flush(&buf, "")
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encoderCorpus(tb testing.TB) []string {
+	files, err := listDir(getTestDataRoot(), ".input")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return append(files, "cli.go", "nodes.go")
+}
+
+func TestEncoderMatchesMarshaller(t *testing.T) {
+	for _, input := range encoderCorpus(t) {
+		src, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, params := range paramsMatrix {
+			options := Options{
+				WithComments:   params.comments,
+				WithPositions:  params.positions,
+				WithReferences: params.references,
+				WithImports:    params.imports,
+			}
+			testName := fmt.Sprintf(
+				"%s/comments:%t,positions:%t,references:%t,imports:%t", filepath.Base(input),
+				params.comments, params.positions, params.references, params.imports,
+			)
+			t.Run(testName, func(t *testing.T) {
+				expected, err := marshalWithReflection(input, src, options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				actual, err := encodeDirectly(input, src, options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(expected, actual) {
+					t.Fatalf("encoder output differs from marshaller output\nexpected: %.300s\nactual:   %.300s",
+						expected, actual)
+				}
+			})
+		}
+	}
+}
+
+func TestEncoderTolerant(t *testing.T) {
+	src := []byte("package p\n\nfunc f() {\n\tx := \n\treturn 1 +\n}\n")
+	options := Options{WithPositions: true, Tolerant: true}
+	expected, err := marshalWithReflection("broken.go", src, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := encodeDirectly("broken.go", src, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Fatalf("encoder output differs from marshaller output\nexpected: %s\nactual:   %s", expected, actual)
+	}
+}
+
+func TestEncoderNilLists(t *testing.T) {
+	src := []byte("package p\n")
+	expected, err := marshalWithReflection("empty.go", src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := encodeDirectly("empty.go", src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) || !bytes.Contains(actual, []byte(`"Decls":null`)) {
+		t.Fatalf("nil declarations should be null\nexpected: %s\nactual:   %s", expected, actual)
+	}
+}
+
+func TestEncoderReset(t *testing.T) {
+	options := Options{WithPositions: true, WithComments: true, WithDocs: true, WithDirectives: true,
+		PositionFormat: PositionTable}
+	encoder := NewEncoder(options)
+	for _, src := range []string{docsSource, directivesSource, docsSource} {
+		encoder.Reset()
+		encoder.SetSource([]byte(src))
+		tree, errors, err := parseForEncoding(encoder.FileSet(), "reset.go", []byte(src), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = encoder.EncodePartialFile(tree, errors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual bytes.Buffer
+		err = encoder.Flush(&actual, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := encodeDirectly("reset.go", []byte(src), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected, actual.Bytes()) {
+			t.Fatalf("reused encoder output differs\nexpected: %.300s\nactual:   %.300s", expected, actual.Bytes())
+		}
+	}
+}
+
+func TestEncoderSpans(t *testing.T) {
+	for _, input := range encoderCorpus(t) {
+		src, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, format := range []string{PositionFull, PositionTable} {
+			for _, references := range []bool{false, true} {
+				options := Options{WithSpans: true, WithComments: true, WithReferences: references, PositionFormat: format}
+				name := fmt.Sprintf("%s/%s,references:%t", filepath.Base(input), format, references)
+				t.Run(name, func(t *testing.T) {
+					expected, err := marshalWithReflection(input, src, options)
+					if err != nil {
+						t.Fatal(err)
+					}
+					actual, err := encodeDirectly(input, src, options)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(expected, actual) {
+						t.Fatalf("encoder output differs from marshaller output\nexpected: %.300s\nactual:   %.300s",
+							expected, actual)
+					}
+				})
+			}
+		}
+	}
+
+	encoder, err := EncodeFragment("f.go", strings.NewReader("f(a, b)"), KindExpr, Options{WithSpans: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := NewDecoder(bytes.NewReader(encoder.Bytes())).DecodeExpr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := node.(*CallExprNode)
+	if call.Pos.Offset != 0 || call.End.Offset != 7 || call.Lparen != nil || call.Args[1].(*IdentNode).End.Column != 7 {
+		t.Errorf("unexpected spans %s", encoder.Bytes())
+	}
+}
+
+func TestEncoderString(t *testing.T) {
+	inputs := []string{
+		"plain", `"quoted"`, `back\slash`, "<html>&amp;", "tab\tnew\nline\rret",
+		"\b\f\x00\x1f", "utf8 ж 世界", "bad \xff utf8", "sep \u2028 \u2029",
+	}
+	for _, input := range inputs {
+		expected, err := json.Marshal(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := appendJSONString(nil, input)
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("%q: expected %s, got %s", input, expected, actual)
+		}
+	}
+}
+
+func benchmarkCorpus(b *testing.B) map[string][]byte {
+	corpus := make(map[string][]byte)
+	size := 0
+	for _, input := range encoderCorpus(b) {
+		src, err := os.ReadFile(input)
+		if err != nil {
+			b.Fatal(err)
+		}
+		corpus[input] = src
+		size += len(src)
+	}
+	b.SetBytes(int64(size))
+	return corpus
+}
+
+var benchmarkOptions = Options{
+	WithComments:   true,
+	WithPositions:  true,
+	WithReferences: true,
+	WithImports:    true,
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	corpus := benchmarkCorpus(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for filename, src := range corpus {
+			_, err := marshalWithReflection(filename, src, benchmarkOptions)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	corpus := benchmarkCorpus(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for filename, src := range corpus {
+			_, err := encodeDirectly(filename, src, benchmarkOptions)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
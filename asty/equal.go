@@ -0,0 +1,358 @@
+package asty
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"reflect"
+	"strconv"
+)
+
+// CompareOptions selects which parts of node trees take part in Equal and
+// Hash. The zero value compares pure structure: node types, names, literals
+// and operators, ignoring positions, reference ids and comments.
+// IgnoreIdents and IgnoreLiterals additionally mask identifier names and
+// literal values, which matches code that differs only in naming or constants.
+type CompareOptions struct {
+	WithPositions  bool
+	WithRefIds     bool
+	WithComments   bool
+	IgnoreIdents   bool
+	IgnoreLiterals bool
+}
+
+func (options CompareOptions) values(node INode, f func(field string, value string)) {
+	switch node.(type) {
+	case *IdentNode:
+		if options.IgnoreIdents {
+			return
+		}
+	case *BasicLitNode:
+		if options.IgnoreLiterals {
+			walkValues(node, func(field string, value string) {
+				if field != "Value" {
+					f(field, value)
+				}
+			})
+			return
+		}
+	}
+	walkValues(node, f)
+}
+
+type childNode struct {
+	field string
+	node  INode
+}
+
+func (options CompareOptions) children(node INode) []childNode {
+	var result []childNode
+	walkChildren(node, func(field string, _ int, child INode) {
+		if !options.WithComments {
+			switch child.(type) {
+			case *CommentGroupNode, *CommentNode:
+				return
+			}
+		}
+		result = append(result, childNode{field: field, node: child})
+	})
+	return result
+}
+
+func positionsEqual(a, b *PositionNode) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Filename == b.Filename && a.Offset == b.Offset && a.Line == b.Line && a.Column == b.Column
+}
+
+// Equal reports whether two node trees are equal under the given options.
+func Equal(a, b INode, options CompareOptions) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return false
+	}
+	if options.WithRefIds && a.GetRefId() != b.GetRefId() {
+		return false
+	}
+
+	var valuesA, valuesB []string
+	options.values(a, func(_ string, value string) {
+		valuesA = append(valuesA, value)
+	})
+	options.values(b, func(_ string, value string) {
+		valuesB = append(valuesB, value)
+	})
+	for i := range valuesA {
+		if valuesA[i] != valuesB[i] {
+			return false
+		}
+	}
+
+	if options.WithPositions {
+		var positionsA, positionsB []*PositionNode
+		walkPositions(a, func(_ string, position *PositionNode) {
+			positionsA = append(positionsA, position)
+		})
+		walkPositions(b, func(_ string, position *PositionNode) {
+			positionsB = append(positionsB, position)
+		})
+		for i := range positionsA {
+			if !positionsEqual(positionsA[i], positionsB[i]) {
+				return false
+			}
+		}
+	}
+
+	childrenA := options.children(a)
+	childrenB := options.children(b)
+	if len(childrenA) != len(childrenB) {
+		return false
+	}
+	for i := range childrenA {
+		if childrenA[i].field != childrenB[i].field {
+			return false
+		}
+		if !Equal(childrenA[i].node, childrenB[i].node, options) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash returns a structural fingerprint of a node tree that ignores positions,
+// reference ids and comments. Trees that are Equal with zero CompareOptions
+// have the same hash, and the result is stable across runs and processes.
+func Hash(node INode) uint64 {
+	return HashWithOptions(node, CompareOptions{})
+}
+
+// HashWithOptions is like Hash, but takes the same parts of the tree into
+// account as Equal does with the given options.
+func HashWithOptions(node INode, options CompareOptions) uint64 {
+	return options.hash(node, func(child INode) uint64 {
+		return HashWithOptions(child, options)
+	})
+}
+
+// hash combines the own data of node with hashes of its children, which are
+// provided by childHash so that callers can memoize subtree hashes.
+func (options CompareOptions) hash(node INode, childHash func(INode) uint64) uint64 {
+	h := fnv.New64a()
+	if node == nil {
+		return h.Sum64()
+	}
+
+	var scratch [8]byte
+	writeString := func(s string) {
+		binary.LittleEndian.PutUint64(scratch[:], uint64(len(s)))
+		_, _ = h.Write(scratch[:])
+		_, _ = h.Write([]byte(s))
+	}
+	writeInt := func(v uint64) {
+		binary.LittleEndian.PutUint64(scratch[:], v)
+		_, _ = h.Write(scratch[:])
+	}
+
+	writeString(reflect.TypeOf(node).Elem().Name())
+	if options.WithRefIds {
+		writeInt(uint64(node.GetRefId()))
+	}
+	options.values(node, func(field string, value string) {
+		writeString(field)
+		writeString(value)
+	})
+	if options.WithPositions {
+		walkPositions(node, func(field string, position *PositionNode) {
+			writeString(field)
+			if position == nil {
+				writeString("")
+				return
+			}
+			writeString(position.Filename)
+			writeInt(uint64(position.Offset))
+			writeInt(uint64(position.Line))
+			writeInt(uint64(position.Column))
+		})
+	}
+	for _, child := range options.children(node) {
+		writeString(child.field)
+		writeInt(childHash(child.node))
+	}
+	return h.Sum64()
+}
+
+// ---------------------------------------------------------------------------
+
+func walkValues(node INode, f func(field string, value string)) {
+	switch n := node.(type) {
+	case *CommentGroupNode, *FieldNode, *FieldListNode, *BadExprNode, *EllipsisNode,
+		*FuncLitNode, *ParenExprNode, *SelectorExprNode, *IndexExprNode, *IndexListExprNode,
+		*TypeAssertExprNode, *CallExprNode, *StarExprNode, *KeyValueExprNode, *ArrayTypeNode,
+		*FuncTypeNode, *MapTypeNode, *BadStmtNode, *DeclStmtNode, *LabeledStmtNode,
+		*ExprStmtNode, *SendStmtNode, *GoStmtNode, *DeferStmtNode, *ReturnStmtNode,
+		*BlockStmtNode, *IfStmtNode, *CaseClauseNode, *SwitchStmtNode, *TypeSwitchStmtNode,
+		*CommClauseNode, *SelectStmtNode, *ForStmtNode, *ImportSpecNode, *ValueSpecNode,
+		*TypeSpecNode, *BadDeclNode, *FuncDeclNode, *FileNode:
+	case *CommentNode:
+		f("Text", n.Text)
+	case *IdentNode:
+		f("Name", n.Name)
+	case *BasicLitNode:
+		f("Kind", n.Kind)
+		f("Value", n.Value)
+	case *CompositeLitNode:
+		f("Incomplete", strconv.FormatBool(n.Incomplete))
+	case *SliceExprNode:
+		f("Slice3", strconv.FormatBool(n.Slice3))
+	case *UnaryExprNode:
+		f("Op", n.Op)
+	case *BinaryExprNode:
+		f("Op", n.Op)
+	case *StructTypeNode:
+		f("Incomplete", strconv.FormatBool(n.Incomplete))
+	case *InterfaceTypeNode:
+		f("Incomplete", strconv.FormatBool(n.Incomplete))
+	case *ChanTypeNode:
+		f("Dir", n.Dir)
+	case *EmptyStmtNode:
+		f("Implicit", strconv.FormatBool(n.Implicit))
+	case *IncDecStmtNode:
+		f("Tok", n.Tok)
+	case *AssignStmtNode:
+		f("Tok", n.Tok)
+	case *BranchStmtNode:
+		f("Tok", n.Tok)
+	case *RangeStmtNode:
+		f("Tok", n.Tok)
+	case *GenDeclNode:
+		f("Tok", n.Tok)
+	case *PackageNode:
+		f("Name", n.Name)
+	default:
+		panic("implement me " + reflect.TypeOf(node).String())
+	}
+}
+
+func walkPositions(node INode, f func(field string, position *PositionNode)) {
+	switch n := node.(type) {
+	case *CommentGroupNode, *FieldNode, *FuncLitNode, *SelectorExprNode, *DeclStmtNode,
+		*ExprStmtNode, *ValueSpecNode, *FuncDeclNode, *PackageNode:
+	case *CommentNode:
+		f("Slash", n.Slash)
+	case *FieldListNode:
+		f("Opening", n.Opening)
+		f("Closing", n.Closing)
+	case *BadExprNode:
+		f("From", n.From)
+		f("To", n.To)
+	case *IdentNode:
+		f("NamePos", n.NamePos)
+	case *EllipsisNode:
+		f("Ellipsis", n.Ellipsis)
+	case *BasicLitNode:
+		f("ValuePos", n.ValuePos)
+	case *CompositeLitNode:
+		f("Lbrace", n.Lbrace)
+		f("Rbrace", n.Rbrace)
+	case *ParenExprNode:
+		f("Lparen", n.Lparen)
+		f("Rparen", n.Rparen)
+	case *IndexExprNode:
+		f("Lbrack", n.Lbrack)
+		f("Rbrack", n.Rbrack)
+	case *IndexListExprNode:
+		f("Lbrack", n.Lbrack)
+		f("Rbrack", n.Rbrack)
+	case *SliceExprNode:
+		f("Lbrack", n.Lbrack)
+		f("Rbrack", n.Rbrack)
+	case *TypeAssertExprNode:
+		f("Lparen", n.Lparen)
+		f("Rparen", n.Rparen)
+	case *CallExprNode:
+		f("Lparen", n.Lparen)
+		f("Ellipsis", n.Ellipsis)
+		f("Rparen", n.Rparen)
+	case *StarExprNode:
+		f("Star", n.Star)
+	case *UnaryExprNode:
+		f("OpPos", n.OpPos)
+	case *BinaryExprNode:
+		f("OpPos", n.OpPos)
+	case *KeyValueExprNode:
+		f("Colon", n.Colon)
+	case *ArrayTypeNode:
+		f("Lbrack", n.Lbrack)
+	case *StructTypeNode:
+		f("Struct", n.Struct)
+	case *FuncTypeNode:
+		f("Func", n.Func)
+	case *InterfaceTypeNode:
+		f("Interface", n.Interface)
+	case *MapTypeNode:
+		f("Map", n.Map)
+	case *ChanTypeNode:
+		f("Begin", n.Begin)
+		f("Arrow", n.Arrow)
+	case *BadStmtNode:
+		f("From", n.From)
+		f("To", n.To)
+	case *EmptyStmtNode:
+		f("Semicolon", n.Semicolon)
+	case *LabeledStmtNode:
+		f("Colon", n.Colon)
+	case *SendStmtNode:
+		f("Arrow", n.Arrow)
+	case *IncDecStmtNode:
+		f("TokPos", n.TokPos)
+	case *AssignStmtNode:
+		f("TokPos", n.TokPos)
+	case *GoStmtNode:
+		f("Go", n.Go)
+	case *DeferStmtNode:
+		f("Defer", n.Defer)
+	case *ReturnStmtNode:
+		f("Return", n.Return)
+	case *BranchStmtNode:
+		f("TokPos", n.TokPos)
+	case *BlockStmtNode:
+		f("Lbrace", n.Lbrace)
+		f("Rbrace", n.Rbrace)
+	case *IfStmtNode:
+		f("If", n.If)
+	case *CaseClauseNode:
+		f("Case", n.Case)
+		f("Colon", n.Colon)
+	case *SwitchStmtNode:
+		f("Switch", n.Switch)
+	case *TypeSwitchStmtNode:
+		f("Switch", n.Switch)
+	case *CommClauseNode:
+		f("Case", n.Case)
+		f("Colon", n.Colon)
+	case *SelectStmtNode:
+		f("Select", n.Select)
+	case *ForStmtNode:
+		f("For", n.For)
+	case *RangeStmtNode:
+		f("For", n.For)
+		f("TokPos", n.TokPos)
+	case *ImportSpecNode:
+		f("EndPos", n.EndPos)
+	case *TypeSpecNode:
+		f("Assign", n.Assign)
+	case *BadDeclNode:
+		f("From", n.From)
+		f("To", n.To)
+	case *GenDeclNode:
+		f("TokPos", n.TokPos)
+		f("Lparen", n.Lparen)
+		f("Rparen", n.Rparen)
+	case *FileNode:
+		f("Package", n.Package)
+	default:
+		panic("implement me " + reflect.TypeOf(node).String())
+	}
+}
@@ -0,0 +1,99 @@
+package asty
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEqualAfterRoundTrip(t *testing.T) {
+	options := CompareOptions{WithPositions: true, WithRefIds: true, WithComments: true}
+	for _, input := range encoderCorpus(t) {
+		src, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			marshaller := NewMarshaller(benchmarkOptions)
+			tree, _, err := parseForEncoding(marshaller.FileSet(), input, src, benchmarkOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := marshaller.MarshalFile(tree)
+
+			data, err := encodeDirectly(input, src, benchmarkOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := NewDecoder(bytes.NewReader(data)).DecodeFile()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !Equal(expected, actual, options) {
+				t.Error("trees differ after round trip")
+			}
+			if HashWithOptions(expected, options) != HashWithOptions(actual, options) {
+				t.Error("hashes differ after round trip")
+			}
+		})
+	}
+}
+
+const equalSource = `package p
+
+// f doubles x.
+func f(x int) int {
+	return x * 2
+}
+
+func g(x int) int {
+	return x * 2
+}
+
+func h(x int) int {
+	return x * 3
+}
+`
+
+func TestEqualOptions(t *testing.T) {
+	marshaller := NewMarshaller(Options{WithPositions: true, WithComments: true, WithReferences: true})
+	tree, _, err := parseForEncoding(marshaller.FileSet(), "equal.go", []byte(equalSource),
+		Options{WithComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := marshaller.MarshalFile(tree)
+	f := file.Decls[0].(*FuncDeclNode)
+	g := file.Decls[1].(*FuncDeclNode)
+	h := file.Decls[2].(*FuncDeclNode)
+
+	if !Equal(f.Type, g.Type, CompareOptions{}) || Hash(f.Type) != Hash(g.Type) {
+		t.Error("signatures expected to be equal")
+	}
+	if !Equal(f.Body, g.Body, CompareOptions{}) || Hash(f.Body) != Hash(g.Body) {
+		t.Error("bodies expected to be equal")
+	}
+	if Equal(f.Body, h.Body, CompareOptions{}) || Hash(f.Body) == Hash(h.Body) {
+		t.Error("bodies expected to differ")
+	}
+	if Equal(f.Body, g.Body, CompareOptions{WithPositions: true}) {
+		t.Error("positions expected to differ")
+	}
+	if Equal(f.Body, g.Body, CompareOptions{WithRefIds: true}) {
+		t.Error("reference ids expected to differ")
+	}
+
+	fNamed := *f
+	fNamed.Name = g.Name
+	if !Equal(&fNamed, g, CompareOptions{}) {
+		t.Error("declarations expected to be equal without comments")
+	}
+	if Equal(&fNamed, g, CompareOptions{WithComments: true}) {
+		t.Error("declarations expected to differ with comments")
+	}
+	if Equal(f, nil, CompareOptions{}) || !Equal(nil, nil, CompareOptions{}) {
+		t.Error("unexpected nil comparison")
+	}
+}
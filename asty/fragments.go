@@ -0,0 +1,158 @@
+package asty
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+)
+
+// Kinds of go source accepted by go2json.
+const (
+	KindFile  = "file"
+	KindExpr  = "expr"
+	KindStmts = "stmts"
+	KindDecls = "decls"
+)
+
+type fragmentWrapper struct {
+	prefix string
+	suffix string
+}
+
+// Statements and declarations are parsed inside a synthetic file. The suffix
+// starts with a newline in case the fragment ends with a line comment.
+var fragmentWrappers = map[string]fragmentWrapper{
+	KindStmts: {prefix: "package p; func _() {", suffix: "\n}"},
+	KindDecls: {prefix: "package p;", suffix: "\n"},
+}
+
+// EncodeFragment parses go source of the given kind and encodes it into an
+// Encoder ready to Flush. An expression is encoded as a single node, while
+// statements and declarations are encoded as arrays. Positions refer to the
+// fragment itself, not to the synthetic file it is parsed in.
+func EncodeFragment(filename string, src io.Reader, kind string, options Options) (*Encoder, error) {
+	if kind == KindFile || kind == "" {
+		return EncodeSource(filename, src, options)
+	}
+
+	err := checkPositionFormat(options.PositionFormat)
+	if err != nil {
+		return nil, err
+	}
+	if options.PositionFormat == PositionTable {
+		// The table is a field of the file, there is no place for it in
+		// fragments.
+		return nil, fmt.Errorf("%s position format is not supported for %s", PositionTable, kind)
+	}
+	if options.Tolerant {
+		// Partial trees and their Errors are fields of the file as well.
+		return nil, fmt.Errorf("tolerant parsing is not supported for %s", kind)
+	}
+
+	err = checkSourceSelection(options.WithSource)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	encoder := NewEncoder(options)
+	encoder.SetSource(data)
+	mode := parser.SkipObjectResolution
+	if options.WithComments || options.WithDirectives {
+		mode |= parser.ParseComments
+	}
+
+	if kind == KindExpr {
+		expr, err := parser.ParseExprFrom(encoder.FileSet(), filename, data, mode)
+		if err != nil {
+			return nil, err
+		}
+		encoder.EncodeExpr(expr)
+		if encoder.err != nil {
+			return nil, encoder.err
+		}
+		return encoder, nil
+	}
+
+	wrapper, ok := fragmentWrappers[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown kind: %s", kind)
+	}
+
+	// The synthetic file is parsed in its own file set. The fragment gets a
+	// file in the encoder file set whose base matches the position of the
+	// fragment in the synthetic file, so the same token.Pos values resolve to
+	// positions in the fragment.
+	scratch := token.NewFileSet()
+	fragment := encoder.FileSet().AddFile(filename, scratch.Base()+len(wrapper.prefix), len(data))
+	fragment.SetLinesForContent(data)
+
+	wrapped := wrapper.prefix + string(data) + wrapper.suffix
+	tree, err := parser.ParseFile(scratch, filename, wrapped, mode)
+	if err != nil {
+		return nil, fragmentError(err, fragment, len(wrapper.prefix))
+	}
+
+	switch kind {
+	case KindStmts:
+		body := tree.Decls[0].(*ast.FuncDecl).Body
+		encoder.EncodeStmts(append([]ast.Stmt{}, body.List...))
+	case KindDecls:
+		encoder.EncodeDecls(append([]ast.Decl{}, tree.Decls...))
+	}
+	if encoder.err != nil {
+		return nil, encoder.err
+	}
+	return encoder, nil
+}
+
+// fragmentError moves syntax error positions from the synthetic file to the
+// fragment.
+func fragmentError(err error, fragment *token.File, shift int) error {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return err
+	}
+	result := make(scanner.ErrorList, len(list))
+	for index, item := range list {
+		offset := item.Pos.Offset - shift
+		if offset < 0 {
+			offset = 0
+		} else if offset > fragment.Size() {
+			offset = fragment.Size()
+		}
+		result[index] = &scanner.Error{
+			Pos: fragment.Position(fragment.Pos(offset)),
+			Msg: item.Msg,
+		}
+	}
+	return result
+}
+
+func FragmentToJSON(input, output string, indent string, kind string, options Options) error {
+	inFile, closeIn, err := OpenRead(input)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	encoder, err := EncodeFragment(input, inFile, kind, options)
+	if err != nil {
+		return err
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	return encoder.Flush(outFile, indent)
+}
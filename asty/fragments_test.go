@@ -0,0 +1,157 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/scanner"
+	"strings"
+	"testing"
+)
+
+func encodeFragmentForTest(t *testing.T, kind, src string, options Options) []byte {
+	encoder, err := EncodeFragment("fragment.go", strings.NewReader(src), kind, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoder.Bytes()
+}
+
+func TestFragmentExpr(t *testing.T) {
+	data := encodeFragmentForTest(t, KindExpr, "a + b*c", Options{WithPositions: true})
+	node, err := NewDecoder(bytes.NewReader(data)).DecodeExpr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, ok := node.(*BinaryExprNode)
+	if !ok || binary.Op != "+" || binary.OpPos.Offset != 2 || binary.OpPos.Filename != "fragment.go" {
+		t.Errorf("unexpected expression %s", data)
+	}
+}
+
+func TestFragmentStmts(t *testing.T) {
+	data := encodeFragmentForTest(t, KindStmts, "x := 1\n\treturn x // done", Options{WithPositions: true})
+	var items []json.RawMessage
+	err := json.Unmarshal(data, &items)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("two statements expected, got %s", data)
+	}
+	stmt, err := NewDecoder(bytes.NewReader(items[1])).DecodeStmt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, ok := stmt.(*ReturnStmtNode)
+	if !ok || ret.Return.Offset != 8 || ret.Return.Line != 2 || ret.Return.Column != 2 {
+		t.Errorf("unexpected statement %s", items[1])
+	}
+
+	data = encodeFragmentForTest(t, KindStmts, "", Options{})
+	if string(data) != "[]" {
+		t.Errorf("empty list expected, got %s", data)
+	}
+}
+
+func TestFragmentDecls(t *testing.T) {
+	src := "import \"fmt\"\n\n// f prints.\nfunc f() { fmt.Println() }\n\nvar x int"
+	data := encodeFragmentForTest(t, KindDecls, src, Options{WithPositions: true, WithComments: true})
+	var items []json.RawMessage
+	err := json.Unmarshal(data, &items)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("three declarations expected, got %s", data)
+	}
+	decl, err := NewDecoder(bytes.NewReader(items[1])).DecodeDecl()
+	if err != nil {
+		t.Fatal(err)
+	}
+	funcDecl, ok := decl.(*FuncDeclNode)
+	if !ok || funcDecl.Doc == nil || funcDecl.Doc.List[0].Text != "// f prints." || funcDecl.Type.Func.Line != 4 {
+		t.Errorf("unexpected declaration %s", items[1])
+	}
+}
+
+func TestFragmentErrors(t *testing.T) {
+	_, err := EncodeFragment("fragment.go", strings.NewReader("x := 1\ny := "), KindStmts, Options{})
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 || list[0].Pos.Filename != "fragment.go" || list[0].Pos.Line != 2 {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	_, err = EncodeFragment("fragment.go", strings.NewReader("a +"), KindExpr, Options{})
+	if err == nil {
+		t.Error("error expected")
+	}
+
+	for _, options := range []Options{{PositionFormat: PositionTable}, {Tolerant: true}} {
+		_, err = EncodeFragment("fragment.go", strings.NewReader("a"), KindExpr, options)
+		if err == nil {
+			t.Errorf("%+v: error expected", options)
+		}
+	}
+
+	_, err = EncodeFragment("fragment.go", strings.NewReader("a"), "type", Options{})
+	if err == nil {
+		t.Error("error expected for unknown kind")
+	}
+
+	err = FragmentToJSON(InvalidGoFile, InvalidJsonFile, "", KindExpr, Options{})
+	if err == nil {
+		t.Error("error expected")
+	}
+}
+
+func printDocumentForTest(t *testing.T, document string, options Options) string {
+	fset, node, err := DecodeSource(strings.NewReader(document), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	err = FprintNode(&output, fset, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output.String()
+}
+
+func TestFragmentRoundTrip(t *testing.T) {
+	fragments := []struct {
+		kind string
+		src  string
+	}{
+		{KindExpr, "point{x: 1, y: f(2)}\n"},
+		{KindStmts, "x := 1\nif x > 0 {\n\treturn x\n}\n"},
+		{KindDecls, "func f() {\n\tg()\n}\n\nvar x int\n"},
+	}
+	for _, fragment := range fragments {
+		for _, options := range []Options{{}, {WithPositions: true, WithReferences: true}} {
+			data := encodeFragmentForTest(t, fragment.kind, fragment.src, options)
+			output := printDocumentForTest(t, string(data), options)
+			if output != fragment.src {
+				t.Errorf("%s %+v: unexpected output %q", fragment.kind, options, output)
+			}
+		}
+	}
+
+	mixed := `[{"NodeType": "Ident", "Name": "a"}, {"NodeType": "ValueSpec",
+		"Names": [{"NodeType": "Ident", "Name": "b"}], "Type": {"NodeType": "Ident", "Name": "int"}}]`
+	if output := printDocumentForTest(t, mixed, Options{}); output != "a\nb int\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+	if output := printDocumentForTest(t, " []", Options{}); output != "" {
+		t.Errorf("unexpected output %q", output)
+	}
+}
+
+func TestDecodeSourceErrors(t *testing.T) {
+	documents := []string{
+		``,
+		`null`,
+		`[null]`,
+		`{"NodeType": "Field"}`,
+		`[{"NodeType": "Unknown"}]`,
+	}
+	for _, document := range documents {
+		_, _, err := DecodeSource(strings.NewReader(document), Options{})
+		if err == nil {
+			t.Errorf("error expected for %q", document)
+		}
+	}
+}
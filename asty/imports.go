@@ -0,0 +1,336 @@
+package asty
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FixImports adds missing standard library imports to file and removes unused
+// ones, judging by the package qualifiers of selector expressions. Qualifiers
+// declared in the file as anything else are left alone, as are blank, dot and
+// cgo imports and imports of packages outside of GOROOT without an explicit
+// name. New imports go into the first import declaration. File.Imports is
+// rebuilt when withImports is set.
+func FixImports(file *FileNode, withImports bool) {
+	used := make(map[string][]string)
+	declared := make(map[string]bool)
+	Inspect(file, func(node INode) bool {
+		switch n := node.(type) {
+		case *SelectorExprNode:
+			if ident, ok := n.X.(*IdentNode); ok && n.Sel != nil {
+				used[ident.Name] = append(used[ident.Name], n.Sel.Name)
+			}
+		case *FieldNode:
+			declareIdents(declared, n.Names)
+		case *ValueSpecNode:
+			declareIdents(declared, n.Names)
+		case *TypeSpecNode:
+			declareIdents(declared, []*IdentNode{n.Name})
+		case *FuncDeclNode:
+			if n.Recv == nil {
+				declareIdents(declared, []*IdentNode{n.Name})
+			}
+		case *AssignStmtNode:
+			if n.Tok == token.DEFINE.String() {
+				declareExprs(declared, n.Lhs)
+			}
+		case *RangeStmtNode:
+			if n.Tok == token.DEFINE.String() {
+				declareExprs(declared, []IExprNode{n.Key, n.Value})
+			}
+		}
+		return true
+	})
+
+	imported := make(map[string]bool)
+	var first *GenDeclNode
+	decls := file.Decls[:0]
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*GenDeclNode)
+		if !ok || gen.Tok != token.IMPORT.String() {
+			decls = append(decls, decl)
+			continue
+		}
+		specs := gen.Specs[:0]
+		for _, spec := range gen.Specs {
+			name, known := importName(spec.(*ImportSpecNode))
+			if known && used[name] == nil {
+				removeComments(file, spec.(*ImportSpecNode).Doc, spec.(*ImportSpecNode).Comment)
+				continue
+			}
+			imported[name] = true
+			specs = append(specs, spec)
+		}
+		gen.Specs = specs
+		if len(specs) == 0 {
+			removeComments(file, gen.Doc)
+			continue
+		}
+		if first == nil {
+			first = gen
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+
+	var missing []string
+	for name, selectors := range used {
+		if imported[name] || declared[name] {
+			continue
+		}
+		if path := stdlibPackage(name, selectors); path != "" {
+			missing = append(missing, path)
+		}
+	}
+	sort.Strings(missing)
+	if len(missing) > 0 && first == nil {
+		first = &GenDeclNode{Node: Node{NodeType: "GenDecl"}, Tok: token.IMPORT.String(), Specs: []ISpecNode{}}
+		file.Decls = append([]IDeclNode{first}, file.Decls...)
+	}
+	for _, path := range missing {
+		spec := &ImportSpecNode{
+			Node: Node{NodeType: "ImportSpec"},
+			Path: &BasicLitNode{Node: Node{NodeType: "BasicLit"}, Kind: token.STRING.String(), Value: strconv.Quote(path)},
+		}
+		// Imports are kept sorted when they are.
+		index := len(first.Specs)
+		for index > 0 && importPath(first.Specs[index-1].(*ImportSpecNode)) > path {
+			index--
+		}
+		// A new import shares the position of its neighbour, so the printer
+		// does not see a gap between them.
+		neighbour := index
+		if neighbour == len(first.Specs) {
+			neighbour--
+		}
+		if neighbour >= 0 {
+			if path := first.Specs[neighbour].(*ImportSpecNode).Path; path != nil && path.ValuePos != nil {
+				position := *path.ValuePos
+				spec.Path.ValuePos = &position
+			}
+		}
+		first.Specs = append(first.Specs[:index], append([]ISpecNode{spec}, first.Specs[index:]...)...)
+	}
+
+	if withImports {
+		file.Imports = nil
+		for _, decl := range file.Decls {
+			if gen, ok := decl.(*GenDeclNode); ok && gen.Tok == token.IMPORT.String() {
+				for _, spec := range gen.Specs {
+					file.Imports = append(file.Imports, spec.(*ImportSpecNode))
+				}
+			}
+		}
+	}
+}
+
+func declareIdents(declared map[string]bool, idents []*IdentNode) {
+	for _, ident := range idents {
+		if ident != nil {
+			declared[ident.Name] = true
+		}
+	}
+}
+
+func declareExprs(declared map[string]bool, exprs []IExprNode) {
+	for _, expr := range exprs {
+		if ident, ok := expr.(*IdentNode); ok {
+			declared[ident.Name] = true
+		}
+	}
+}
+
+func importPath(spec *ImportSpecNode) string {
+	if spec.Path == nil {
+		return ""
+	}
+	path, err := strconv.Unquote(spec.Path.Value)
+	if err != nil {
+		return spec.Path.Value
+	}
+	return path
+}
+
+// importName returns the name an import is referred to by, and whether it is
+// known well enough to remove the import when the name is not used.
+func importName(spec *ImportSpecNode) (string, bool) {
+	path := importPath(spec)
+	if spec.Name != nil {
+		switch spec.Name.Name {
+		case "_", ".":
+			return spec.Name.Name, false
+		}
+		return spec.Name.Name, true
+	}
+	if path == "C" {
+		return path, false
+	}
+	for name, paths := range stdlibIndex() {
+		for _, item := range paths {
+			if item == path {
+				return name, true
+			}
+		}
+	}
+	return filepath.Base(path), false
+}
+
+// removeComments drops the comments of a removed import from the comments of
+// the file, so they are not printed without it.
+func removeComments(file *FileNode, groups ...*CommentGroupNode) {
+	comments := file.Comments[:0]
+	for _, group := range file.Comments {
+		removed := false
+		for _, other := range groups {
+			removed = removed || sameComment(group, other)
+		}
+		if !removed {
+			comments = append(comments, group)
+		}
+	}
+	file.Comments = comments
+}
+
+func sameComment(group, other *CommentGroupNode) bool {
+	if group == nil || other == nil {
+		return false
+	}
+	if group == other {
+		return true
+	}
+	// Decoded without references, the groups are copies found by position.
+	return len(other.List) > 0 && other.List[0].Slash != nil &&
+		Equal(group, other, CompareOptions{WithPositions: true, WithComments: true})
+}
+
+var (
+	stdlibOnce     sync.Once
+	stdlibPackages map[string][]string
+	stdlibExports  sync.Map
+)
+
+// stdlibIndex maps package names to the import paths of the standard library
+// packages in GOROOT, assuming names follow the last path element.
+func stdlibIndex() map[string][]string {
+	stdlibOnce.Do(func() {
+		stdlibPackages = make(map[string][]string)
+		root := filepath.Join(build.Default.GOROOT, "src")
+		_ = filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+			if err != nil || !entry.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil || rel == "." {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			switch entry.Name() {
+			case "internal", "vendor", "testdata", "cmd":
+				return filepath.SkipDir
+			}
+			name := importPathName(rel)
+			stdlibPackages[name] = append(stdlibPackages[name], rel)
+			return nil
+		})
+	})
+	return stdlibPackages
+}
+
+// importPathName guesses the name of a package from its import path, the
+// last element not being a major version.
+func importPathName(path string) string {
+	elements := strings.Split(path, "/")
+	name := elements[len(elements)-1]
+	if len(elements) > 1 && isMajorVersion(name) {
+		name = elements[len(elements)-2]
+	}
+	return name
+}
+
+func isMajorVersion(element string) bool {
+	if len(element) < 2 || element[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(element[1:])
+	return err == nil
+}
+
+// stdlibPackage finds the standard library package called name exporting all
+// the selectors. Shorter paths win between packages exporting them all.
+func stdlibPackage(name string, selectors []string) string {
+	paths := append([]string(nil), stdlibIndex()[name]...)
+	sort.Slice(paths, func(i, j int) bool {
+		if len(paths[i]) != len(paths[j]) {
+			return len(paths[i]) < len(paths[j])
+		}
+		return paths[i] < paths[j]
+	})
+	for _, path := range paths {
+		exports := stdlibPackageExports(path, name)
+		found := exports != nil
+		for _, selector := range selectors {
+			found = found && exports[selector]
+		}
+		if found {
+			return path
+		}
+	}
+	return ""
+}
+
+// stdlibPackageExports returns the exported top level names of a standard
+// library package, or nil if the package is not called name.
+func stdlibPackageExports(path, name string) map[string]bool {
+	if exports, ok := stdlibExports.Load(path); ok {
+		return exports.(map[string]bool)
+	}
+	var exports map[string]bool
+	pkg, err := build.Default.Import(path, "", 0)
+	if err == nil && pkg.Name == name {
+		exports = make(map[string]bool)
+		fset := token.NewFileSet()
+		for _, filename := range pkg.GoFiles {
+			tree, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, filename), nil, parser.SkipObjectResolution)
+			if err != nil {
+				continue
+			}
+			for _, decl := range tree.Decls {
+				exportedNames(exports, decl)
+			}
+		}
+	}
+	stdlibExports.Store(path, exports)
+	return exports
+}
+
+func exportedNames(exports map[string]bool, decl ast.Decl) {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv == nil && d.Name.IsExported() {
+			exports[d.Name.Name] = true
+		}
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				if s.Name.IsExported() {
+					exports[s.Name.Name] = true
+				}
+			case *ast.ValueSpec:
+				for _, ident := range s.Names {
+					if ident.IsExported() {
+						exports[ident.Name] = true
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package asty
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFixImports(t *testing.T) {
+	src := `package main
+
+import (
+	"fmt" // printing
+	"os"
+)
+
+func main() {
+	s := strings.TrimSpace(os.Args[0])
+	rand.Intn(3)
+	println(s)
+}
+`
+	expected := `package main
+
+import (
+	"math/rand"
+	"os"
+	"strings"
+)
+
+func main() {
+	s := strings.TrimSpace(os.Args[0])
+	rand.Intn(3)
+	println(s)
+}
+`
+	for _, options := range []Options{
+		{WithPositions: true, WithComments: true, FixImports: true},
+		{WithPositions: true, WithComments: true, WithReferences: true, FixImports: true},
+		{FixImports: true},
+	} {
+		result := printSourceForTest(t, src, options)
+		if result != expected {
+			t.Errorf("%+v: expected\n%s\ngot\n%s", options, expected, result)
+		}
+	}
+}
+
+func TestFixImportsDeclaration(t *testing.T) {
+	src := "package main\n\nfunc main() {\n\tfmt.Println(1)\n}\n"
+	result := printSourceForTest(t, src, Options{WithPositions: true, FixImports: true})
+	if !strings.HasPrefix(result, "package main\n\nimport \"fmt\"\n\nfunc main() {") {
+		t.Errorf("new import declaration expected, got\n%s", result)
+	}
+
+	src = "package main\n\nimport \"fmt\"\n\nfunc main() {\n}\n"
+	result = printSourceForTest(t, src, Options{WithPositions: true, FixImports: true})
+	if result != "package main\n\nfunc main() {\n}\n" {
+		t.Errorf("import declaration removal expected, got\n%s", result)
+	}
+}
+
+func TestFixImportsKept(t *testing.T) {
+	// Blank, dot and unknown imports are kept, local names are not packages.
+	src := `package main
+
+import (
+	_ "embed"
+	. "math"
+	"example.com/lib"
+)
+
+type strings struct{}
+
+func (strings) Len() int {
+	return 0
+}
+
+func main() {
+	var rand strings
+	rand.Len()
+	println(Pi)
+}
+`
+	options := Options{WithPositions: true, WithImports: true, FixImports: true}
+	result := printSourceForTest(t, src, options)
+	if result != src {
+		t.Errorf("unchanged file expected, got\n%s", result)
+	}
+
+	encoder, err := EncodeSource("main.go", strings.NewReader(src), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := NewDecoder(bytes.NewReader(encoder.Bytes())).DecodeFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without uses the imports are still kept, and listed in File.Imports.
+	file.Decls = file.Decls[:1]
+	file.Imports = nil
+	FixImports(file, true)
+	if len(file.Decls) != 1 || len(file.Imports) != 3 || importPath(file.Imports[2]) != "example.com/lib" {
+		t.Errorf("kept imports expected, got %d declarations and %d imports", len(file.Decls), len(file.Imports))
+	}
+}
+
+func TestStdlibPackage(t *testing.T) {
+	cases := map[string][]string{
+		"math/rand":     {"rand", "Intn"},
+		"crypto/rand":   {"rand", "Reader"},
+		"html/template": {"template", "HTMLEscapeString", "New"},
+		"":              {"strings", "Unknown"},
+	}
+	for expected, query := range cases {
+		path := stdlibPackage(query[0], query[1:])
+		if path != expected {
+			t.Errorf("%v: %q expected, got %q", query, expected, path)
+		}
+	}
+}
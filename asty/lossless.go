@@ -0,0 +1,716 @@
+package asty
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+type spliceEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// splicer compares a file with the file parsed from its original source and
+// records edits replacing the source of changed subtrees only.
+type splicer struct {
+	config   *printer.Config
+	fset     *token.FileSet
+	tree     *ast.File
+	nodes    map[INode]ast.Node
+	original *token.File
+	src      []byte
+	sources  map[INode]ast.Node
+	owned    map[string]bool
+	edits    []spliceEdit
+}
+
+// SpliceSource prints file re-using the original source it was converted
+// from. Subtrees equal to the original are copied verbatim, keeping their
+// formatting, while changed ones are re-printed by go/printer. Statements,
+// specs and declarations inserted into lists or removed from them are spliced
+// at their own lines, other changes of a list re-print the enclosing node.
+// Printing options apply to re-printed nodes, Gofmt to the whole result.
+func SpliceSource(src []byte, filename string, file *FileNode, options Options) ([]byte, error) {
+	config, err := printerConfig(options)
+	if err != nil {
+		return nil, err
+	}
+	marshaller := NewMarshaller(options)
+	mode := parser.SkipObjectResolution
+	if options.WithComments {
+		mode |= parser.ParseComments
+	}
+	originalTree, err := parser.ParseFile(marshaller.FileSet(), filename, src, mode)
+	if err != nil {
+		return nil, err
+	}
+	originalFile := marshaller.MarshalFile(originalTree)
+
+	unmarshaller := NewUnmarshaller(options)
+	tree := unmarshaller.UnmarshalFileNode(file)
+	s := &splicer{
+		config:   config,
+		fset:     unmarshaller.FileSet(),
+		tree:     tree,
+		nodes:    pairNodes(file, tree),
+		original: marshaller.FileSet().File(originalTree.FileStart),
+		src:      src,
+		sources:  pairNodes(originalFile, originalTree),
+		owned:    ownedCommentKeys(file),
+	}
+
+	var result []byte
+	if s.diff(file, originalFile) {
+		result = s.apply()
+	} else {
+		var output bytes.Buffer
+		err = config.Fprint(&output, s.fset, tree)
+		if err != nil {
+			return nil, err
+		}
+		result = output.Bytes()
+	}
+	if options.Gofmt {
+		return gofmtSource(result)
+	}
+	return result, nil
+}
+
+// pairNodes maps node structs to the go/ast nodes they were converted from or
+// to, comment groups of the file included.
+func pairNodes(file *FileNode, tree *ast.File) map[INode]ast.Node {
+	result := make(map[INode]ast.Node)
+	inspectWithAST(file, tree, func(path []Step, node ast.Node) bool {
+		result[path[len(path)-1].Node] = node
+		return true
+	})
+	if len(file.Comments) == len(tree.Comments) {
+		for index, group := range file.Comments {
+			result[group] = tree.Comments[index]
+		}
+	}
+	return result
+}
+
+type spliceField struct {
+	name     string
+	list     bool
+	children []INode
+}
+
+// spliceFields groups the children compared by the splicer by field. Imports
+// of a file repeat the import specs of its declarations and are skipped.
+func spliceFields(node INode) []*spliceField {
+	var result []*spliceField
+	walkChildren(node, func(field string, index int, child INode) {
+		if _, ok := node.(*FileNode); ok && field == "Imports" {
+			return
+		}
+		if len(result) == 0 || result[len(result)-1].name != field {
+			result = append(result, &spliceField{name: field, list: index >= 0})
+		}
+		last := result[len(result)-1]
+		last.children = append(last.children, child)
+	})
+	return result
+}
+
+func spliceValues(node INode) []string {
+	var result []string
+	walkValues(node, func(field string, value string) {
+		result = append(result, field, value)
+	})
+	return result
+}
+
+// diff records edits turning the original source of original into the source
+// of node. It reports false if node can not be printed on its own, leaving the
+// change to its parent.
+func (s *splicer) diff(node, original INode) bool {
+	if Equal(node, original, CompareOptions{WithComments: true}) {
+		return true
+	}
+	if nodeTypeOf(node) == nodeTypeOf(original) &&
+		strings.Join(spliceValues(node), "\x00") == strings.Join(spliceValues(original), "\x00") {
+		edits := len(s.edits)
+		if s.diffChildren(node, original) {
+			return true
+		}
+		s.edits = s.edits[:edits]
+	}
+	return s.replace(node, original)
+}
+
+func (s *splicer) diffChildren(node, original INode) bool {
+	fields := make(map[string]*spliceField)
+	for _, field := range spliceFields(node) {
+		fields[field.name] = field
+	}
+	originalFields := make(map[string]*spliceField)
+	var names []string
+	for _, field := range spliceFields(original) {
+		originalFields[field.name] = field
+		names = append(names, field.name)
+	}
+	for _, field := range spliceFields(node) {
+		if originalFields[field.name] == nil {
+			names = append(names, field.name)
+		}
+	}
+
+	for _, name := range names {
+		field, originalField := fields[name], originalFields[name]
+		var children, originals []INode
+		list := false
+		if field != nil {
+			children, list = field.children, field.list
+		}
+		if originalField != nil {
+			originals, list = originalField.children, list || originalField.list
+		}
+		if len(children) == len(originals) {
+			for index, child := range children {
+				if !s.diff(child, originals[index]) {
+					return false
+				}
+			}
+			continue
+		}
+		if !list || !s.diffList(original, children, originals) {
+			return false
+		}
+	}
+	return true
+}
+
+// spliceItem tells whether list items of node are edited one by one, which
+// is done for statements, specs, declarations and comments of a file, since
+// they take lines of their own.
+func spliceItem(node INode) bool {
+	switch node.(type) {
+	case IStmtNode, ISpecNode, IDeclNode, *CommentGroupNode:
+		return true
+	}
+	return false
+}
+
+// diffList records edits for a list whose items were inserted or removed.
+// Items equal to the original ones are kept verbatim, changed items are
+// diffed, and inserted or removed items are spliced at their own lines.
+func (s *splicer) diffList(parent INode, children, originals []INode) bool {
+	for _, item := range append(append([]INode(nil), children...), originals...) {
+		if !spliceItem(item) {
+			return false
+		}
+	}
+	if decl, ok := s.sources[parent].(*ast.GenDecl); ok && !decl.Lparen.IsValid() {
+		// Specs of a declaration without parentheses can not be added or
+		// removed alone.
+		return false
+	}
+	comments := false
+	for _, item := range append(append([]INode(nil), children...), originals...) {
+		if _, ok := item.(*CommentGroupNode); ok {
+			comments = true
+		}
+	}
+	_, file := parent.(*FileNode)
+	decls := file && !comments
+
+	equal := func(i, j int) bool {
+		return Equal(children[i], originals[j], CompareOptions{WithComments: true})
+	}
+	matches := matchItems(len(children), len(originals), equal)
+
+	// Unmatched items between two matches are paired and diffed, the rest is
+	// inserted after the previous original item or removed.
+	previous := -1
+	i, j := 0, 0
+	for index := 0; index <= len(matches); index++ {
+		nextI, nextJ := len(children), len(originals)
+		if index < len(matches) {
+			nextI, nextJ = matches[index][0], matches[index][1]
+		}
+		for i < nextI && j < nextJ {
+			if !s.diff(children[i], originals[j]) {
+				return false
+			}
+			previous = j
+			i++
+			j++
+		}
+		if i < nextI {
+			if comments {
+				if !s.ownedComments(children[i:nextI]) {
+					return false
+				}
+			} else if !s.insert(children[i:nextI], originals, previous, nextJ, decls) {
+				return false
+			}
+		}
+		for ; j < nextJ; j++ {
+			if !s.remove(originals[j]) {
+				return false
+			}
+		}
+		i, j = nextI+1, nextJ+1
+		previous = nextJ
+	}
+	return true
+}
+
+// matchItems pairs equal items of two lists, keeping their order. Common
+// prefixes and suffixes are matched directly, the rest by the longest common
+// subsequence.
+func matchItems(n, m int, equal func(i, j int) bool) [][2]int {
+	var result [][2]int
+	prefix := 0
+	for prefix < n && prefix < m && equal(prefix, prefix) {
+		result = append(result, [2]int{prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && equal(n-1-suffix, m-1-suffix) {
+		suffix++
+	}
+
+	rows, columns := n-prefix-suffix, m-prefix-suffix
+	lengths := make([][]int, rows+1)
+	for row := range lengths {
+		lengths[row] = make([]int, columns+1)
+	}
+	for row := rows - 1; row >= 0; row-- {
+		for column := columns - 1; column >= 0; column-- {
+			if equal(prefix+row, prefix+column) {
+				lengths[row][column] = lengths[row+1][column+1] + 1
+			} else if lengths[row+1][column] >= lengths[row][column+1] {
+				lengths[row][column] = lengths[row+1][column]
+			} else {
+				lengths[row][column] = lengths[row][column+1]
+			}
+		}
+	}
+	for row, column := 0, 0; row < rows && column < columns; {
+		switch {
+		case equal(prefix+row, prefix+column):
+			result = append(result, [2]int{prefix + row, prefix + column})
+			row++
+			column++
+		case lengths[row+1][column] >= lengths[row][column+1]:
+			row++
+		default:
+			column++
+		}
+	}
+
+	for index := suffix; index > 0; index-- {
+		result = append(result, [2]int{n - index, m - index})
+	}
+	return result
+}
+
+func (s *splicer) replace(node, original INode) bool {
+	astNode, originalNode := s.nodes[node], s.sources[original]
+	if astNode == nil || originalNode == nil {
+		return false
+	}
+	start, end := spliceExtent(originalNode)
+	if !start.IsValid() || !end.IsValid() {
+		return false
+	}
+	edit := spliceEdit{start: s.original.Offset(start), end: s.original.Offset(end)}
+
+	var text string
+	switch n := astNode.(type) {
+	case *ast.CommentGroup:
+		comments := make([]string, len(n.List))
+		for index, comment := range n.List {
+			comments[index] = comment.Text
+		}
+		text = strings.Join(comments, "\n")
+	case ast.Expr, ast.Stmt, ast.Spec, ast.Decl:
+		var err error
+		text, err = s.print(astNode)
+		if err != nil {
+			return false
+		}
+	default:
+		return false
+	}
+
+	// go/printer starts at column zero, so lines after the first one get the
+	// indentation of the line the original node starts at.
+	edit.text = indentLines(text, s.indent(edit.start))
+	s.edits = append(s.edits, edit)
+	return true
+}
+
+// printItem prints a new list item the way replace does.
+func (s *splicer) printItem(node INode) (string, bool) {
+	astNode := s.nodes[node]
+	if astNode == nil {
+		return "", false
+	}
+	text, err := s.print(astNode)
+	if err != nil {
+		return "", false
+	}
+	return text, true
+}
+
+// insert records an edit inserting items after the original item at previous,
+// or before the one at next when they go first. Declarations are separated by
+// blank lines, other items start lines of their own.
+func (s *splicer) insert(items, originals []INode, previous, next int, decls bool) bool {
+	separator := "\n"
+	if decls {
+		separator = "\n\n"
+	}
+	var anchor int
+	after := previous >= 0
+	if after {
+		_, end, ok := s.extent(originals[previous])
+		if !ok {
+			return false
+		}
+		// Items go after the line of the previous one, behind its trailing
+		// comments, which must be all that is left on the line.
+		anchor = s.lineEnd(end)
+		if anchor < 0 {
+			return false
+		}
+	} else {
+		if next >= len(originals) {
+			return false
+		}
+		start, _, ok := s.extent(originals[next])
+		if !ok {
+			return false
+		}
+		anchor = s.lineStart(start)
+		if anchor < 0 {
+			return false
+		}
+		// Comments right above the next item stay attached to it.
+		for anchor > 0 {
+			line := s.lineBegin(anchor - 1)
+			if !strings.HasPrefix(strings.TrimSpace(string(s.src[line:anchor])), "//") {
+				break
+			}
+			anchor = line
+		}
+	}
+
+	indent := s.indent(anchor)
+	texts := make([]string, len(items))
+	for index, item := range items {
+		text, ok := s.printItem(item)
+		if !ok {
+			return false
+		}
+		texts[index] = indent + indentLines(text, indent)
+	}
+	text := strings.Join(texts, separator)
+	if after {
+		text = separator + text
+	} else {
+		text += separator
+	}
+	s.edits = append(s.edits, spliceEdit{start: anchor, end: anchor, text: text})
+	return true
+}
+
+// remove records an edit removing the lines of an original item, which must
+// not share them with other code, except for comments. A blank line left next to another one, or
+// at the start or the end of a block, is removed as well.
+func (s *splicer) remove(original INode) bool {
+	start, end, ok := s.extent(original)
+	if !ok {
+		return false
+	}
+	lineStart, lineEnd := s.lineStart(start), s.lineEnd(end)
+	if _, ok := original.(*CommentGroupNode); ok && (lineStart < 0 || lineEnd < 0) {
+		// Comments sharing lines with code are cut along with the spaces
+		// before them.
+		for start > 0 && (s.src[start-1] == ' ' || s.src[start-1] == '\t') {
+			start--
+		}
+		s.edits = append(s.edits, spliceEdit{start: start, end: end})
+		return true
+	}
+	start, end = lineStart, lineEnd
+	if start < 0 || end < 0 {
+		return false
+	}
+	if end < len(s.src) {
+		end++
+	}
+
+	previousStart, previousLine := -1, ""
+	if start > 0 {
+		previousStart = s.lineBegin(start - 1)
+		previousLine = strings.TrimSpace(string(s.src[previousStart:start]))
+	}
+	nextEnd := len(s.src)
+	if index := bytes.IndexByte(s.src[end:], '\n'); index >= 0 {
+		nextEnd = end + index
+	}
+	nextLine := strings.TrimSpace(string(s.src[end:nextEnd]))
+	previousBlank := previousStart >= 0 && previousLine == ""
+	nextBlank := nextEnd < len(s.src) && nextLine == ""
+	switch {
+	case previousBlank && nextBlank:
+		end = nextEnd + 1
+	case previousBlank && (end == len(s.src) || strings.HasPrefix(nextLine, "}") || strings.HasPrefix(nextLine, ")")):
+		start = previousStart
+	case nextBlank && (strings.HasSuffix(previousLine, "{") || strings.HasSuffix(previousLine, "(")):
+		end = nextEnd + 1
+	}
+	s.edits = append(s.edits, spliceEdit{start: start, end: end})
+	return true
+}
+
+// ownedComments tells whether inserted comment groups of the file are doc or
+// line comments of nodes, which print them.
+func (s *splicer) ownedComments(groups []INode) bool {
+	for _, group := range groups {
+		if !s.owned[commentKey(group.(*CommentGroupNode))] {
+			return false
+		}
+	}
+	return true
+}
+
+func commentKey(group *CommentGroupNode) string {
+	texts := make([]string, len(group.List))
+	for index, comment := range group.List {
+		texts[index] = comment.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// ownedCommentKeys lists comment groups of file held by nodes rather than by
+// the file only.
+func ownedCommentKeys(file *FileNode) map[string]bool {
+	result := make(map[string]bool)
+	InspectPath(file, func(path []Step) bool {
+		step := path[len(path)-1]
+		group, ok := step.Node.(*CommentGroupNode)
+		if ok && !(len(path) == 2 && step.Field == "Comments") {
+			result[commentKey(group)] = true
+		}
+		return !ok
+	})
+	return result
+}
+
+// extent returns the offsets of the original source of an original node.
+func (s *splicer) extent(original INode) (int, int, bool) {
+	node := s.sources[original]
+	if node == nil {
+		return 0, 0, false
+	}
+	start, end := spliceExtent(node)
+	if !start.IsValid() || !end.IsValid() {
+		return 0, 0, false
+	}
+	return s.original.Offset(start), s.original.Offset(end), true
+}
+
+// lineBegin returns the start of the line of offset.
+func (s *splicer) lineBegin(offset int) int {
+	for offset > 0 && s.src[offset-1] != '\n' {
+		offset--
+	}
+	return offset
+}
+
+// lineStart returns the start of the line of offset, or -1 if the line has
+// more than whitespace before offset.
+func (s *splicer) lineStart(offset int) int {
+	line := s.lineBegin(offset)
+	if strings.TrimSpace(string(s.src[line:offset])) != "" {
+		return -1
+	}
+	return line
+}
+
+// lineEnd returns the offset of the newline ending the line of offset, or of
+// the end of the source, or -1 if the line has more than whitespace and
+// comments after offset.
+func (s *splicer) lineEnd(offset int) int {
+	for offset < len(s.src) {
+		switch {
+		case s.src[offset] == '\n':
+			return offset
+		case s.src[offset] == ' ' || s.src[offset] == '\t' || s.src[offset] == '\r':
+			offset++
+		case bytes.HasPrefix(s.src[offset:], []byte("//")):
+			index := bytes.IndexByte(s.src[offset:], '\n')
+			if index < 0 {
+				return len(s.src)
+			}
+			return offset + index
+		case bytes.HasPrefix(s.src[offset:], []byte("/*")):
+			index := bytes.Index(s.src[offset+2:], []byte("*/"))
+			if index < 0 {
+				return -1
+			}
+			offset += index + 4
+		default:
+			return -1
+		}
+	}
+	return offset
+}
+
+// indent returns the indentation of the line of offset.
+func (s *splicer) indent(offset int) string {
+	line := s.lineBegin(offset)
+	indent := line
+	for indent < len(s.src) && (s.src[indent] == ' ' || s.src[indent] == '\t') {
+		indent++
+	}
+	return string(s.src[line:indent])
+}
+
+// indentLines indents the lines of text after the first one.
+func indentLines(text, indent string) string {
+	lines := strings.Split(text, "\n")
+	for index := 1; index < len(lines); index++ {
+		if lines[index] != "" {
+			lines[index] = indent + lines[index]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// print prints a node along with the comments of the file inside it.
+func (s *splicer) print(node ast.Node) (string, error) {
+	start, end := spliceExtent(node)
+	var comments []*ast.CommentGroup
+	if start.IsValid() {
+		for _, group := range s.tree.Comments {
+			if group.Pos() >= start && group.End() <= end {
+				comments = append(comments, group)
+			}
+		}
+	}
+	var printed any = node
+	if comments != nil {
+		printed = &printer.CommentedNode{Node: node, Comments: comments}
+	}
+	var output bytes.Buffer
+	err := s.config.Fprint(&output, s.fset, printed)
+	if err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+// spliceExtent returns the span of a node including doc and line comments,
+// which go/printer prints along with the node.
+func spliceExtent(node ast.Node) (token.Pos, token.Pos) {
+	var doc, comment *ast.CommentGroup
+	switch n := node.(type) {
+	case *ast.FuncDecl:
+		doc = n.Doc
+	case *ast.GenDecl:
+		doc = n.Doc
+	case *ast.ImportSpec:
+		doc, comment = n.Doc, n.Comment
+	case *ast.ValueSpec:
+		doc, comment = n.Doc, n.Comment
+	case *ast.TypeSpec:
+		doc, comment = n.Doc, n.Comment
+	}
+	start, end := node.Pos(), node.End()
+	if doc != nil && doc.Pos().IsValid() {
+		start = doc.Pos()
+	}
+	if comment != nil && comment.End().IsValid() {
+		end = comment.End()
+	}
+	return start, end
+}
+
+// apply applies the edits to the original source. Edits inside other edits,
+// like comment groups of re-printed declarations, are dropped.
+func (s *splicer) apply() []byte {
+	sort.SliceStable(s.edits, func(i, j int) bool {
+		if s.edits[i].start != s.edits[j].start {
+			return s.edits[i].start < s.edits[j].start
+		}
+		return s.edits[i].end > s.edits[j].end
+	})
+	var output bytes.Buffer
+	last := 0
+	for _, edit := range s.edits {
+		if edit.start < last {
+			continue
+		}
+		output.Write(s.src[last:edit.start])
+		output.WriteString(edit.text)
+		last = edit.end
+	}
+	output.Write(s.src[last:])
+	return output.Bytes()
+}
+
+// JSONToSourceLossless converts a file document back into go source with
+// SpliceSource. The original source is read from original, or from the file
+// named in the FileSet of the document.
+func JSONToSourceLossless(input, output, original string, options Options) error {
+	inFile, closeIn, err := OpenRead(input)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	node, err := NewDecoder(bufio.NewReader(inFile)).DecodeNode()
+	if err != nil {
+		return err
+	}
+	file, ok := node.(*FileNode)
+	if !ok {
+		return errors.New("lossless mode needs a File document")
+	}
+	if options.FixImports {
+		FixImports(file, options.WithImports)
+	}
+	if original == "" {
+		file.FileSet.Iterate(func(f *token.File) bool {
+			original = f.Name()
+			return false
+		})
+	}
+	if original == "" {
+		return errors.New("lossless mode needs the original file, the document has no FileSet")
+	}
+	src, err := os.ReadFile(original)
+	if err != nil {
+		return err
+	}
+
+	result, err := SpliceSource(src, original, file, options)
+	if err != nil {
+		return err
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+	_, err = outFile.Write(result)
+	return err
+}
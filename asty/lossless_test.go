@@ -0,0 +1,249 @@
+package asty
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const losslessSource = `package main
+
+import "fmt"
+
+// f prints x.
+func f(x int) int {
+	fmt.Println( "x" ,  x )
+	if x > 0   {
+		return x *   2
+	}
+	return 0
+}
+`
+
+func decodeForSplicing(t *testing.T, src string, options Options) *FileNode {
+	encoder, err := EncodeSource("main.go", strings.NewReader(src), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := NewDecoder(bytes.NewReader(encoder.Bytes())).DecodeFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func spliceForTest(t *testing.T, file *FileNode, options Options) string {
+	result, err := SpliceSource([]byte(losslessSource), "main.go", file, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(result)
+}
+
+func TestSpliceUnchanged(t *testing.T) {
+	options := Options{WithPositions: true, WithComments: true}
+	file := decodeForSplicing(t, losslessSource, options)
+	result := spliceForTest(t, file, options)
+	if result != losslessSource {
+		t.Errorf("unchanged file expected, got\n%s", result)
+	}
+}
+
+func TestSpliceEdits(t *testing.T) {
+	options := Options{WithPositions: true, WithComments: true}
+	file := decodeForSplicing(t, losslessSource, options)
+	body := file.Decls[1].(*FuncDeclNode).Body
+	body.List[0].(*ExprStmtNode).X.(*CallExprNode).Args[0].(*BasicLitNode).Value = `"value"`
+	file.Comments[0].List[0].Text = "// f prints x twice."
+
+	result := spliceForTest(t, file, options)
+	expected := strings.NewReplacer(`"x" ,`, `"value" ,`, "prints x.", "prints x twice.").Replace(losslessSource)
+	if result != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, result)
+	}
+}
+
+func TestSpliceInsertion(t *testing.T) {
+	options := Options{WithPositions: true, WithComments: true}
+	file := decodeForSplicing(t, losslessSource, options)
+	body := file.Decls[1].(*FuncDeclNode).Body
+	block := body.List[1].(*IfStmtNode).Body
+	call := &ExprStmtNode{
+		Node: Node{NodeType: "ExprStmt"},
+		X: &CallExprNode{
+			Node: Node{NodeType: "CallExpr"},
+			Fun:  &IdentNode{Node: Node{NodeType: "Ident"}, Name: "println"},
+			Args: []IExprNode{&IdentNode{Node: Node{NodeType: "Ident"}, Name: "x"}},
+		},
+	}
+	block.List = append([]IStmtNode{call}, block.List...)
+
+	// Only the new statement is printed, its siblings are kept verbatim.
+	result := spliceForTest(t, file, options)
+	expected := strings.Replace(losslessSource, "if x > 0   {\n", "if x > 0   {\n\t\tprintln(x)\n", 1)
+	if result != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, result)
+	}
+
+	block.List = append(block.List, call)
+	body.List = body.List[:1]
+	result = spliceForTest(t, file, options)
+	expected = `package main
+
+import "fmt"
+
+// f prints x.
+func f(x int) int {
+	fmt.Println( "x" ,  x )
+}
+`
+	if result != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, result)
+	}
+}
+
+const losslessListSource = `package main
+
+import (
+	"fmt"
+	"os" // files
+	"strings"
+)
+
+// F is kept.
+func F(x   int)  int {
+	y := x+1   // aligned
+	z := y*2   // comments
+
+	fmt.Println(y,z)
+	return z
+}
+
+// G is removed.
+func G() {
+	os.Exit(1)
+}
+
+var v = strings.TrimSpace
+`
+
+func TestSpliceRemoval(t *testing.T) {
+	options := Options{WithPositions: true, WithComments: true}
+	splice := func(file *FileNode) string {
+		result, err := SpliceSource([]byte(losslessListSource), "main.go", file, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(result)
+	}
+
+	file := decodeForSplicing(t, losslessListSource, options)
+	body := file.Decls[1].(*FuncDeclNode).Body
+	body.List = append(body.List[:2], body.List[3:]...)
+	expected := strings.Replace(losslessListSource, "\tfmt.Println(y,z)\n", "", 1)
+	if result := splice(file); result != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, result)
+	}
+
+	// Removing the only use of os drops the import along with its comment,
+	// the rest of the file is untouched.
+	file = decodeForSplicing(t, losslessListSource, options)
+	file.Decls = append(file.Decls[:2], file.Decls[3:]...)
+	file.Comments = append(file.Comments[:4], file.Comments[5:]...)
+	FixImports(file, false)
+	expected = strings.NewReplacer("\t\"os\" // files\n", "", "// G is removed.\nfunc G() {\n\tos.Exit(1)\n}\n\n", "").
+		Replace(losslessListSource)
+	if result := splice(file); result != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, result)
+	}
+
+	// The last declaration takes the blank line before it along.
+	file = decodeForSplicing(t, losslessListSource, options)
+	file.Decls = file.Decls[:3]
+	FixImports(file, false)
+	expected = strings.NewReplacer("\t\"strings\"\n", "", "\n\nvar v = strings.TrimSpace\n", "\n").
+		Replace(losslessListSource)
+	if result := splice(file); result != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, result)
+	}
+}
+
+func TestSpliceNewImport(t *testing.T) {
+	src := "package main\n\n// F is kept.\nfunc F(x   int)  {\n\tfmt.Println(x)\n}\n"
+	options := Options{WithPositions: true, WithComments: true}
+	file := decodeForSplicing(t, src, options)
+	FixImports(file, false)
+	result, err := SpliceSource([]byte(src), "main.go", file, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Replace(src, "\n\n", "\n\nimport \"fmt\"\n\n", 1)
+	if string(result) != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, result)
+	}
+}
+
+func TestJSONToSourceLossless(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "main.go")
+	err := os.WriteFile(source, []byte(losslessSource), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{WithPositions: true, WithComments: true}
+	document := filepath.Join(dir, "main.json")
+	err = SourceToJSON(source, document, "", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "output.go")
+	err = JSONToSourceLossless(document, output, "", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != losslessSource {
+		t.Errorf("unchanged file expected, got\n%s", result)
+	}
+
+	// Changes are found by comparing with the parsed source, positions of the
+	// document are not needed.
+	err = SourceToJSON(source, document, "", Options{WithComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = JSONToSourceLossless(document, output, "", Options{WithComments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(result) != losslessSource {
+		t.Errorf("unchanged file expected, got\n%s", result)
+	}
+
+	err = os.WriteFile(document, []byte(`{"NodeType":"File","Name":{"NodeType":"Ident","Name":"main"},"Decls":[]}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = JSONToSourceLossless(document, output, "", options)
+	if err == nil {
+		t.Error("error expected for a document without FileSet")
+	}
+
+	err = os.WriteFile(document, []byte(`{"NodeType":"Ident","Name":"x"}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = JSONToSourceLossless(document, output, source, options)
+	if err == nil {
+		t.Error("error expected for a document that is not a file")
+	}
+}
@@ -0,0 +1,439 @@
+package asty
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Subset of the language server protocol structures used by asty lsp.
+
+type LSPPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type LSPRange struct {
+	Start LSPPosition `json:"start"`
+	End   LSPPosition `json:"end"`
+}
+
+type lspTextDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text"`
+}
+
+type lspContentChange struct {
+	Text string `json:"text"`
+}
+
+type lspDocumentParams struct {
+	TextDocument   lspTextDocument    `json:"textDocument"`
+	ContentChanges []lspContentChange `json:"contentChanges"`
+}
+
+type lspPositionParams struct {
+	TextDocument lspTextDocument `json:"textDocument"`
+	Position     LSPPosition     `json:"position"`
+	Options      Options         `json:"options"`
+}
+
+type lspSelectionRangeParams struct {
+	TextDocument lspTextDocument `json:"textDocument"`
+	Positions    []LSPPosition   `json:"positions"`
+}
+
+type LSPHover struct {
+	Contents LSPMarkupContent `json:"contents"`
+	Range    LSPRange         `json:"range"`
+}
+
+type LSPMarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type LSPSelectionRange struct {
+	Range  LSPRange           `json:"range"`
+	Parent *LSPSelectionRange `json:"parent,omitempty"`
+}
+
+type LSPDocumentSymbol struct {
+	Name           string               `json:"name"`
+	Detail         string               `json:"detail,omitempty"`
+	Kind           int                  `json:"kind"`
+	Range          LSPRange             `json:"range"`
+	SelectionRange LSPRange             `json:"selectionRange"`
+	Children       []*LSPDocumentSymbol `json:"children,omitempty"`
+}
+
+// LSPNodeAt is the result of the custom asty/nodeAt request.
+type LSPNodeAt struct {
+	Path  []*PathElement `json:"Path"`
+	Range LSPRange       `json:"Range"`
+	Node  INode          `json:"Node"`
+}
+
+// Symbol kinds of the language server protocol.
+const (
+	lspSymbolClass     = 5
+	lspSymbolMethod    = 6
+	lspSymbolInterface = 11
+	lspSymbolFunction  = 12
+	lspSymbolStruct    = 23
+)
+
+// lspOffset converts a protocol position, which counts UTF-16 code units, into
+// a byte offset of text. Positions past the end of a line are clamped.
+func lspOffset(text string, position LSPPosition) int {
+	offset := 0
+	for line := 0; line < position.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+		if next < 0 {
+			return len(text)
+		}
+		offset += next + 1
+	}
+	for units := 0; units < position.Character && offset < len(text) && text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+		offset += size
+	}
+	return offset
+}
+
+func lspPositionOf(text string, offset int) LSPPosition {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	lineStart := strings.LastIndexByte(text[:offset], '\n') + 1
+	position := LSPPosition{Line: strings.Count(text[:lineStart], "\n")}
+	for _, r := range text[lineStart:offset] {
+		if r >= 0x10000 {
+			position.Character += 2
+		} else {
+			position.Character++
+		}
+	}
+	return position
+}
+
+// lspDocument is a parsed open document. Both go/ast and asty trees are kept
+// to map asty nodes to source ranges.
+type lspDocument struct {
+	text  string
+	tfile *token.File
+	tree  *ast.File
+	file  *FileNode
+}
+
+func parseLSPDocument(uri, text string, options Options) *lspDocument {
+	marshaller := NewMarshaller(options)
+	marshaller.SetSource([]byte(text))
+	mode := parser.SkipObjectResolution
+	if options.WithComments {
+		mode |= parser.ParseComments
+	}
+	// Syntax errors are ignored as long as a partial tree is available.
+	tree, _ := parser.ParseFile(marshaller.FileSet(), uri, text, mode)
+	if tree == nil {
+		return nil
+	}
+	return &lspDocument{
+		text:  text,
+		tfile: marshaller.FileSet().File(tree.Pos()),
+		tree:  tree,
+		file:  marshaller.MarshalFile(tree),
+	}
+}
+
+func (doc *lspDocument) rangeOf(node ast.Node) LSPRange {
+	return LSPRange{
+		Start: lspPositionOf(doc.text, doc.tfile.Offset(node.Pos())),
+		End:   lspPositionOf(doc.text, doc.tfile.Offset(node.End())),
+	}
+}
+
+func astChildren(node ast.Node) []ast.Node {
+	var children []ast.Node
+	ast.Inspect(node, func(child ast.Node) bool {
+		if child == node {
+			return true
+		}
+		if child != nil {
+			children = append(children, child)
+		}
+		return false
+	})
+	return children
+}
+
+// inspectWithAST is like InspectPath, but also passes the go/ast node each asty
+// node was marshalled from. Children are paired in order, which holds because
+// node structs keep the field order of go/ast. Children that go/ast does not
+// walk, like File.Comments, come last and are skipped.
+func inspectWithAST(file *FileNode, tree *ast.File, f func(path []Step, node ast.Node) bool) {
+	var visit func(path []Step, node ast.Node)
+	visit = func(path []Step, node ast.Node) {
+		if !f(path, node) {
+			return
+		}
+		children := astChildren(node)
+		next := 0
+		walkChildren(path[len(path)-1].Node, func(field string, index int, child INode) {
+			if next >= len(children) {
+				return
+			}
+			astChild := children[next]
+			next++
+			if reflect.TypeOf(astChild).Elem().Name() != nodeTypeOf(child) {
+				next = len(children)
+				return
+			}
+			visit(append(path, Step{Node: child, Field: field, Index: index}), astChild)
+		})
+	}
+	visit([]Step{{Node: file, Index: -1}}, tree)
+}
+
+// pathAt returns the path to the innermost node containing offset along with
+// the go/ast node it was marshalled from.
+func (doc *lspDocument) pathAt(offset int) ([]Step, ast.Node) {
+	pos := doc.tfile.Pos(offset)
+	return pathEnclosing(doc.file, doc.tree, pos, pos)
+}
+
+func formatNodePath(path []Step) string {
+	var result strings.Builder
+	for index, element := range StepsToPath(path) {
+		if index > 0 {
+			result.WriteString(" > ")
+			result.WriteString(element.Field)
+			if element.Index >= 0 {
+				result.WriteString("[" + strconv.Itoa(element.Index) + "]")
+			}
+			result.WriteString(": ")
+		}
+		result.WriteString(element.NodeType)
+	}
+	return result.String()
+}
+
+type lspServer struct {
+	rpc       *rpcServer
+	documents map[string]string
+}
+
+func (s *lspServer) document(uri string, options Options) (*lspDocument, error) {
+	text, ok := s.documents[uri]
+	if !ok {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "document is not open: " + uri}
+	}
+	return parseLSPDocument(uri, text, options), nil
+}
+
+func (s *lspServer) initialize(json.RawMessage) (any, error) {
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync":       1,
+			"hoverProvider":          true,
+			"selectionRangeProvider": true,
+			"documentSymbolProvider": true,
+		},
+		"serverInfo": map[string]string{"name": "asty"},
+	}, nil
+}
+
+func (s *lspServer) ignore(json.RawMessage) (any, error) {
+	return nil, nil
+}
+
+func (s *lspServer) exit(json.RawMessage) (any, error) {
+	s.rpc.stop = true
+	return nil, nil
+}
+
+func (s *lspServer) didOpen(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[lspDocumentParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	s.documents[params.TextDocument.URI] = params.TextDocument.Text
+	return nil, nil
+}
+
+func (s *lspServer) didChange(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[lspDocumentParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	// Only full synchronization is announced, so the last change is the text.
+	if len(params.ContentChanges) > 0 {
+		s.documents[params.TextDocument.URI] = params.ContentChanges[len(params.ContentChanges)-1].Text
+	}
+	return nil, nil
+}
+
+func (s *lspServer) didClose(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[lspDocumentParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	delete(s.documents, params.TextDocument.URI)
+	return nil, nil
+}
+
+func (s *lspServer) hover(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[lspPositionParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.document(params.TextDocument.URI, Options{WithComments: true})
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	path, node := doc.pathAt(lspOffset(doc.text, params.Position))
+	if len(path) < 2 {
+		return nil, nil
+	}
+	return &LSPHover{
+		Contents: LSPMarkupContent{Kind: "markdown", Value: "```\n" + formatNodePath(path) + "\n```"},
+		Range:    doc.rangeOf(node),
+	}, nil
+}
+
+func (s *lspServer) selectionRange(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[lspSelectionRangeParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.document(params.TextDocument.URI, Options{WithComments: true})
+	if err != nil || doc == nil {
+		return nil, err
+	}
+
+	result := make([]*LSPSelectionRange, len(params.Positions))
+	for index, position := range params.Positions {
+		offset := lspOffset(doc.text, position)
+		var selection *LSPSelectionRange
+		inspectWithAST(doc.file, doc.tree, func(_ []Step, node ast.Node) bool {
+			pos := doc.tfile.Pos(offset)
+			if pos < node.Pos() || pos > node.End() {
+				return false
+			}
+			current := doc.rangeOf(node)
+			if selection == nil || selection.Range != current {
+				selection = &LSPSelectionRange{Range: current, Parent: selection}
+			}
+			return true
+		})
+		if selection == nil {
+			selection = &LSPSelectionRange{Range: LSPRange{Start: position, End: position}}
+		}
+		result[index] = selection
+	}
+	return result, nil
+}
+
+func (s *lspServer) documentSymbol(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[lspDocumentParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.document(params.TextDocument.URI, Options{})
+	if err != nil || doc == nil {
+		return nil, err
+	}
+
+	symbols := make([]*LSPDocumentSymbol, 0)
+	inspectWithAST(doc.file, doc.tree, func(path []Step, node ast.Node) bool {
+		switch n := path[len(path)-1].Node.(type) {
+		case *FuncDeclNode:
+			symbol := &LSPDocumentSymbol{
+				Name:           funcDeclName(n),
+				Detail:         "FuncDecl",
+				Kind:           lspSymbolFunction,
+				Range:          doc.rangeOf(node),
+				SelectionRange: doc.rangeOf(node.(*ast.FuncDecl).Name),
+			}
+			if n.Recv != nil {
+				symbol.Kind = lspSymbolMethod
+			}
+			symbols = append(symbols, symbol)
+			return false
+		case *TypeSpecNode:
+			symbol := &LSPDocumentSymbol{
+				Name:           n.Name.Name,
+				Detail:         "TypeSpec",
+				Kind:           lspSymbolClass,
+				Range:          doc.rangeOf(node),
+				SelectionRange: doc.rangeOf(node.(*ast.TypeSpec).Name),
+			}
+			switch n.Type.(type) {
+			case *StructTypeNode:
+				symbol.Kind = lspSymbolStruct
+			case *InterfaceTypeNode:
+				symbol.Kind = lspSymbolInterface
+			}
+			symbols = append(symbols, symbol)
+			return false
+		}
+		return true
+	})
+	return symbols, nil
+}
+
+func (s *lspServer) nodeAt(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[lspPositionParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := s.document(params.TextDocument.URI, params.Options)
+	if err != nil || doc == nil {
+		return nil, err
+	}
+	path, node := doc.pathAt(lspOffset(doc.text, params.Position))
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return &LSPNodeAt{
+		Path:  StepsToPath(path),
+		Range: doc.rangeOf(node),
+		Node:  path[len(path)-1].Node,
+	}, nil
+}
+
+// ServeLSP serves a minimal language server on r and w. It supports hover with
+// the node path under the cursor, selection ranges, document symbols and the
+// custom asty/nodeAt request, which returns the marshalled innermost node at
+// a position along with its path. Documents are synchronized in full.
+func ServeLSP(r io.Reader, w io.Writer) error {
+	server := &lspServer{documents: make(map[string]string)}
+	server.rpc = &rpcServer{
+		conn: newRPCConn(r, w),
+		methods: map[string]rpcMethod{
+			"initialize":                  server.initialize,
+			"initialized":                 server.ignore,
+			"shutdown":                    server.ignore,
+			"exit":                        server.exit,
+			"textDocument/didOpen":        server.didOpen,
+			"textDocument/didChange":      server.didChange,
+			"textDocument/didClose":       server.didClose,
+			"textDocument/hover":          server.hover,
+			"textDocument/selectionRange": server.selectionRange,
+			"textDocument/documentSymbol": server.documentSymbol,
+			"asty/nodeAt":                 server.nodeAt,
+		},
+	}
+	return server.rpc.serve()
+}
@@ -0,0 +1,160 @@
+package asty
+
+import (
+	"encoding/json"
+	"go/ast"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInspectWithAST(t *testing.T) {
+	for _, input := range encoderCorpus(t) {
+		src, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			doc := parseLSPDocument(input, string(src), Options{WithComments: true})
+			expected := 0
+			ast.Inspect(doc.tree, func(node ast.Node) bool {
+				if node != nil {
+					expected++
+				}
+				return true
+			})
+			actual := 0
+			inspectWithAST(doc.file, doc.tree, func(path []Step, node ast.Node) bool {
+				actual++
+				return true
+			})
+			if actual != expected {
+				t.Errorf("%d nodes paired, %d expected", actual, expected)
+			}
+		})
+	}
+}
+
+func TestLSPOffsets(t *testing.T) {
+	text := "package p\n\nvar s = \"é\U0001F600x\"\n"
+	for offset := range []byte(text) {
+		position := lspPositionOf(text, offset)
+		if !isRuneStart(text, offset) {
+			continue
+		}
+		if lspOffset(text, position) != offset {
+			t.Errorf("offset %d maps to %+v and back to %d", offset, position, lspOffset(text, position))
+		}
+	}
+	if position := lspPositionOf(text, len(text)-3); position != (LSPPosition{Line: 2, Character: 12}) {
+		t.Errorf("unexpected position %+v", position)
+	}
+	if offset := lspOffset(text, LSPPosition{Line: 0, Character: 100}); offset != 9 {
+		t.Errorf("unexpected clamped offset %d", offset)
+	}
+}
+
+func isRuneStart(text string, offset int) bool {
+	return text[offset]&0xC0 != 0x80
+}
+
+const lspSource = `package main
+
+type point struct {
+	x, y int
+}
+
+type shape interface{}
+
+func (p point) norm() int {
+	return p.x*p.x + p.y*p.y
+}
+`
+
+func TestLSPSession(t *testing.T) {
+	uri := "file:///tmp/main.go"
+	document := map[string]any{"uri": uri}
+	cursor := map[string]any{"line": 9, "character": 8}
+	responses := serveForTest(t, ServeLSP,
+		rpcRequestForTest(t, 1, "initialize", map[string]any{}),
+		`{"jsonrpc": "2.0", "method": "initialized", "params": {}}`,
+		`{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": {"textDocument": {"uri": "`+uri+
+			`", "text": "package main\n"}}}`,
+		`{"jsonrpc": "2.0", "method": "textDocument/didChange", "params": {"textDocument": {"uri": "`+uri+
+			`"}, "contentChanges": [{"text": `+string(mustMarshal(t, lspSource))+`}]}}`,
+		rpcRequestForTest(t, 2, "textDocument/hover", map[string]any{"textDocument": document, "position": cursor}),
+		rpcRequestForTest(t, 3, "textDocument/selectionRange", map[string]any{"textDocument": document,
+			"positions": []any{cursor}}),
+		rpcRequestForTest(t, 4, "textDocument/documentSymbol", map[string]any{"textDocument": document}),
+		rpcRequestForTest(t, 5, "asty/nodeAt", map[string]any{"textDocument": document, "position": cursor}),
+		rpcRequestForTest(t, 6, "textDocument/hover", map[string]any{"textDocument": map[string]any{"uri": "x"},
+			"position": cursor}),
+		rpcRequestForTest(t, 7, "shutdown", nil),
+		`{"jsonrpc": "2.0", "method": "exit"}`,
+		rpcRequestForTest(t, 8, "shutdown", nil),
+	)
+	if len(responses) != 7 {
+		t.Fatalf("unexpected responses %s", responses)
+	}
+
+	var hover LSPHover
+	mustUnmarshalResult(t, responses[1], &hover)
+	expected := "```\nFile > Decls[2]: FuncDecl > Body: BlockStmt > List[0]: ReturnStmt > Results[0]: BinaryExpr" +
+		" > X: BinaryExpr > X: SelectorExpr > X: Ident\n```"
+	if hover.Contents.Value != expected || hover.Range != (LSPRange{LSPPosition{9, 8}, LSPPosition{9, 9}}) {
+		t.Errorf("unexpected hover %+v", hover)
+	}
+
+	var selections []*LSPSelectionRange
+	mustUnmarshalResult(t, responses[2], &selections)
+	var ranges []LSPRange
+	for selection := selections[0]; selection != nil; selection = selection.Parent {
+		ranges = append(ranges, selection.Range)
+	}
+	if len(ranges) != 8 || ranges[0] != hover.Range || ranges[1] != (LSPRange{LSPPosition{9, 8}, LSPPosition{9, 11}}) {
+		t.Errorf("unexpected selection ranges %+v", ranges)
+	}
+
+	var symbols []*LSPDocumentSymbol
+	mustUnmarshalResult(t, responses[3], &symbols)
+	names := map[string]int{}
+	for _, symbol := range symbols {
+		names[symbol.Name] = symbol.Kind
+	}
+	if len(symbols) != 3 || names["point"] != lspSymbolStruct || names["shape"] != lspSymbolInterface ||
+		names["point.norm"] != lspSymbolMethod || symbols[2].SelectionRange.Start != (LSPPosition{8, 15}) {
+		t.Errorf("unexpected symbols %+v", names)
+	}
+
+	var nodeAt struct {
+		Path []*PathElement
+		Node *IdentNode
+	}
+	mustUnmarshalResult(t, responses[4], &nodeAt)
+	if len(nodeAt.Path) != 8 || nodeAt.Path[7].Field != "X" || nodeAt.Node.Name != "p" {
+		t.Errorf("unexpected node %+v", nodeAt)
+	}
+
+	if decodeRPCResponse(t, responses[5]).Error == nil {
+		t.Error("error expected for unknown document")
+	}
+}
+
+func mustMarshal(t *testing.T, value any) []byte {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func mustUnmarshalResult(t *testing.T, response json.RawMessage, result any) {
+	decoded := decodeRPCResponse(t, response)
+	if decoded.Error != nil {
+		t.Fatalf("unexpected error %+v", decoded.Error)
+	}
+	err := json.Unmarshal(decoded.Result, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,6 +2,7 @@ package asty
 
 import (
 	"go/ast"
+	"go/doc/comment"
 	"go/token"
 	"reflect"
 )
@@ -11,6 +12,10 @@ type Marshaller struct {
 	fset       *token.FileSet
 	references map[any]any
 	refcount   int
+	positions  positionTable
+	src        []byte
+	specDoc    *ast.CommentGroup
+	docParser  *comment.Parser
 }
 
 func NewMarshaller(options Options) *Marshaller {
@@ -26,6 +31,12 @@ func (m *Marshaller) FileSet() *token.FileSet {
 	return m.fset
 }
 
+// SetSource sets the source of the file being marshalled, which is needed to
+// attach source text to nodes selected by WithSource.
+func (m *Marshaller) SetSource(src []byte) {
+	m.src = src
+}
+
 func wrapMarshal[T any, R any](m *Marshaller, node *T, marshal func() *R) *R {
 	if node == nil {
 		return nil
@@ -45,33 +56,52 @@ func wrapMarshal[T any, R any](m *Marshaller, node *T, marshal func() *R) *R {
 
 // ---------------------------------------------------------------------------
 
-func (m *Marshaller) MarshalNode(nodeType string, _ ast.Node) Node {
+func (m *Marshaller) MarshalNode(nodeType string, node ast.Node) Node {
 	ref := 0
 	if m.WithReferences {
 		m.refcount++
 		ref = m.refcount
 	}
-	return Node{
+	result := Node{
 		NodeType: nodeType,
 		RefId:    ref,
 	}
+	if m.WithSpans && node != nil {
+		result.Pos = m.marshalPosition(node.Pos())
+		result.End = m.marshalPosition(node.End())
+	}
+	if m.WithSource != "" {
+		result.Source = nodeSource(m.fset, m.src, m.WithSource, node)
+	}
+	return result
 }
 
 func (m *Marshaller) MarshalPosition(pos token.Pos) *PositionNode {
 	if !m.WithPositions {
 		return nil
 	}
+	return m.marshalPosition(pos)
+}
+
+// marshalPosition marshals positions of spans, which do not depend on
+// WithPositions.
+func (m *Marshaller) marshalPosition(pos token.Pos) *PositionNode {
 	if pos == token.NoPos {
 		return nil
 	}
 	position := m.fset.PositionFor(pos, false)
-	return &PositionNode{
+	result := &PositionNode{
 		Node:     m.MarshalNode("Position", nil),
 		Filename: position.Filename,
 		Line:     position.Line,
 		Offset:   position.Offset,
 		Column:   position.Column,
+		Format:   m.PositionFormat,
+	}
+	if m.PositionFormat == PositionTable {
+		result.Index = m.positions.index(pos, position)
 	}
+	return result
 }
 
 func (m *Marshaller) MarshalComment(comment *ast.Comment) *CommentNode {
@@ -107,6 +137,16 @@ func (m *Marshaller) MarshalCommentGroup(group *ast.CommentGroup) *CommentGroupN
 	})
 }
 
+// marshalDocGroup marshals the comment group of a Doc field, parsing it as a
+// doc comment when WithDocs is set.
+func (m *Marshaller) marshalDocGroup(group *ast.CommentGroup) *CommentGroupNode {
+	node := m.MarshalCommentGroup(group)
+	if node != nil && m.WithDocs && node.Parsed == nil {
+		node.Parsed = parseDoc(m.docParser, group)
+	}
+	return node
+}
+
 func (m *Marshaller) MarshalCommentGroups(groups []*ast.CommentGroup) []*CommentGroupNode {
 	if groups == nil {
 		return nil
@@ -124,7 +164,7 @@ func (m *Marshaller) MarshalField(node *ast.Field) *FieldNode {
 	return wrapMarshal(m, node, func() *FieldNode {
 		return &FieldNode{
 			Node:    m.MarshalNode("Field", node),
-			Doc:     m.MarshalCommentGroup(node.Doc),
+			Doc:     m.marshalDocGroup(node.Doc),
 			Names:   m.MarshalIdents(node.Names),
 			Type:    m.MarshalExpr(node.Type),
 			Tag:     m.MarshalBasicLit(node.Tag),
@@ -413,7 +453,7 @@ func (m *Marshaller) MarshalExpr(node ast.Expr) IExprNode {
 	case *ast.ChanType:
 		return m.MarshalChanType(expr)
 	default:
-		panic("implement me")
+		panic("implement me " + reflect.TypeOf(expr).String())
 	}
 }
 
@@ -808,7 +848,7 @@ func (m *Marshaller) MarshalImportSpec(spec *ast.ImportSpec) *ImportSpecNode {
 	return wrapMarshal(m, spec, func() *ImportSpecNode {
 		return &ImportSpecNode{
 			Node:    m.MarshalNode("ImportSpec", spec),
-			Doc:     m.MarshalCommentGroup(spec.Doc),
+			Doc:     m.marshalDocGroup(spec.Doc),
 			Name:    m.MarshalIdent(spec.Name),
 			Path:    m.MarshalBasicLit(spec.Path),
 			Comment: m.MarshalCommentGroup(spec.Comment),
@@ -831,12 +871,13 @@ func (m *Marshaller) MarshalImportSpecs(imports []*ast.ImportSpec) []*ImportSpec
 func (m *Marshaller) MarshalValueSpec(spec *ast.ValueSpec) *ValueSpecNode {
 	return wrapMarshal(m, spec, func() *ValueSpecNode {
 		return &ValueSpecNode{
-			Node:    m.MarshalNode("ValueSpec", spec),
-			Doc:     m.MarshalCommentGroup(spec.Doc),
-			Names:   m.MarshalIdents(spec.Names),
-			Type:    m.MarshalExpr(spec.Type),
-			Values:  m.MarshalExprs(spec.Values),
-			Comment: m.MarshalCommentGroup(spec.Comment),
+			Node:       m.MarshalNode("ValueSpec", spec),
+			Doc:        m.marshalDocGroup(spec.Doc),
+			Names:      m.MarshalIdents(spec.Names),
+			Type:       m.MarshalExpr(spec.Type),
+			Values:     m.MarshalExprs(spec.Values),
+			Comment:    m.MarshalCommentGroup(spec.Comment),
+			Directives: m.marshalDirectives(m.specDoc, spec.Doc, spec.Comment),
 		}
 	})
 }
@@ -845,7 +886,7 @@ func (m *Marshaller) MarshalTypeSpec(spec *ast.TypeSpec) *TypeSpecNode {
 	return wrapMarshal(m, spec, func() *TypeSpecNode {
 		return &TypeSpecNode{
 			Node:       m.MarshalNode("TypeSpec", spec),
-			Doc:        m.MarshalCommentGroup(spec.Doc),
+			Doc:        m.marshalDocGroup(spec.Doc),
 			Name:       m.MarshalIdent(spec.Name),
 			TypeParams: m.MarshalFieldList(spec.TypeParams),
 			Assign:     m.MarshalPosition(spec.Assign),
@@ -867,7 +908,7 @@ func (m *Marshaller) MarshalSpec(node ast.Spec) ISpecNode {
 	case *ast.TypeSpec:
 		return m.MarshalTypeSpec(spec)
 	default:
-		panic("implement me")
+		panic("implement me " + reflect.TypeOf(spec).String())
 	}
 }
 
@@ -896,9 +937,12 @@ func (m *Marshaller) MarshalBadDecl(decl *ast.BadDecl) *BadDeclNode {
 
 func (m *Marshaller) MarshalGenDecl(decl *ast.GenDecl) *GenDeclNode {
 	return wrapMarshal(m, decl, func() *GenDeclNode {
+		specDoc := m.specDoc
+		m.specDoc = specDirectiveDoc(decl)
+		defer func() { m.specDoc = specDoc }()
 		return &GenDeclNode{
 			Node:   m.MarshalNode("GenDecl", decl),
-			Doc:    m.MarshalCommentGroup(decl.Doc),
+			Doc:    m.marshalDocGroup(decl.Doc),
 			TokPos: m.MarshalPosition(decl.TokPos),
 			Tok:    decl.Tok.String(),
 			Lparen: m.MarshalPosition(decl.Lparen),
@@ -911,12 +955,13 @@ func (m *Marshaller) MarshalGenDecl(decl *ast.GenDecl) *GenDeclNode {
 func (m *Marshaller) MarshalFuncDecl(decl *ast.FuncDecl) *FuncDeclNode {
 	return wrapMarshal(m, decl, func() *FuncDeclNode {
 		return &FuncDeclNode{
-			Node: m.MarshalNode("FuncDecl", decl),
-			Doc:  m.MarshalCommentGroup(decl.Doc),
-			Recv: m.MarshalFieldList(decl.Recv),
-			Name: m.MarshalIdent(decl.Name),
-			Type: m.MarshalFuncType(decl.Type),
-			Body: m.MarshalBlockStmt(decl.Body),
+			Node:       m.MarshalNode("FuncDecl", decl),
+			Doc:        m.marshalDocGroup(decl.Doc),
+			Recv:       m.MarshalFieldList(decl.Recv),
+			Name:       m.MarshalIdent(decl.Name),
+			Type:       m.MarshalFuncType(decl.Type),
+			Body:       m.MarshalBlockStmt(decl.Body),
+			Directives: m.marshalDirectives(decl.Doc),
 		}
 	})
 }
@@ -933,11 +978,14 @@ func (m *Marshaller) MarshalDecl(node ast.Decl) IDeclNode {
 	case *ast.FuncDecl:
 		return m.MarshalFuncDecl(decl)
 	default:
-		panic("implement me")
+		panic("implement me " + reflect.TypeOf(decl).String())
 	}
 }
 
 func (m *Marshaller) MarshalDecls(decls []ast.Decl) []IDeclNode {
+	if decls == nil {
+		return nil
+	}
 	nodes := make([]IDeclNode, len(decls))
 	for index, decl := range decls {
 		nodes[index] = m.MarshalDecl(decl)
@@ -949,20 +997,39 @@ func (m *Marshaller) MarshalDecls(decls []ast.Decl) []IDeclNode {
 
 func (m *Marshaller) MarshalFile(node *ast.File) *FileNode {
 	return wrapMarshal(m, node, func() *FileNode {
+		m.positions.reset()
+		if m.WithDocs {
+			m.docParser = newDocParser(node)
+		}
 		var imports []*ImportSpecNode
 		if m.WithImports {
 			imports = m.MarshalImportSpecs(node.Imports)
 		}
-		return &FileNode{
+		file := &FileNode{
 			Node:       m.MarshalNode("File", node),
-			Doc:        m.MarshalCommentGroup(node.Doc),
+			Doc:        m.marshalDocGroup(node.Doc),
 			Package:    m.MarshalPosition(node.Package),
 			Name:       m.MarshalIdent(node.Name),
 			Decls:      m.MarshalDecls(node.Decls),
 			Imports:    imports,
 			Unresolved: m.MarshalIdents(node.Unresolved),
 			Comments:   m.MarshalCommentGroups(node.Comments),
+			Directives: m.marshalFileDirectives(node),
 			FileSet:    m.fset,
 		}
+		if (m.WithPositions || m.WithSpans) && m.PositionFormat == PositionTable {
+			file.Positions = m.positions.items
+		}
+		return file
 	})
 }
+
+// MarshalPartialFile marshals a file along with the syntax errors it was
+// parsed with.
+func (m *Marshaller) MarshalPartialFile(node *ast.File, errors []*SourceError) *FileNode {
+	file := m.MarshalFile(node)
+	if file != nil {
+		file.Errors = errors
+	}
+	return file
+}
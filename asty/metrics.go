@@ -0,0 +1,384 @@
+package asty
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"strconv"
+)
+
+// FunctionMetrics describes a single function declaration or literal.
+// Function literals are reported on their own and do not contribute to the
+// metrics of the enclosing function.
+type FunctionMetrics struct {
+	Filename   string `json:"Filename"`
+	Name       string `json:"Name"`
+	NodeType   string `json:"NodeType"`
+	Line       int    `json:"Line"`
+	EndLine    int    `json:"EndLine"`
+	Cyclomatic int    `json:"Cyclomatic"`
+	Cognitive  int    `json:"Cognitive"`
+	MaxNesting int    `json:"MaxNesting"`
+	Statements int    `json:"Statements"`
+	Params     int    `json:"Params"`
+	Results    int    `json:"Results"`
+	Returns    int    `json:"Returns"`
+}
+
+var metricsHeader = []string{
+	"Filename", "Name", "NodeType", "Line", "EndLine", "Cyclomatic", "Cognitive",
+	"MaxNesting", "Statements", "Params", "Results", "Returns",
+}
+
+func (m *FunctionMetrics) record() []string {
+	return []string{
+		m.Filename, m.Name, m.NodeType,
+		strconv.Itoa(m.Line), strconv.Itoa(m.EndLine),
+		strconv.Itoa(m.Cyclomatic), strconv.Itoa(m.Cognitive), strconv.Itoa(m.MaxNesting),
+		strconv.Itoa(m.Statements), strconv.Itoa(m.Params), strconv.Itoa(m.Results),
+		strconv.Itoa(m.Returns),
+	}
+}
+
+// CollectMetrics computes metrics for every function of a file. The file must
+// be marshalled with positions to get line numbers. Function literals are
+// named after the enclosing declaration, like "Outer.func1", or "glob.func1"
+// at package level.
+func CollectMetrics(filename string, file *FileNode) []*FunctionMetrics {
+	result := make([]*FunctionMetrics, 0)
+	literals := make(map[string]int)
+	InspectPath(file, func(path []Step) bool {
+		switch node := path[len(path)-1].Node.(type) {
+		case *FuncDeclNode:
+			metrics := newFunctionMetrics(filename, funcDeclName(node), "FuncDecl", node.Type, node.Body)
+			scanner := &metricsScanner{metrics: metrics, recursion: recursionTarget(node)}
+			scanner.function(node.Type, node.Body)
+			result = append(result, metrics)
+		case *FuncLitNode:
+			outer := "glob"
+			for _, step := range path {
+				if decl, ok := step.Node.(*FuncDeclNode); ok {
+					outer = funcDeclName(decl)
+				}
+			}
+			literals[outer]++
+			name := fmt.Sprintf("%s.func%d", outer, literals[outer])
+			metrics := newFunctionMetrics(filename, name, "FuncLit", node.Type, node.Body)
+			scanner := &metricsScanner{metrics: metrics}
+			scanner.function(node.Type, node.Body)
+			result = append(result, metrics)
+		}
+		return true
+	})
+	return result
+}
+
+func newFunctionMetrics(filename, name, nodeType string, funcType *FuncTypeNode, body *BlockStmtNode) *FunctionMetrics {
+	metrics := &FunctionMetrics{
+		Filename: filename,
+		Name:     name,
+		NodeType: nodeType,
+	}
+	if funcType != nil && funcType.Func != nil {
+		metrics.Line = funcType.Func.Line
+	}
+	if body != nil && body.Rbrace != nil {
+		metrics.EndLine = body.Rbrace.Line
+	}
+	return metrics
+}
+
+func funcDeclName(decl *FuncDeclNode) string {
+	name := decl.Name.Name
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return name
+	}
+	recv := decl.Recv.List[0].Type
+	pointer := false
+	if star, ok := recv.(*StarExprNode); ok {
+		pointer = true
+		recv = star.X
+	}
+	switch expr := recv.(type) {
+	case *IndexExprNode:
+		recv = expr.X
+	case *IndexListExprNode:
+		recv = expr.X
+	}
+	recvName := "?"
+	if ident, ok := recv.(*IdentNode); ok {
+		recvName = ident.Name
+	}
+	if pointer {
+		return "(*" + recvName + ")." + name
+	}
+	return recvName + "." + name
+}
+
+type callTarget struct {
+	recv string
+	name string
+}
+
+func recursionTarget(decl *FuncDeclNode) *callTarget {
+	target := &callTarget{name: decl.Name.Name}
+	if decl.Recv != nil && len(decl.Recv.List) > 0 {
+		names := decl.Recv.List[0].Names
+		if len(names) == 0 || names[0].Name == "_" {
+			return nil
+		}
+		target.recv = names[0].Name
+	}
+	return target
+}
+
+func (target *callTarget) matches(call *CallExprNode) bool {
+	if target == nil {
+		return false
+	}
+	switch fun := call.Fun.(type) {
+	case *IdentNode:
+		return target.recv == "" && fun.Name == target.name
+	case *SelectorExprNode:
+		recv, ok := fun.X.(*IdentNode)
+		return ok && target.recv != "" && recv.Name == target.recv && fun.Sel.Name == target.name
+	}
+	return false
+}
+
+// ---------------------------------------------------------------------------
+
+type metricsScanner struct {
+	metrics   *FunctionMetrics
+	recursion *callTarget
+}
+
+func countFields(list *FieldListNode) int {
+	if list == nil {
+		return 0
+	}
+	count := 0
+	for _, field := range list.List {
+		if len(field.Names) == 0 {
+			count++
+		} else {
+			count += len(field.Names)
+		}
+	}
+	return count
+}
+
+func (s *metricsScanner) function(funcType *FuncTypeNode, body *BlockStmtNode) {
+	s.metrics.Cyclomatic = 1
+	if funcType != nil {
+		s.metrics.Params = countFields(funcType.Params)
+		s.metrics.Results = countFields(funcType.Results)
+	}
+	if body != nil {
+		s.visit(body, 0)
+	}
+}
+
+// structure accounts for a control flow structure whose body is nested one
+// level deeper than the structure itself.
+func (s *metricsScanner) structure(nesting int) {
+	s.metrics.Cyclomatic++
+	s.metrics.Cognitive += 1 + nesting
+	if nesting+1 > s.metrics.MaxNesting {
+		s.metrics.MaxNesting = nesting + 1
+	}
+}
+
+func (s *metricsScanner) visitAll(nesting int, nodes ...INode) {
+	for _, node := range nodes {
+		s.visit(node, nesting)
+	}
+}
+
+func (s *metricsScanner) visit(node INode, nesting int) {
+	switch node.(type) {
+	case nil:
+		return
+	case *FuncLitNode:
+		return
+	case *BlockStmtNode, *CaseClauseNode, *CommClauseNode:
+	case IStmtNode:
+		s.metrics.Statements++
+	}
+
+	switch n := node.(type) {
+	case *IfStmtNode:
+		s.structure(nesting)
+		s.visitAll(nesting, n.Init, n.Cond)
+		s.visit(n.Body, nesting+1)
+		s.elseBranch(n.Else, nesting)
+		return
+	case *ForStmtNode:
+		s.structure(nesting)
+		s.visitAll(nesting, n.Init, n.Cond, n.Post)
+		s.visit(n.Body, nesting+1)
+		return
+	case *RangeStmtNode:
+		s.structure(nesting)
+		s.visitAll(nesting, n.Key, n.Value, n.X)
+		s.visit(n.Body, nesting+1)
+		return
+	case *SwitchStmtNode:
+		s.structure(nesting)
+		s.metrics.Cyclomatic--
+		s.visitAll(nesting, n.Init, n.Tag)
+		s.visit(n.Body, nesting+1)
+		return
+	case *TypeSwitchStmtNode:
+		s.structure(nesting)
+		s.metrics.Cyclomatic--
+		s.visitAll(nesting, n.Init, n.Assign)
+		s.visit(n.Body, nesting+1)
+		return
+	case *SelectStmtNode:
+		s.structure(nesting)
+		s.metrics.Cyclomatic--
+		s.visit(n.Body, nesting+1)
+		return
+	case *CaseClauseNode:
+		if n.List != nil {
+			s.metrics.Cyclomatic++
+		}
+	case *CommClauseNode:
+		if n.Comm != nil {
+			s.metrics.Cyclomatic++
+		}
+	case *BranchStmtNode:
+		if n.Label != nil || n.Tok == "goto" {
+			s.metrics.Cognitive++
+		}
+	case *ReturnStmtNode:
+		s.metrics.Returns++
+	case *CallExprNode:
+		if s.recursion.matches(n) {
+			s.metrics.Cognitive++
+		}
+	case *BinaryExprNode:
+		if isLogicalOperator(n.Op) {
+			s.logical(n, nesting)
+			return
+		}
+	}
+
+	walkChildren(node, func(_ string, _ int, child INode) {
+		s.visit(child, nesting)
+	})
+}
+
+func (s *metricsScanner) elseBranch(node IStmtNode, nesting int) {
+	switch n := node.(type) {
+	case *IfStmtNode:
+		s.metrics.Statements++
+		s.metrics.Cyclomatic++
+		s.metrics.Cognitive++
+		s.visitAll(nesting, n.Init, n.Cond)
+		s.visit(n.Body, nesting+1)
+		s.elseBranch(n.Else, nesting)
+	case *BlockStmtNode:
+		s.metrics.Cognitive++
+		s.visit(n, nesting+1)
+	}
+}
+
+func isLogicalOperator(op string) bool {
+	return op == "&&" || op == "||"
+}
+
+// logical accounts for a chain of boolean operators: every operator adds a
+// path, and every switch between && and || adds to cognitive complexity.
+func (s *metricsScanner) logical(node *BinaryExprNode, nesting int) {
+	var operators []string
+	var operands []IExprNode
+	var flatten func(expr IExprNode)
+	flatten = func(expr IExprNode) {
+		binary, ok := expr.(*BinaryExprNode)
+		if !ok || !isLogicalOperator(binary.Op) {
+			operands = append(operands, expr)
+			return
+		}
+		flatten(binary.X)
+		operators = append(operators, binary.Op)
+		flatten(binary.Y)
+	}
+	flatten(node)
+
+	for index, op := range operators {
+		s.metrics.Cyclomatic++
+		if index == 0 || operators[index-1] != op {
+			s.metrics.Cognitive++
+		}
+	}
+	for _, operand := range operands {
+		s.visit(operand, nesting)
+	}
+}
+
+// ---------------------------------------------------------------------------
+
+func collectMetrics(patterns []string) ([]*FunctionMetrics, error) {
+	filenames, err := ListGoFiles(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*FunctionMetrics, 0)
+	for _, filename := range filenames {
+		marshaller := NewMarshaller(Options{WithPositions: true})
+		tree, err := parser.ParseFile(marshaller.FileSet(), filename, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, CollectMetrics(filename, marshaller.MarshalFile(tree))...)
+	}
+	return result, nil
+}
+
+func MetricsToJSON(patterns []string, output string, indent string) error {
+	metrics, err := collectMetrics(patterns)
+	if err != nil {
+		return err
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	encoder := json.NewEncoder(outFile)
+	encoder.SetIndent("", indent)
+	return encoder.Encode(metrics)
+}
+
+func MetricsToCSV(patterns []string, output string) error {
+	metrics, err := collectMetrics(patterns)
+	if err != nil {
+		return err
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	writer := csv.NewWriter(outFile)
+	err = writer.Write(metricsHeader)
+	if err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		err = writer.Write(m.record())
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,130 @@
+package asty
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const metricsSource = `package p
+
+func simple() {}
+
+func classify(values []int, limit int) (small, large int) {
+	for _, value := range values {
+		if value < 0 || value > limit && limit > 0 {
+			continue
+		} else if value < limit/2 {
+			small++
+		} else {
+			large++
+		}
+	}
+	switch {
+	case small > large:
+		return small, large
+	case small == large:
+		return 0, 0
+	default:
+	}
+	return
+}
+
+func (t *tree) depth() int {
+	if t == nil {
+		return 0
+	}
+	apply := func(x int) int {
+		if x > 0 {
+			return x
+		}
+		return 0
+	}
+	return apply(t.depth()) + 1
+}
+
+var handler = func() {}
+`
+
+func runMetrics(t *testing.T) (string, []*FunctionMetrics) {
+	filename := filepath.Join(t.TempDir(), "metrics.go")
+	err := os.WriteFile(filename, []byte(metricsSource), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(t.TempDir(), "metrics.json")
+	err = MetricsToJSON([]string{filename}, output, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metrics []*FunctionMetrics
+	err = json.Unmarshal(data, &metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filename, metrics
+}
+
+func TestMetrics(t *testing.T) {
+	filename, metrics := runMetrics(t)
+	expected := []*FunctionMetrics{
+		{Filename: filename, Name: "simple", NodeType: "FuncDecl", Line: 3, EndLine: 3,
+			Cyclomatic: 1},
+		{Filename: filename, Name: "classify", NodeType: "FuncDecl", Line: 5, EndLine: 23,
+			Cyclomatic: 8, Cognitive: 8, MaxNesting: 2, Statements: 10, Params: 2, Results: 2, Returns: 3},
+		{Filename: filename, Name: "(*tree).depth", NodeType: "FuncDecl", Line: 25, EndLine: 36,
+			Cyclomatic: 2, Cognitive: 2, MaxNesting: 1, Statements: 4, Results: 1, Returns: 2},
+		{Filename: filename, Name: "(*tree).depth.func1", NodeType: "FuncLit", Line: 29, EndLine: 34,
+			Cyclomatic: 2, Cognitive: 1, MaxNesting: 1, Statements: 3, Params: 1, Results: 1, Returns: 2},
+		{Filename: filename, Name: "glob.func1", NodeType: "FuncLit", Line: 38, EndLine: 38,
+			Cyclomatic: 1},
+	}
+	if len(metrics) != len(expected) {
+		t.Fatalf("unexpected number of functions %d", len(metrics))
+	}
+	for index := range expected {
+		if !reflect.DeepEqual(metrics[index], expected[index]) {
+			t.Errorf("unexpected metrics\n%+v\nexpected\n%+v", metrics[index], expected[index])
+		}
+	}
+}
+
+func TestMetricsCSV(t *testing.T) {
+	filename, metrics := runMetrics(t)
+	output := filepath.Join(t.TempDir(), "metrics.csv")
+	err := MetricsToCSV([]string{filename}, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(metrics)+1 || !reflect.DeepEqual(records[0], metricsHeader) {
+		t.Fatalf("unexpected records %v", records)
+	}
+	for index, m := range metrics {
+		if !reflect.DeepEqual(records[index+1], m.record()) {
+			t.Errorf("unexpected record %v", records[index+1])
+		}
+	}
+}
+
+func TestMetricsInvalidInput(t *testing.T) {
+	err := MetricsToJSON([]string{InvalidGoFile}, "", "")
+	if err == nil {
+		t.Error("error expected")
+	}
+}
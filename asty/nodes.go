@@ -7,8 +7,11 @@ import (
 )
 
 type Node struct {
-	NodeType string `json:"NodeType"`
-	RefId    int    `json:"RefId,omitempty"`
+	NodeType string        `json:"NodeType"`
+	RefId    int           `json:"RefId,omitempty"`
+	Pos      *PositionNode `json:"Pos,omitempty"`
+	End      *PositionNode `json:"End,omitempty"`
+	Source   string        `json:"Source,omitempty"`
 }
 
 type PositionNode struct {
@@ -17,6 +20,8 @@ type PositionNode struct {
 	Offset   int    `json:"Offset"`
 	Line     int    `json:"Line"`
 	Column   int    `json:"Column"`
+	Format   string `json:"-"`
+	Index    int    `json:"-"`
 }
 
 type CommentNode struct {
@@ -27,7 +32,8 @@ type CommentNode struct {
 
 type CommentGroupNode struct {
 	Node
-	List []*CommentNode `json:"List,omitempty"`
+	List   []*CommentNode `json:"List,omitempty"`
+	Parsed *DocComment    `json:"Parsed,omitempty"`
 }
 
 // ---------------------------------------------------------------------------
@@ -599,19 +605,21 @@ type ImportSpecNode struct {
 
 type ValueSpecNode struct {
 	Node
-	Doc     *CommentGroupNode `json:"Doc,omitempty"`
-	Names   []*IdentNode      `json:"Names"`
-	Type    IExprNode         `json:"Type"`
-	Values  []IExprNode       `json:"Values"`
-	Comment *CommentGroupNode `json:"Comment,omitempty"`
+	Doc        *CommentGroupNode `json:"Doc,omitempty"`
+	Names      []*IdentNode      `json:"Names"`
+	Type       IExprNode         `json:"Type"`
+	Values     []IExprNode       `json:"Values"`
+	Comment    *CommentGroupNode `json:"Comment,omitempty"`
+	Directives []*Directive      `json:"Directives,omitempty"`
 }
 type ValueSpecNodeAlias struct {
 	Node
-	Doc     *CommentGroupNode
-	Names   []*IdentNode
-	Type    json.RawMessage
-	Values  []json.RawMessage
-	Comment *CommentGroupNode
+	Doc        *CommentGroupNode
+	Names      []*IdentNode
+	Type       json.RawMessage
+	Values     []json.RawMessage
+	Comment    *CommentGroupNode
+	Directives []*Directive `json:"Directives,omitempty"`
 }
 
 type TypeSpecNode struct {
@@ -662,11 +670,12 @@ type GenDeclNodeAlias struct {
 
 type FuncDeclNode struct {
 	Node
-	Doc  *CommentGroupNode `json:"Doc,omitempty"`
-	Recv *FieldListNode    `json:"Recv"`
-	Name *IdentNode        `json:"Name"`
-	Type *FuncTypeNode     `json:"Type"`
-	Body *BlockStmtNode    `json:"Body"`
+	Doc        *CommentGroupNode `json:"Doc,omitempty"`
+	Recv       *FieldListNode    `json:"Recv"`
+	Name       *IdentNode        `json:"Name"`
+	Type       *FuncTypeNode     `json:"Type"`
+	Body       *BlockStmtNode    `json:"Body"`
+	Directives []*Directive      `json:"Directives,omitempty"`
 }
 
 // ---------------------------------------------------------------------------
@@ -680,7 +689,10 @@ type FileNode struct {
 	Imports    []*ImportSpecNode   `json:"Imports,omitempty"`
 	Unresolved []*IdentNode        `json:"Unresolved,omitempty"`
 	Comments   []*CommentGroupNode `json:"Comments,omitempty"`
+	Directives []*Directive        `json:"Directives,omitempty"`
 	FileSet    *token.FileSet      `json:"FileSet,omitempty"`
+	Positions  [][3]int            `json:"Positions,omitempty"`
+	Errors     []*SourceError      `json:"Errors,omitempty"`
 	//	Scope      *Scope
 }
 type FileNodeAlias struct {
@@ -692,7 +704,10 @@ type FileNodeAlias struct {
 	Imports    []*ImportSpecNode
 	Unresolved []*IdentNode
 	Comments   []*CommentGroupNode
+	Directives []*Directive `json:"Directives,omitempty"`
 	FileSet    json.RawMessage
+	Positions  [][3]int       `json:"Positions,omitempty"`
+	Errors     []*SourceError `json:"Errors,omitempty"`
 	//	Scope      *Scope
 }
 
@@ -858,7 +873,38 @@ func (node *FuncDeclNode) UnmarshalDecl(um IDeclUnmarshaller) ast.Decl {
 	return um.UnmarshalFuncDeclNode(node)
 }
 
+// MakeNode creates an empty node of any type that may be the root of a
+// document: a file, an expression, a statement, a spec or a declaration. It
+// returns nil for other types.
+func MakeNode(nodeType string) INode {
+	if nodeType == "File" {
+		return &FileNode{}
+	}
+	if node := newExpr(nodeType); node != nil {
+		return node
+	}
+	if node := newStmt(nodeType); node != nil {
+		return node
+	}
+	if node := newSpec(nodeType); node != nil {
+		return node
+	}
+	if node := newDecl(nodeType); node != nil {
+		return node
+	}
+	return nil
+}
+
 func MakeExpr(nodeType string) IExprNode {
+	if node := newExpr(nodeType); node != nil {
+		return node
+	}
+	panic("implement me " + nodeType)
+}
+
+// newExpr creates an empty node of the type, or returns nil for unknown
+// types. MakeExpr panics instead.
+func newExpr(nodeType string) IExprNode {
 	switch nodeType {
 	case "BadExpr":
 		return &BadExprNode{}
@@ -906,12 +952,18 @@ func MakeExpr(nodeType string) IExprNode {
 		return &MapTypeNode{}
 	case "ChanType":
 		return &ChanTypeNode{}
-	default:
-		panic("implement me " + nodeType)
 	}
+	return nil
 }
 
 func MakeStmt(nodeType string) IStmtNode {
+	if node := newStmt(nodeType); node != nil {
+		return node
+	}
+	panic("implement me")
+}
+
+func newStmt(nodeType string) IStmtNode {
 	switch nodeType {
 	case "BadStmt":
 		return &BadStmtNode{}
@@ -955,12 +1007,18 @@ func MakeStmt(nodeType string) IStmtNode {
 		return &ForStmtNode{}
 	case "RangeStmt":
 		return &RangeStmtNode{}
-	default:
-		panic("implement me")
 	}
+	return nil
 }
 
 func MakeSpec(nodeType string) ISpecNode {
+	if node := newSpec(nodeType); node != nil {
+		return node
+	}
+	panic("implement me")
+}
+
+func newSpec(nodeType string) ISpecNode {
 	switch nodeType {
 	case "ImportSpec":
 		return &ImportSpecNode{}
@@ -968,12 +1026,18 @@ func MakeSpec(nodeType string) ISpecNode {
 		return &ValueSpecNode{}
 	case "TypeSpec":
 		return &TypeSpecNode{}
-	default:
-		panic("implement me")
 	}
+	return nil
 }
 
 func MakeDecl(nodeType string) IDeclNode {
+	if node := newDecl(nodeType); node != nil {
+		return node
+	}
+	panic("implement me")
+}
+
+func newDecl(nodeType string) IDeclNode {
 	switch nodeType {
 	case "BadDecl":
 		return &BadDeclNode{}
@@ -981,9 +1045,8 @@ func MakeDecl(nodeType string) IDeclNode {
 		return &GenDeclNode{}
 	case "FuncDecl":
 		return &FuncDeclNode{}
-	default:
-		panic("implement me")
 	}
+	return nil
 }
 
 func (node CommentNode) GetRefId() int {
@@ -2015,6 +2078,7 @@ func (node *ValueSpecNode) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	node.Comment = alias.Comment
+	node.Directives = alias.Directives
 	return nil
 }
 
@@ -2076,6 +2140,9 @@ func (node *FileNode) UnmarshalJSON(data []byte) error {
 	node.Imports = alias.Imports
 	node.Unresolved = alias.Unresolved
 	node.Comments = alias.Comments
+	node.Directives = alias.Directives
+	node.Positions = alias.Positions
+	node.Errors = alias.Errors
 	node.FileSet = token.NewFileSet()
 
 	if alias.FileSet != nil {
@@ -2104,6 +2171,9 @@ func (node *FileNode) MarshalJSON() ([]byte, error) {
 	alias.Imports = node.Imports
 	alias.Unresolved = node.Unresolved
 	alias.Comments = node.Comments
+	alias.Directives = node.Directives
+	alias.Positions = node.Positions
+	alias.Errors = node.Errors
 	err = node.FileSet.Write(func(src any) error {
 		data, err := json.Marshal(src)
 		alias.FileSet = data
@@ -2117,3 +2187,7 @@ func (node *FileNode) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(alias)
 }
+
+func (node *Node) base() *Node {
+	return node
+}
@@ -0,0 +1,112 @@
+package asty
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// Encodings of positions selected by Options.PositionFormat. Full positions
+// are objects carrying the filename, offset, line and column. Offsets are
+// plain byte offsets, compact positions are "line:column" strings, and table
+// positions are indices into the Positions array of the file, whose items are
+// [offset, line, column] triples shared by equal positions. All but full
+// positions leave the filename to the FileSet of the document.
+const (
+	PositionFull    = "full"
+	PositionOffset  = "offset"
+	PositionCompact = "compact"
+	PositionTable   = "table"
+)
+
+func checkPositionFormat(format string) error {
+	switch format {
+	case "", PositionFull, PositionOffset, PositionCompact, PositionTable:
+		return nil
+	}
+	return fmt.Errorf("unknown position format: %s", format)
+}
+
+type positionNodeAlias PositionNode
+
+func (node *PositionNode) MarshalJSON() ([]byte, error) {
+	switch node.Format {
+	case PositionOffset:
+		return json.Marshal(node.Offset)
+	case PositionCompact:
+		return json.Marshal(compactPosition(node.Line, node.Column))
+	case PositionTable:
+		return json.Marshal(node.Index)
+	}
+	return json.Marshal((*positionNodeAlias)(node))
+}
+
+// UnmarshalJSON accepts all position encodings. A number is read as an offset,
+// it is the unmarshaller that treats it as an index when the file has a
+// position table.
+func (node *PositionNode) UnmarshalJSON(data []byte) error {
+	if len(data) == 0 || data[0] == '{' || data[0] == 'n' {
+		return json.Unmarshal(data, (*positionNodeAlias)(node))
+	}
+	if data[0] == '"' {
+		var value string
+		err := json.Unmarshal(data, &value)
+		if err != nil {
+			return err
+		}
+		result, err := parseCompactPosition(value)
+		if err != nil {
+			return err
+		}
+		*node = *result
+		return nil
+	}
+	*node = PositionNode{Node: Node{NodeType: "Position"}, Format: PositionOffset}
+	return json.Unmarshal(data, &node.Offset)
+}
+
+func compactPosition(line, column int) string {
+	return strconv.Itoa(line) + ":" + strconv.Itoa(column)
+}
+
+func parseCompactPosition(value string) (*PositionNode, error) {
+	line, column, ok := strings.Cut(value, ":")
+	result := &PositionNode{Node: Node{NodeType: "Position"}, Format: PositionCompact}
+	var err error
+	if ok {
+		result.Line, err = strconv.Atoi(line)
+	}
+	if ok && err == nil {
+		result.Column, err = strconv.Atoi(column)
+	}
+	if !ok || err != nil {
+		return nil, fmt.Errorf("asty: invalid position %q, expected line:column", value)
+	}
+	return result, nil
+}
+
+// positionTable interns the positions of a file for the table format.
+type positionTable struct {
+	indices map[token.Pos]int
+	items   [][3]int
+}
+
+func (t *positionTable) reset() {
+	t.indices = nil
+	t.items = nil
+}
+
+func (t *positionTable) index(pos token.Pos, position token.Position) int {
+	if index, ok := t.indices[pos]; ok {
+		return index
+	}
+	if t.indices == nil {
+		t.indices = make(map[token.Pos]int)
+	}
+	index := len(t.items)
+	t.indices[pos] = index
+	t.items = append(t.items, [3]int{position.Offset, position.Line, position.Column})
+	return index
+}
@@ -0,0 +1,123 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var positionFormats = []string{PositionFull, PositionOffset, PositionCompact, PositionTable}
+
+func TestPositionFormats(t *testing.T) {
+	for _, input := range encoderCorpus(t) {
+		src, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var expected string
+		for _, format := range positionFormats {
+			for _, references := range []bool{false, true} {
+				options := benchmarkOptions
+				options.PositionFormat = format
+				options.WithReferences = references
+				name := fmt.Sprintf("%s/%s,references:%t", filepath.Base(input), format, references)
+				t.Run(name, func(t *testing.T) {
+					marshalled, err := marshalWithReflection(input, src, options)
+					if err != nil {
+						t.Fatal(err)
+					}
+					encoded, err := encodeDirectly(input, src, options)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(marshalled, encoded) {
+						t.Fatalf("encoder output differs from marshaller output\nexpected: %.300s\nactual:   %.300s",
+							marshalled, encoded)
+					}
+
+					printed := printDocumentForTest(t, string(encoded), options)
+					if expected == "" {
+						expected = printed
+					} else if printed != expected {
+						t.Errorf("%s output differs from %s output", format, PositionFull)
+					}
+
+					// UnmarshalJSON accepts the same encodings as the decoder.
+					decoded, err := NewDecoder(bytes.NewReader(encoded)).DecodeFile()
+					if err != nil {
+						t.Fatal(err)
+					}
+					unmarshalled := &FileNode{}
+					err = json.Unmarshal(encoded, unmarshalled)
+					if err != nil {
+						t.Fatal(err)
+					}
+					compare := CompareOptions{WithPositions: true, WithRefIds: true, WithComments: true}
+					if !Equal(decoded, unmarshalled, compare) {
+						t.Error("UnmarshalJSON result differs from decoder result")
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestPositionEncodings(t *testing.T) {
+	src := "package p\n\nvar x = 1\n"
+	expected := map[string]string{
+		PositionOffset:  `"Package":0,"Name":{"NodeType":"Ident","NamePos":8,"Name":"p"}`,
+		PositionCompact: `"Package":"1:1","Name":{"NodeType":"Ident","NamePos":"1:9","Name":"p"}`,
+		PositionTable:   `"Positions":[[0,1,1],[8,1,9],[11,3,1],[15,3,5],[19,3,9]]`,
+	}
+	for format, fragment := range expected {
+		encoder, err := EncodeSource("p.go", strings.NewReader(src), Options{WithPositions: true, PositionFormat: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(encoder.Bytes()), fragment) {
+			t.Errorf("%s: %s expected in %s", format, fragment, encoder.Bytes())
+		}
+	}
+
+	_, err := EncodeSource("p.go", strings.NewReader(src), Options{PositionFormat: "short"})
+	if err == nil {
+		t.Error("error expected for unknown format")
+	}
+	_, err = EncodeFragment("p.go", strings.NewReader("a + b"), KindExpr, Options{PositionFormat: PositionTable})
+	if err == nil {
+		t.Error("error expected for table positions of fragments")
+	}
+
+	for _, document := range []string{`"1"`, `"a:1"`, `true`} {
+		_, err = NewDecoder(strings.NewReader(document)).decodePosition()
+		if err == nil {
+			t.Errorf("error expected for %s", document)
+		}
+	}
+}
+
+func TestPositionFragments(t *testing.T) {
+	for _, format := range []string{PositionOffset, PositionCompact} {
+		options := Options{WithPositions: true, PositionFormat: format}
+		src := "x := 1\nif x > 0 {\n\treturn x\n}\n"
+		data := encodeFragmentForTest(t, KindStmts, src, options)
+		var items []json.RawMessage
+		err := json.Unmarshal(data, &items)
+		if err != nil || len(items) != 2 {
+			t.Fatalf("%s: two statements expected, got %s", format, data)
+		}
+		stmt, err := NewDecoder(bytes.NewReader(items[1])).DecodeStmt()
+		if err != nil {
+			t.Fatal(err)
+		}
+		position := stmt.(*IfStmtNode).If
+		if position.Format != format || format == PositionOffset && position.Offset != 7 ||
+			format == PositionCompact && (position.Line != 2 || position.Column != 1) {
+			t.Errorf("%s: unexpected position %+v", format, position)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package asty
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/printer"
+	"go/token"
+	"io"
+	"strings"
+)
+
+// Modes of go/printer selected by Options.PrintMode, a comma separated list.
+const (
+	PrintUseSpaces = "usespaces"
+	PrintTabIndent = "tabindent"
+	PrintSourcePos = "sourcepos"
+)
+
+// DefaultTabWidth is the tab width of printer.Fprint, used when
+// Options.TabWidth is zero.
+const DefaultTabWidth = 8
+
+// printerConfig builds the go/printer configuration for options. Spaces
+// indents with TabWidth spaces, whatever the mode says about tabs.
+func printerConfig(options Options) (*printer.Config, error) {
+	config := &printer.Config{Tabwidth: options.TabWidth}
+	if config.Tabwidth == 0 {
+		config.Tabwidth = DefaultTabWidth
+	}
+	if config.Tabwidth < 0 {
+		return nil, fmt.Errorf("invalid tab width: %d", options.TabWidth)
+	}
+	if options.PrintMode != "" {
+		for _, mode := range strings.Split(options.PrintMode, ",") {
+			switch strings.TrimSpace(mode) {
+			case PrintUseSpaces:
+				config.Mode |= printer.UseSpaces
+			case PrintTabIndent:
+				config.Mode |= printer.TabIndent
+			case PrintSourcePos:
+				config.Mode |= printer.SourcePos
+			default:
+				return nil, fmt.Errorf("unknown print mode: %s", mode)
+			}
+		}
+	}
+	if options.Spaces {
+		config.Mode |= printer.UseSpaces
+		config.Mode &^= printer.TabIndent
+	}
+	return config, nil
+}
+
+func checkPrintOptions(options Options) error {
+	_, err := printerConfig(options)
+	return err
+}
+
+// gofmtSource formats printed source with go/format, failing if it does not
+// parse. Lists of declarations or statements are formatted as well.
+func gofmtSource(src []byte) ([]byte, error) {
+	result, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("gofmt: %w", err)
+	}
+	return result, nil
+}
+
+// PrintSource prints the result of DecodeSource like FprintNode does, with the
+// printer configuration of options. Output is formatted with go/format when
+// Gofmt is set.
+func PrintSource(w io.Writer, fset *token.FileSet, node any, options Options) error {
+	config, err := printerConfig(options)
+	if err != nil {
+		return err
+	}
+	if !options.Gofmt {
+		return fprintNode(w, config, fset, node)
+	}
+	var output bytes.Buffer
+	err = fprintNode(&output, config, fset, node)
+	if err != nil {
+		return err
+	}
+	result, err := gofmtSource(output.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(result)
+	return err
+}
@@ -0,0 +1,95 @@
+package asty
+
+import (
+	"bytes"
+	"go/printer"
+	"strings"
+	"testing"
+)
+
+func TestPrinterConfig(t *testing.T) {
+	cases := []struct {
+		options  Options
+		tabWidth int
+		mode     printer.Mode
+	}{
+		{Options{}, DefaultTabWidth, 0},
+		{Options{TabWidth: 4, PrintMode: "usespaces,tabindent"}, 4, printer.UseSpaces | printer.TabIndent},
+		{Options{PrintMode: "sourcepos"}, DefaultTabWidth, printer.SourcePos},
+		{Options{TabWidth: 2, PrintMode: "tabindent", Spaces: true}, 2, printer.UseSpaces},
+	}
+	for _, c := range cases {
+		config, err := printerConfig(c.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Tabwidth != c.tabWidth || config.Mode != c.mode {
+			t.Errorf("%+v: unexpected config %+v", c.options, config)
+		}
+	}
+
+	for _, options := range []Options{{PrintMode: "spaces"}, {TabWidth: -1}} {
+		_, err := printerConfig(options)
+		if err == nil {
+			t.Errorf("%+v: error expected", options)
+		}
+	}
+}
+
+func printSourceForTest(t *testing.T, src string, options Options) string {
+	encoder, err := EncodeSource("p.go", strings.NewReader(src), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset, node, err := DecodeSource(bytes.NewReader(encoder.Bytes()), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	err = PrintSource(&output, fset, node, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output.String()
+}
+
+func TestPrintSource(t *testing.T) {
+	src := "package p\n\nimport (\n\t\"os\"\n\t\"fmt\"\n)\n\nfunc f() {\n\tif true {\n\t\tfmt.Println(os.Args)\n\t}\n}\n"
+
+	result := printSourceForTest(t, src, Options{WithPositions: true, Spaces: true, TabWidth: 2})
+	if !strings.Contains(result, "\n  if true {\n    fmt.Println(os.Args)\n  }\n") {
+		t.Errorf("indentation with two spaces expected, got\n%s", result)
+	}
+
+	result = printSourceForTest(t, src, Options{WithPositions: true, PrintMode: PrintSourcePos})
+	if !strings.HasPrefix(result, "//line p.go:1\n") {
+		t.Errorf("line directive expected, got\n%s", result)
+	}
+
+	result = printSourceForTest(t, src, Options{WithPositions: true, Gofmt: true})
+	if !strings.Contains(result, "import (\n\t\"fmt\"\n\t\"os\"\n)") {
+		t.Errorf("sorted imports expected, got\n%s", result)
+	}
+}
+
+func TestPrintSourceGofmt(t *testing.T) {
+	fset, node, err := DecodeSource(strings.NewReader(`[{"NodeType":"ExprStmt","X":{"NodeType":"Ident","Name":"x"}}]`), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output bytes.Buffer
+	err = PrintSource(&output, fset, node, Options{Gofmt: true})
+	if err != nil || output.String() != "x\n" {
+		t.Errorf("formatted statement expected, got %q, %v", output.String(), err)
+	}
+
+	// An identifier that is not one is printed as is and fails to parse.
+	fset, node, err = DecodeSource(strings.NewReader(`{"NodeType":"Ident","Name":"1x"}`), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PrintSource(&output, fset, node, Options{Gofmt: true})
+	if err == nil {
+		t.Error("error expected for output that does not parse")
+	}
+}
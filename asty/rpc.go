@@ -0,0 +1,377 @@
+package asty
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// JSON-RPC 2.0 error codes.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	RPCSourceError    = -32000
+)
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// toRPCError converts errors returned by methods into protocol errors. Syntax
+// errors of go source carry the list of SourceError as data.
+func toRPCError(err error) *RPCError {
+	var rpcError *RPCError
+	if errors.As(err, &rpcError) {
+		return rpcError
+	}
+	if list := sourceErrors(err); list != nil {
+		return &RPCError{Code: RPCSourceError, Message: err.Error(), Data: list}
+	}
+	return &RPCError{Code: RPCSourceError, Message: err.Error()}
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// rpcConn reads and writes messages framed with Content-Length headers the
+// way the language server protocol does.
+type rpcConn struct {
+	reader *textproto.Reader
+	writer io.Writer
+}
+
+func newRPCConn(r io.Reader, w io.Writer) *rpcConn {
+	return &rpcConn{
+		reader: textproto.NewReader(bufio.NewReader(r)),
+		writer: w,
+	}
+}
+
+func (c *rpcConn) read() ([]byte, error) {
+	header, err := c.reader.ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("asty: invalid Content-Length %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(c.reader.R, body)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (c *rpcConn) write(message any) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+type rpcMethod func(params json.RawMessage) (any, error)
+
+// rpcServer dispatches requests of a connection to methods by name.
+// Requests without id are notifications and get no response. Setting stop
+// from a method ends serving after the current message.
+type rpcServer struct {
+	conn    *rpcConn
+	methods map[string]rpcMethod
+	stop    bool
+}
+
+func (s *rpcServer) serve() error {
+	for !s.stop {
+		body, err := s.conn.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		response := s.handle(body)
+		if response != nil {
+			err = s.conn.write(response)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *rpcServer) handle(body []byte) any {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '[' {
+		if response := s.call(body); response != nil {
+			return response
+		}
+		return nil
+	}
+
+	var batch []json.RawMessage
+	err := json.Unmarshal(body, &batch)
+	if err != nil {
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &RPCError{Code: RPCParseError, Message: err.Error()}}
+	}
+	if len(batch) == 0 {
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &RPCError{Code: RPCInvalidRequest, Message: "empty batch"}}
+	}
+	responses := make([]*rpcResponse, 0, len(batch))
+	for _, item := range batch {
+		if response := s.call(item); response != nil {
+			responses = append(responses, response)
+		}
+	}
+	if len(responses) == 0 {
+		return nil
+	}
+	return responses
+}
+
+func (s *rpcServer) call(body []byte) *rpcResponse {
+	var request rpcRequest
+	err := json.Unmarshal(body, &request)
+	if err != nil {
+		var syntaxError *json.SyntaxError
+		code := RPCInvalidRequest
+		if errors.As(err, &syntaxError) {
+			code = RPCParseError
+		}
+		return &rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &RPCError{Code: code, Message: err.Error()}}
+	}
+
+	response := &rpcResponse{JSONRPC: "2.0", ID: request.ID}
+	if response.ID == nil {
+		response.ID = json.RawMessage("null")
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		response.Error = &RPCError{Code: RPCInvalidRequest, Message: "invalid request"}
+		return response
+	}
+
+	method, ok := s.methods[request.Method]
+	if !ok {
+		if request.ID == nil {
+			return nil
+		}
+		response.Error = &RPCError{Code: RPCMethodNotFound, Message: "method not found: " + request.Method}
+		return response
+	}
+	result, err := s.invoke(method, request.Params)
+	if request.ID == nil {
+		return nil
+	}
+	if err != nil {
+		response.Error = toRPCError(err)
+		return response
+	}
+	response.Result = result
+	if response.Result == nil {
+		response.Result = json.RawMessage("null")
+	}
+	return response
+}
+
+func (s *rpcServer) invoke(method rpcMethod, params json.RawMessage) (result any, err error) {
+	defer func() {
+		// The unmarshaller panics on trees it cannot convert.
+		if recovered := recover(); recovered != nil {
+			err = &RPCError{Code: RPCInvalidParams, Message: fmt.Sprint(recovered)}
+		}
+	}()
+	return method(params)
+}
+
+// rpcParams decodes method params into a struct, reporting invalid params.
+func rpcParams[T any](params json.RawMessage) (*T, error) {
+	result := new(T)
+	if len(params) == 0 {
+		return result, nil
+	}
+	err := json.Unmarshal(params, result)
+	if err != nil {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: err.Error()}
+	}
+	return result, nil
+}
+
+type RPCSourceParams struct {
+	Filename string  `json:"Filename"`
+	Source   string  `json:"Source"`
+	Options  Options `json:"Options"`
+}
+
+type RPCDocumentParams struct {
+	Document json.RawMessage `json:"Document"`
+	Options  Options         `json:"Options"`
+}
+
+type RPCQueryParams struct {
+	Filename  string          `json:"Filename"`
+	Source    string          `json:"Source"`
+	Document  json.RawMessage `json:"Document"`
+	Options   Options         `json:"Options"`
+	NodeTypes []string        `json:"NodeTypes"`
+}
+
+type RPCSourceResult struct {
+	Source string `json:"Source"`
+}
+
+type RPCQueryMatch struct {
+	Path []*PathElement `json:"Path"`
+	Node INode          `json:"Node"`
+}
+
+func sourceFilename(filename string) string {
+	if filename == "" {
+		return "main.go"
+	}
+	return filename
+}
+
+func rpcSourceToJSON(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[RPCSourceParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := EncodeSource(sourceFilename(params.Filename), strings.NewReader(params.Source), params.Options)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(encoder.Bytes()), nil
+}
+
+func rpcJSONToSource(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[RPCDocumentParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.Document) == 0 {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "Document is required"}
+	}
+	fset, tree, err := DecodeSource(bytes.NewReader(params.Document), params.Options)
+	if err != nil {
+		return nil, err
+	}
+	var output strings.Builder
+	err = PrintSource(&output, fset, tree, params.Options)
+	if err != nil {
+		return nil, err
+	}
+	return &RPCSourceResult{Source: output.String()}, nil
+}
+
+func rpcFormat(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[RPCSourceParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	source, err := format.Source([]byte(params.Source))
+	if err != nil {
+		return nil, err
+	}
+	return &RPCSourceResult{Source: string(source)}, nil
+}
+
+// rpcQuery returns every node of the requested types along with its path from
+// the file root. The file is given either as go source or as a json document.
+func rpcQuery(raw json.RawMessage) (any, error) {
+	params, err := rpcParams[RPCQueryParams](raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(params.NodeTypes) == 0 {
+		return nil, &RPCError{Code: RPCInvalidParams, Message: "NodeTypes is required"}
+	}
+
+	var file *FileNode
+	if len(params.Document) != 0 {
+		file, err = NewDecoder(bytes.NewReader(params.Document)).DecodeFile()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		marshaller := NewMarshaller(params.Options)
+		marshaller.SetSource([]byte(params.Source))
+		mode := parser.SkipObjectResolution
+		if params.Options.WithComments || params.Options.WithDirectives {
+			mode |= parser.ParseComments
+		}
+		tree, err := parser.ParseFile(marshaller.FileSet(), sourceFilename(params.Filename), params.Source, mode)
+		if err != nil {
+			return nil, err
+		}
+		file = marshaller.MarshalFile(tree)
+	}
+
+	nodeTypes := make(map[string]bool)
+	for _, nodeType := range params.NodeTypes {
+		nodeTypes[nodeType] = true
+	}
+	matches := make([]*RPCQueryMatch, 0)
+	InspectPath(file, func(path []Step) bool {
+		node := path[len(path)-1].Node
+		if nodeTypes[nodeTypeOf(node)] {
+			matches = append(matches, &RPCQueryMatch{Path: StepsToPath(path), Node: node})
+		}
+		return true
+	})
+	return matches, nil
+}
+
+// ServeRPC serves JSON-RPC 2.0 requests read from r and writes responses to w
+// until r is exhausted. Messages are framed with Content-Length headers.
+// Supported methods are go2json, json2go, query and format, see RPCSourceParams,
+// RPCDocumentParams and RPCQueryParams for their params.
+func ServeRPC(r io.Reader, w io.Writer) error {
+	server := &rpcServer{
+		conn: newRPCConn(r, w),
+		methods: map[string]rpcMethod{
+			"go2json": rpcSourceToJSON,
+			"json2go": rpcJSONToSource,
+			"query":   rpcQuery,
+			"format":  rpcFormat,
+		},
+	}
+	return server.serve()
+}
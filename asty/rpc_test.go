@@ -0,0 +1,169 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func frameForTest(messages ...string) string {
+	var result strings.Builder
+	for _, message := range messages {
+		fmt.Fprintf(&result, "Content-Length: %d\r\n\r\n%s", len(message), message)
+	}
+	return result.String()
+}
+
+func serveRPCForTest(t *testing.T, messages ...string) []json.RawMessage {
+	return serveForTest(t, ServeRPC, messages...)
+}
+
+func serveForTest(t *testing.T, serve func(io.Reader, io.Writer) error, messages ...string) []json.RawMessage {
+	var output bytes.Buffer
+	err := serve(strings.NewReader(frameForTest(messages...)), &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newRPCConn(&output, nil)
+	var responses []json.RawMessage
+	for {
+		body, err := conn.read()
+		if errors.Is(err, io.EOF) {
+			return responses
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, body)
+	}
+}
+
+func rpcRequestForTest(t *testing.T, id int, method string, params any) string {
+	data, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+type rpcResponseForTest struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+func decodeRPCResponse(t *testing.T, data json.RawMessage) *rpcResponseForTest {
+	var response rpcResponseForTest
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &response
+}
+
+func TestRPCRoundTrip(t *testing.T) {
+	options := Options{WithPositions: true, WithComments: true}
+	responses := serveRPCForTest(t,
+		rpcRequestForTest(t, 1, "go2json", &RPCSourceParams{Source: serverSource, Options: options}),
+		rpcRequestForTest(t, 2, "format", &RPCSourceParams{Source: "package   main\nvar  x=1"}),
+	)
+	if len(responses) != 2 {
+		t.Fatalf("unexpected responses %s", responses)
+	}
+	document := decodeRPCResponse(t, responses[0])
+	if document.ID != 1 || document.Error != nil {
+		t.Fatalf("unexpected response %s", responses[0])
+	}
+	formatted := decodeRPCResponse(t, responses[1])
+	if formatted.ID != 2 || string(formatted.Result) != `{"Source":"package main\n\nvar x = 1\n"}` {
+		t.Errorf("unexpected response %s", responses[1])
+	}
+
+	responses = serveRPCForTest(t,
+		rpcRequestForTest(t, 3, "json2go", &RPCDocumentParams{Document: document.Result, Options: options}),
+		rpcRequestForTest(t, 4, "query", &RPCQueryParams{Document: document.Result, NodeTypes: []string{"BasicLit"}}),
+	)
+	source := decodeRPCResponse(t, responses[0])
+	var sourceResult RPCSourceResult
+	err := json.Unmarshal(source.Result, &sourceResult)
+	if err != nil || sourceResult.Source != serverSource {
+		t.Errorf("unexpected response %s", responses[0])
+	}
+
+	query := decodeRPCResponse(t, responses[1])
+	var matches []struct {
+		Path []*PathElement
+		Node *BasicLitNode
+	}
+	err = json.Unmarshal(query.Result, &matches)
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("unexpected response %s", responses[1])
+	}
+	path := make([]string, len(matches[0].Path))
+	for index, element := range matches[0].Path {
+		path[index] = fmt.Sprintf("%s.%s[%d]", element.NodeType, element.Field, element.Index)
+	}
+	expected := "File.[-1] FuncDecl.Decls[0] BlockStmt.Body[-1] ExprStmt.List[0] CallExpr.X[-1] BasicLit.Args[0]"
+	if strings.Join(path, " ") != expected || matches[0].Node.Value != `"hello"` {
+		t.Errorf("unexpected match %v %+v", path, matches[0].Node)
+	}
+}
+
+func TestRPCBatchAndNotifications(t *testing.T) {
+	batch := "[" + rpcRequestForTest(t, 1, "format", &RPCSourceParams{Source: "package p"}) + "," +
+		`{"jsonrpc": "2.0", "method": "format", "params": {"Source": "package p"}}` + "," +
+		rpcRequestForTest(t, 2, "missing", nil) + "]"
+	responses := serveRPCForTest(t, batch, `{"jsonrpc": "2.0", "method": "format"}`)
+	if len(responses) != 1 {
+		t.Fatalf("unexpected responses %s", responses)
+	}
+	var items []*rpcResponseForTest
+	err := json.Unmarshal(responses[0], &items)
+	if err != nil || len(items) != 2 {
+		t.Fatalf("unexpected batch response %s", responses[0])
+	}
+	if items[0].ID != 1 || items[0].Error != nil || items[1].ID != 2 || items[1].Error.Code != RPCMethodNotFound {
+		t.Errorf("unexpected batch response %s", responses[0])
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	responses := serveRPCForTest(t,
+		`{"jsonrpc": "2.0", "id": 1, "method": "go2json", "params": {"Source": "package main\nfunc {"}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "go2json", "params": []}`,
+		`{"jsonrpc": "2.0", "id": 3, "method": "json2go", "params": {"Document": {"NodeType": "Field"}}}`,
+		`{"jsonrpc": "2.0", "id": 4, "method": "query", "params": {"Source": "package p"}}`,
+		`{"id": 5, "method": "format"}`,
+		`{"jsonrpc": "2.0", "id": 6, `,
+		`[]`,
+	)
+	expected := []int{RPCSourceError, RPCInvalidParams, RPCSourceError, RPCInvalidParams, RPCInvalidRequest,
+		RPCParseError, RPCInvalidRequest}
+	if len(responses) != len(expected) {
+		t.Fatalf("unexpected responses %s", responses)
+	}
+	for index, code := range expected {
+		response := decodeRPCResponse(t, responses[index])
+		if response.Error == nil || response.Error.Code != code {
+			t.Errorf("error %d expected, got %s", code, responses[index])
+		}
+	}
+	var syntaxErrors struct {
+		Error struct {
+			Data []*SourceError `json:"data"`
+		} `json:"error"`
+	}
+	err := json.Unmarshal(responses[0], &syntaxErrors)
+	if err != nil || len(syntaxErrors.Error.Data) == 0 || syntaxErrors.Error.Data[0].Line != 2 {
+		t.Errorf("syntax errors expected, got %s", responses[0])
+	}
+
+	err = ServeRPC(strings.NewReader("Content-Length: x\r\n\r\n{}"), &bytes.Buffer{})
+	if err == nil {
+		t.Error("framing error expected")
+	}
+}
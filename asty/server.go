@@ -0,0 +1,310 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ServerOptions struct {
+	MaxBodySize int64
+	Timeout     time.Duration
+}
+
+var DefaultServerOptions = ServerOptions{
+	MaxBodySize: 10 << 20,
+	Timeout:     10 * time.Second,
+}
+
+type ServerError struct {
+	Code    string         `json:"Code"`
+	Message string         `json:"Message"`
+	Errors  []*SourceError `json:"Errors,omitempty"`
+}
+
+type serverErrorResponse struct {
+	Error *ServerError `json:"Error"`
+}
+
+const (
+	ErrorBadRequest       = "bad_request"
+	ErrorMethodNotAllowed = "method_not_allowed"
+	ErrorTooLarge         = "too_large"
+	ErrorTimeout          = "timeout"
+	ErrorParse            = "parse_error"
+	ErrorInvalidTree      = "invalid_tree"
+	ErrorInternal         = "internal_error"
+)
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, code string, err error) {
+	writeJSON(w, status, &serverErrorResponse{Error: &ServerError{
+		Code:    code,
+		Message: err.Error(),
+		Errors:  sourceErrors(err),
+	}})
+}
+
+// readBodyError reports failures of reading the request body, which are
+// caused by the size limit or by the client.
+func readBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, ErrorTooLarge,
+			fmt.Errorf("request body exceeds %d bytes", tooLarge.Limit))
+		return
+	}
+	writeError(w, http.StatusBadRequest, ErrorBadRequest, err)
+}
+
+// NewServer returns a handler exposing go2json and json2go over HTTP:
+//
+//	POST /go2json  go source, or {"Filename", "Source", "Indent", "Options"}
+//	POST /json2go  json document, or {"Options", "File"}
+//	GET  /health
+//
+// Options may also be given as query parameters named after the command line
+// flags: comments, positions, spans, directives, docs, position-format,
+// references, imports, tolerant, with-source, indent and filename, and for json2go
+// tabwidth, spaces, mode, gofmt and fix-imports. Query parameters take
+// precedence over the request body.
+func NewServer(options ServerOptions) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handleHealth)
+	mux.Handle("/go2json", limitHandler(options, http.MethodPost, handleSourceToJSON))
+	mux.Handle("/json2go", limitHandler(options, http.MethodPost, handleJSONToSource))
+	return mux
+}
+
+func Serve(addr string, options ServerOptions) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           NewServer(options),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, http.StatusMethodNotAllowed, ErrorMethodNotAllowed,
+			fmt.Errorf("method %s is not allowed", r.Method))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"Status": "ok"})
+}
+
+func limitHandler(options ServerOptions, method string, handle http.HandlerFunc) http.Handler {
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, ErrorMethodNotAllowed,
+				fmt.Errorf("method %s is not allowed", r.Method))
+			return
+		}
+		if options.MaxBodySize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, options.MaxBodySize)
+		}
+		defer func() {
+			// The unmarshaller panics on trees it cannot convert.
+			if recovered := recover(); recovered != nil {
+				writeError(w, http.StatusUnprocessableEntity, ErrorInvalidTree, fmt.Errorf("%v", recovered))
+			}
+		}()
+		handle(w, r)
+	})
+	if options.Timeout <= 0 {
+		return handler
+	}
+
+	timeoutBody, _ := json.Marshal(&serverErrorResponse{Error: &ServerError{
+		Code:    ErrorTimeout,
+		Message: fmt.Sprintf("request exceeds %s", options.Timeout),
+	}})
+	handler = http.TimeoutHandler(handler, options.Timeout, string(timeoutBody))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The timeout response body is json as well.
+		w.Header().Set("Content-Type", "application/json")
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func isJSONRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+func queryOptions(query url.Values, options *Options, indent *int, filename *string) error {
+	flags := []struct {
+		name  string
+		value *bool
+	}{
+		{"comments", &options.WithComments},
+		{"positions", &options.WithPositions},
+		{"spans", &options.WithSpans},
+		{"directives", &options.WithDirectives},
+		{"docs", &options.WithDocs},
+		{"references", &options.WithReferences},
+		{"imports", &options.WithImports},
+		{"tolerant", &options.Tolerant},
+		{"spaces", &options.Spaces},
+		{"gofmt", &options.Gofmt},
+		{"fix-imports", &options.FixImports},
+	}
+	for _, flag := range flags {
+		if !query.Has(flag.name) {
+			continue
+		}
+		value, err := strconv.ParseBool(query.Get(flag.name))
+		if err != nil {
+			return fmt.Errorf("invalid %s parameter: %w", flag.name, err)
+		}
+		*flag.value = value
+	}
+	if query.Has("position-format") {
+		options.PositionFormat = query.Get("position-format")
+		err := checkPositionFormat(options.PositionFormat)
+		if err != nil {
+			return err
+		}
+	}
+	if query.Has("with-source") {
+		options.WithSource = query.Get("with-source")
+		err := checkSourceSelection(options.WithSource)
+		if err != nil {
+			return err
+		}
+	}
+	if query.Has("tabwidth") {
+		value, err := strconv.Atoi(query.Get("tabwidth"))
+		if err != nil {
+			return fmt.Errorf("invalid tabwidth parameter: %q", query.Get("tabwidth"))
+		}
+		options.TabWidth = value
+	}
+	if query.Has("mode") {
+		options.PrintMode = query.Get("mode")
+	}
+	err := checkPrintOptions(*options)
+	if err != nil {
+		return err
+	}
+	if indent != nil && query.Has("indent") {
+		value, err := strconv.Atoi(query.Get("indent"))
+		if err != nil || value < 0 {
+			return fmt.Errorf("invalid indent parameter: %q", query.Get("indent"))
+		}
+		*indent = value
+	}
+	if filename != nil && query.Has("filename") {
+		*filename = query.Get("filename")
+	}
+	return nil
+}
+
+type sourceToJSONRequest struct {
+	Filename string
+	Source   string
+	Indent   int
+	Options  Options
+}
+
+func handleSourceToJSON(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		readBodyError(w, err)
+		return
+	}
+
+	request := &sourceToJSONRequest{}
+	if isJSONRequest(r) {
+		err = json.Unmarshal(body, request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrorBadRequest, err)
+			return
+		}
+	} else {
+		request.Source = string(body)
+	}
+	err = queryOptions(r.URL.Query(), &request.Options, &request.Indent, &request.Filename)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrorBadRequest, err)
+		return
+	}
+
+	encoder, err := EncodeSource(sourceFilename(request.Filename), strings.NewReader(request.Source), request.Options)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, ErrorParse, err)
+		return
+	}
+	var output bytes.Buffer
+	err = encoder.Flush(&output, strings.Repeat(" ", request.Indent))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrorInternal, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(output.Bytes())
+}
+
+type jsonToSourceRequest struct {
+	NodeType string
+	Options  Options
+	File     json.RawMessage
+}
+
+func handleJSONToSource(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		readBodyError(w, err)
+		return
+	}
+
+	// The body is either the document itself, a node or an array of nodes,
+	// or an envelope with options.
+	var request jsonToSourceRequest
+	document := body
+	if trimmed := bytes.TrimSpace(body); len(trimmed) == 0 || trimmed[0] != '[' {
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrorBadRequest, err)
+			return
+		}
+		if request.NodeType == "" {
+			document = request.File
+		}
+	}
+	err = queryOptions(r.URL.Query(), &request.Options, nil, nil)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrorBadRequest, err)
+		return
+	}
+
+	fset, tree, err := DecodeSource(bytes.NewReader(document), request.Options)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, ErrorInvalidTree, err)
+		return
+	}
+	var output bytes.Buffer
+	err = PrintSource(&output, fset, tree, request.Options)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, ErrorInvalidTree, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/x-go; charset=utf-8")
+	_, _ = w.Write(output.Bytes())
+}
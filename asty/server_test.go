@@ -0,0 +1,150 @@
+package asty
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const serverSource = `package main
+
+// main does nothing.
+func main() {
+	println("hello")
+}
+`
+
+func postForTest(t *testing.T, server *httptest.Server, path, contentType, body string) (*http.Response, string) {
+	response, err := http.Post(server.URL+path, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, string(data)
+}
+
+func decodeServerError(t *testing.T, body string) *ServerError {
+	var response serverErrorResponse
+	err := json.Unmarshal([]byte(body), &response)
+	if err != nil || response.Error == nil {
+		t.Fatalf("error response expected, got %q", body)
+	}
+	return response.Error
+}
+
+func TestServerRoundTrip(t *testing.T) {
+	server := httptest.NewServer(NewServer(DefaultServerOptions))
+	defer server.Close()
+
+	response, document := postForTest(t, server, "/go2json?comments=true&positions=true", "text/x-go", serverSource)
+	if response.StatusCode != http.StatusOK || !strings.Contains(document, `"// main does nothing."`) {
+		t.Fatalf("unexpected response %d %q", response.StatusCode, document)
+	}
+
+	response, source := postForTest(t, server, "/json2go?comments=1&positions=1", "application/json", document)
+	if response.StatusCode != http.StatusOK || source != serverSource {
+		t.Fatalf("unexpected response %d %q", response.StatusCode, source)
+	}
+
+	request, err := json.Marshal(&sourceToJSONRequest{
+		Filename: "hello.go",
+		Source:   serverSource,
+		Indent:   2,
+		Options:  Options{WithPositions: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, document = postForTest(t, server, "/go2json", "application/json", string(request))
+	if response.StatusCode != http.StatusOK || !strings.Contains(document, "\n  \"NodeType\"") ||
+		!strings.Contains(document, `"Filename": "hello.go"`) {
+		t.Fatalf("unexpected response %d %q", response.StatusCode, document)
+	}
+
+	envelope := `{"Options": {"WithPositions": true}, "File": ` + document + `}`
+	response, source = postForTest(t, server, "/json2go", "application/json", envelope)
+	if response.StatusCode != http.StatusOK || !strings.Contains(source, `println("hello")`) {
+		t.Fatalf("unexpected response %d %q", response.StatusCode, source)
+	}
+
+	response, source = postForTest(t, server, "/json2go?spaces=true&tabwidth=2", "application/json", envelope)
+	if response.StatusCode != http.StatusOK || !strings.Contains(source, "\n  println(\"hello\")") {
+		t.Fatalf("unexpected response %d %q", response.StatusCode, source)
+	}
+	response, source = postForTest(t, server, "/json2go?mode=spaces", "application/json", envelope)
+	if response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected response %d %q", response.StatusCode, source)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	server := httptest.NewServer(NewServer(ServerOptions{MaxBodySize: 64}))
+	defer server.Close()
+
+	response, body := postForTest(t, server, "/go2json", "text/x-go", "package main\nfunc {")
+	serverError := decodeServerError(t, body)
+	if response.StatusCode != http.StatusUnprocessableEntity || serverError.Code != ErrorParse ||
+		len(serverError.Errors) == 0 || serverError.Errors[0].Line != 2 {
+		t.Errorf("unexpected parse error %d %+v", response.StatusCode, serverError)
+	}
+
+	response, body = postForTest(t, server, "/go2json", "text/x-go", serverSource)
+	if response.StatusCode != http.StatusRequestEntityTooLarge || decodeServerError(t, body).Code != ErrorTooLarge {
+		t.Errorf("unexpected response %d %q", response.StatusCode, body)
+	}
+
+	response, body = postForTest(t, server, "/go2json?comments=maybe", "text/x-go", "package main")
+	if response.StatusCode != http.StatusBadRequest || decodeServerError(t, body).Code != ErrorBadRequest {
+		t.Errorf("unexpected response %d %q", response.StatusCode, body)
+	}
+
+	response, body = postForTest(t, server, "/json2go", "application/json", `{"NodeType": "Field"}`)
+	if response.StatusCode != http.StatusUnprocessableEntity || decodeServerError(t, body).Code != ErrorInvalidTree {
+		t.Errorf("unexpected response %d %q", response.StatusCode, body)
+	}
+
+	response, err := http.Get(server.URL + "/go2json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusMethodNotAllowed || response.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("unexpected response %d", response.StatusCode)
+	}
+
+	response, err = http.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || strings.TrimSpace(string(data)) != `{"Status":"ok"}` {
+		t.Errorf("unexpected health response %d %q", response.StatusCode, data)
+	}
+}
+
+func TestServerTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handler := limitHandler(ServerOptions{Timeout: 10 * time.Millisecond}, http.MethodPost,
+		func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("")))
+	if recorder.Code != http.StatusServiceUnavailable || decodeServerError(t, recorder.Body.String()).Code != ErrorTimeout {
+		t.Errorf("unexpected response %d %q", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected content type %q", recorder.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,58 @@
+package asty
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// Nodes whose source text is attached when selected by Options.WithSource.
+const (
+	SourceStmts = "stmts"
+	SourceDecls = "decls"
+	SourceAll   = "all"
+)
+
+func checkSourceSelection(selection string) error {
+	switch selection {
+	case "", SourceStmts, SourceDecls, SourceAll:
+		return nil
+	}
+	return fmt.Errorf("unknown source selection: %s", selection)
+}
+
+// nodeSource returns the text of node in src, the source of the file it was
+// parsed from, if the node is selected. The text spans from node.Pos() to
+// node.End(), so doc comments of declarations are not included.
+func nodeSource(fset *token.FileSet, src []byte, selection string, node ast.Node) string {
+	if src == nil || node == nil {
+		return ""
+	}
+	switch selection {
+	case SourceStmts:
+		if _, ok := node.(ast.Stmt); !ok {
+			return ""
+		}
+	case SourceDecls:
+		if _, ok := node.(ast.Decl); !ok {
+			return ""
+		}
+	case SourceAll:
+	default:
+		return ""
+	}
+
+	pos, end := node.Pos(), node.End()
+	if pos == token.NoPos || end < pos {
+		return ""
+	}
+	file := fset.File(pos)
+	if file == nil || int(end) > file.Base()+file.Size() {
+		return ""
+	}
+	start, stop := file.Offset(pos), file.Offset(end)
+	if stop > len(src) {
+		return ""
+	}
+	return string(src[start:stop])
+}
@@ -0,0 +1,85 @@
+package asty
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sourceSource = `package p
+
+// f doubles.
+func f(x int) int {
+	y := x * 2 // twice
+	return y
+}
+`
+
+func TestWithSource(t *testing.T) {
+	expected := map[string][]string{
+		SourceStmts: {"{\n\ty := x * 2 // twice\n\treturn y\n}", "y := x * 2", "return y"},
+		SourceDecls: {"func f(x int) int {\n\ty := x * 2 // twice\n\treturn y\n}"},
+	}
+	for selection, sources := range expected {
+		encoder, err := EncodeSource("p.go", strings.NewReader(sourceSource), Options{WithSource: selection})
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err := NewDecoder(bytes.NewReader(encoder.Bytes())).DecodeFile()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actual []string
+		Inspect(node, func(node INode) bool {
+			if node, ok := node.(decodable); ok && node.base().Source != "" {
+				actual = append(actual, node.base().Source)
+			}
+			return true
+		})
+		if fmt.Sprint(actual) != fmt.Sprint(sources) {
+			t.Errorf("%s: unexpected sources %q", selection, actual)
+		}
+	}
+
+	encoder := encodeFragmentForTest(t, KindExpr, "a + b*c", Options{WithSource: SourceAll})
+	node, err := NewDecoder(bytes.NewReader(encoder)).DecodeExpr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := node.(*BinaryExprNode)
+	if binary.Source != "a + b*c" || binary.Y.(*BinaryExprNode).Source != "b*c" {
+		t.Errorf("unexpected sources %s", encoder)
+	}
+
+	_, err = EncodeSource("p.go", strings.NewReader(sourceSource), Options{WithSource: "exprs"})
+	if err == nil {
+		t.Error("error expected for unknown selection")
+	}
+}
+
+func TestEncoderWithSource(t *testing.T) {
+	for _, input := range encoderCorpus(t) {
+		src, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			options := Options{WithSource: SourceAll, WithComments: true, WithReferences: true}
+			expected, err := marshalWithReflection(input, src, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := encodeDirectly(input, src, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected, actual) {
+				t.Fatalf("encoder output differs from marshaller output\nexpected: %.300s\nactual:   %.300s",
+					expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package asty
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+)
+
+// Token is a single token of go source. Automatic is set for semicolons
+// inserted by the scanner at line ends. RefId is the id of the innermost node
+// containing the token in the document go2json produces for the same options
+// with references enabled.
+type Token struct {
+	Token     string        `json:"Token"`
+	Literal   string        `json:"Literal,omitempty"`
+	Pos       *PositionNode `json:"Pos"`
+	Automatic bool          `json:"Automatic,omitempty"`
+	RefId     int           `json:"RefId"`
+}
+
+// TokenStream is the result of asty tokens. Positions of tokens follow the
+// position format of the options, with the table, if any, in Positions.
+type TokenStream struct {
+	Filename  string         `json:"Filename"`
+	Tokens    []*Token       `json:"Tokens"`
+	Positions [][3]int       `json:"Positions,omitempty"`
+	Errors    []*SourceError `json:"Errors,omitempty"`
+}
+
+// ScanTokens scans go source into tokens, comments included. The source is
+// parsed and marshalled like go2json does to find the nodes containing each
+// token, so references are always enabled.
+func ScanTokens(filename string, src io.Reader, options Options) (*TokenStream, error) {
+	err := checkPositionFormat(options.PositionFormat)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	options.WithReferences = true
+	marshaller := NewMarshaller(options)
+	marshaller.SetSource(data)
+
+	mode := parser.SkipObjectResolution
+	if options.WithComments {
+		mode |= parser.ParseComments
+	}
+	if options.Tolerant {
+		mode |= parser.AllErrors
+	}
+	tree, err := parser.ParseFile(marshaller.FileSet(), filename, data, mode)
+	list := sourceErrors(err)
+	if err != nil && (!options.Tolerant || tree == nil || list == nil) {
+		return nil, err
+	}
+	file := marshaller.MarshalFile(tree)
+	tfile := marshaller.FileSet().File(tree.FileStart)
+
+	// Each offset is owned by the smallest node containing it. Nodes are
+	// visited parents first, so a child with the same span as its parent, like
+	// the expression of an ExprStmt, wins. The file owns the whole source.
+	owners := make([]int, tfile.Size()+1)
+	sizes := make([]int, tfile.Size()+1)
+	for offset := range owners {
+		owners[offset] = file.RefId
+		sizes[offset] = len(owners)
+	}
+	inspectWithAST(file, tree, func(path []Step, node ast.Node) bool {
+		start, end := node.Pos(), node.End()
+		if _, ok := node.(*ast.File); ok || start == token.NoPos || end < start {
+			return true
+		}
+		owner := path[len(path)-1].Node.(decodable).base().RefId
+		size := int(end - start)
+		for offset := tfile.Offset(start); offset < tfile.Offset(end); offset++ {
+			if size <= sizes[offset] {
+				owners[offset] = owner
+				sizes[offset] = size
+			}
+		}
+		return true
+	})
+
+	result := &TokenStream{
+		Filename: filename,
+		Tokens:   make([]*Token, 0),
+		Errors:   list,
+	}
+	var table positionTable
+	var s scanner.Scanner
+	s.Init(tfile, data, nil, scanner.ScanComments)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		position := marshaller.FileSet().PositionFor(pos, false)
+		item := &Token{
+			Token:   tok.String(),
+			Literal: lit,
+			Pos: &PositionNode{
+				Node:     Node{NodeType: "Position"},
+				Filename: position.Filename,
+				Offset:   position.Offset,
+				Line:     position.Line,
+				Column:   position.Column,
+				Format:   options.PositionFormat,
+			},
+			RefId: owners[position.Offset],
+		}
+		if options.PositionFormat == PositionTable {
+			item.Pos.Index = table.index(pos, position)
+		}
+		if tok == token.SEMICOLON && lit != ";" {
+			item.Automatic = true
+		}
+		result.Tokens = append(result.Tokens, item)
+	}
+	result.Positions = table.items
+	return result, nil
+}
+
+func TokensToJSON(input, output string, indent string, options Options) error {
+	inFile, closeIn, err := OpenRead(input)
+	if err != nil {
+		return err
+	}
+	defer closeIn()
+
+	stream, err := ScanTokens(input, inFile, options)
+	if err != nil {
+		return err
+	}
+
+	outFile, closeOut, err := OpenOrCreateWrite(output)
+	if err != nil {
+		return err
+	}
+	defer closeOut()
+
+	encoder := json.NewEncoder(outFile)
+	encoder.SetIndent("", indent)
+	return encoder.Encode(stream)
+}
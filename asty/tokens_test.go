@@ -0,0 +1,96 @@
+package asty
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const tokensSource = `package p
+
+// f doubles.
+func f(x int) int {
+	return x * 2
+}
+`
+
+func TestScanTokens(t *testing.T) {
+	options := Options{WithComments: true, WithPositions: true}
+	stream, err := ScanTokens("p.go", strings.NewReader(tokensSource), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RefIds point to nodes of the go2json document with references.
+	options.WithReferences = true
+	encoder, err := EncodeSource("p.go", strings.NewReader(tokensSource), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := NewDecoder(bytes.NewReader(encoder.Bytes())).DecodeFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeTypes := map[int]string{}
+	Inspect(file, func(node INode) bool {
+		if node, ok := node.(decodable); ok {
+			nodeTypes[node.base().RefId] = node.base().NodeType
+		}
+		return true
+	})
+
+	var actual []string
+	for _, item := range stream.Tokens {
+		text := item.Token
+		if item.Automatic {
+			text = "auto;"
+		}
+		actual = append(actual, text+":"+nodeTypes[item.RefId])
+	}
+	expected := []string{
+		"package:File", "IDENT:Ident", "auto;:File",
+		"COMMENT:Comment",
+		"func:FuncType", "IDENT:Ident", "(:FieldList", "IDENT:Ident", "IDENT:Ident", "):FieldList", "IDENT:Ident",
+		"{:BlockStmt", "return:ReturnStmt", "IDENT:Ident", "*:BinaryExpr", "INT:BasicLit", "auto;:BlockStmt",
+		"}:BlockStmt", "auto;:File",
+	}
+	if strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("unexpected tokens %v", actual)
+	}
+	if stream.Tokens[3].Literal != "// f doubles." || stream.Tokens[3].Pos.Line != 3 {
+		t.Errorf("unexpected comment %+v", stream.Tokens[3])
+	}
+}
+
+func TestTokensPositionFormats(t *testing.T) {
+	stream, err := ScanTokens("p.go", strings.NewReader("package p\n"), Options{PositionFormat: PositionTable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Filename":"p.go","Tokens":[{"Token":"package","Literal":"package","Pos":0,"RefId":1},` +
+		`{"Token":"IDENT","Literal":"p","Pos":1,"RefId":2},` +
+		`{"Token":";","Literal":"\n","Pos":2,"Automatic":true,"RefId":1}],` +
+		`"Positions":[[0,1,1],[8,1,9],[9,1,10]]}`
+	if string(data) != expected {
+		t.Errorf("unexpected stream %s", data)
+	}
+
+	_, err = ScanTokens("p.go", strings.NewReader("package p\nfunc ("), Options{})
+	if err == nil {
+		t.Error("error expected")
+	}
+	stream, err = ScanTokens("p.go", strings.NewReader("package p\nfunc ("), Options{Tolerant: true})
+	if err != nil || len(stream.Errors) == 0 || len(stream.Tokens) != 5 {
+		t.Errorf("unexpected tolerant result %+v %v", stream, err)
+	}
+
+	err = TokensToJSON(InvalidGoFile, InvalidJsonFile, "", Options{})
+	if err == nil {
+		t.Error("error expected")
+	}
+}
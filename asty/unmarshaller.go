@@ -3,6 +3,7 @@ package asty
 import (
 	"go/ast"
 	"go/token"
+	"reflect"
 )
 
 var StringToToken = map[string]token.Token{}
@@ -17,6 +18,7 @@ type Unmarshaller struct {
 	Options
 	fset       *token.FileSet
 	references map[int]any
+	positions  [][3]int
 }
 
 func NewUnmarshaller(options Options) *Unmarshaller {
@@ -53,6 +55,9 @@ func (um *Unmarshaller) FileSet() *token.FileSet {
 	return um.fset
 }
 
+// UnmarshalPositionNode accepts positions in every format. Positions without
+// a filename belong to the first file of the file set, which is the only file
+// of documents produced by go2json.
 func (um *Unmarshaller) UnmarshalPositionNode(node *PositionNode) token.Pos {
 	if !um.WithPositions {
 		return token.NoPos
@@ -60,15 +65,37 @@ func (um *Unmarshaller) UnmarshalPositionNode(node *PositionNode) token.Pos {
 	if node == nil {
 		return token.NoPos
 	}
-	pos := token.NoPos
+	var file *token.File
 	um.fset.Iterate(func(f *token.File) bool {
-		if f.Name() == node.Filename {
-			pos = f.Pos(node.Offset)
+		if node.Filename == "" || f.Name() == node.Filename {
+			file = f
 			return false
 		}
 		return true
 	})
-	return pos
+	if file == nil {
+		return token.NoPos
+	}
+
+	offset := node.Offset
+	switch node.Format {
+	case PositionOffset:
+		if um.positions != nil {
+			if offset < 0 || offset >= len(um.positions) {
+				return token.NoPos
+			}
+			offset = um.positions[offset][0]
+		}
+	case PositionCompact:
+		if node.Line < 1 || node.Line > file.LineCount() {
+			return token.NoPos
+		}
+		offset = file.Offset(file.LineStart(node.Line)) + node.Column - 1
+	}
+	if offset < 0 || offset > file.Size() {
+		return token.NoPos
+	}
+	return file.Pos(offset)
 }
 
 func (um *Unmarshaller) UnmarshalCommentNode(node *CommentNode) *ast.Comment {
@@ -746,6 +773,7 @@ func (um *Unmarshaller) UnmarshalDeclNodes(nodes []IDeclNode) []ast.Decl {
 func (um *Unmarshaller) UnmarshalFileNode(node *FileNode) *ast.File {
 	return wrapUnmarshal(um, node, func() *ast.File {
 		um.fset = node.FileSet
+		um.positions = node.Positions
 		var imports []*ast.ImportSpec = nil
 		if um.WithImports {
 			imports = um.UnmarshalImportSpecNodes(node.Imports)
@@ -762,6 +790,25 @@ func (um *Unmarshaller) UnmarshalFileNode(node *FileNode) *ast.File {
 	})
 }
 
+// UnmarshalNode converts a node created by MakeNode into the go/ast node, which
+// can be printed by go/printer.
+func (um *Unmarshaller) UnmarshalNode(node INode) ast.Node {
+	switch n := node.(type) {
+	case *FileNode:
+		return um.UnmarshalFileNode(n)
+	case IExprNode:
+		return um.UnmarshalExpr(n)
+	case IStmtNode:
+		return um.UnmarshalStmt(n)
+	case ISpecNode:
+		return um.UnmarshalSpec(n)
+	case IDeclNode:
+		return um.UnmarshalDecl(n)
+	default:
+		panic("implement me " + reflect.TypeOf(node).String())
+	}
+}
+
 func (um *Unmarshaller) UnmarshalExpr(expr IExprNode) ast.Expr {
 	if expr == nil {
 		return nil
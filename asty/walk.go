@@ -0,0 +1,525 @@
+package asty
+
+import (
+	"reflect"
+	"sort"
+)
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.
+// If the result visitor w is not nil, Walk visits each of the children
+// of node with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node INode) (w Visitor)
+}
+
+// Walk traverses a node tree in depth-first order, the same way ast.Walk does
+// for go/ast. Every child field of the node structs is visited, so nodes that
+// are listed twice in a FileNode (Imports, Comments) are visited twice.
+func Walk(v Visitor, node INode) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	walkChildren(node, func(_ string, _ int, child INode) {
+		Walk(v, child)
+	})
+	v.Visit(nil)
+}
+
+type inspector func(INode) bool
+
+func (f inspector) Visit(node INode) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a node tree in depth-first order: it starts by calling
+// f(node); if f returns true, Inspect invokes f recursively for each of the
+// non-nil children of node, followed by a call of f(nil).
+func Inspect(node INode, f func(INode) bool) {
+	Walk(inspector(f), node)
+}
+
+// Step is an element of the path from the root to a node. Field is the name of
+// the parent field holding Node and Index is its position for list fields or
+// -1 otherwise. The root step has an empty Field.
+type Step struct {
+	Node  INode
+	Field string
+	Index int
+}
+
+// InspectPath is like Inspect, but f receives the whole path from the root to
+// the current node, which is the last step. The path is reused between calls
+// and must be copied to be retained.
+func InspectPath(root INode, f func(path []Step) bool) {
+	path := []Step{{Node: root, Index: -1}}
+	var visit func()
+	visit = func() {
+		if !f(path) {
+			return
+		}
+		walkChildren(path[len(path)-1].Node, func(field string, index int, child INode) {
+			path = append(path, Step{Node: child, Field: field, Index: index})
+			visit()
+			path = path[:len(path)-1]
+		})
+	}
+	if root != nil {
+		visit()
+	}
+}
+
+func sortedFileNames(files map[string]*FileNode) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func walkChildren(node INode, f func(field string, index int, child INode)) {
+	switch n := node.(type) {
+	case *CommentNode, *BadExprNode, *IdentNode, *BasicLitNode,
+		*BadStmtNode, *EmptyStmtNode, *BadDeclNode:
+	case *CommentGroupNode:
+		for i, child := range n.List {
+			if child != nil {
+				f("List", i, child)
+			}
+		}
+	case *FieldNode:
+		if n.Doc != nil {
+			f("Doc", -1, n.Doc)
+		}
+		for i, child := range n.Names {
+			if child != nil {
+				f("Names", i, child)
+			}
+		}
+		if n.Type != nil {
+			f("Type", -1, n.Type)
+		}
+		if n.Tag != nil {
+			f("Tag", -1, n.Tag)
+		}
+		if n.Comment != nil {
+			f("Comment", -1, n.Comment)
+		}
+	case *FieldListNode:
+		for i, child := range n.List {
+			if child != nil {
+				f("List", i, child)
+			}
+		}
+	case *EllipsisNode:
+		if n.Elt != nil {
+			f("Elt", -1, n.Elt)
+		}
+	case *FuncLitNode:
+		if n.Type != nil {
+			f("Type", -1, n.Type)
+		}
+		if n.Body != nil {
+			f("Body", -1, n.Body)
+		}
+	case *CompositeLitNode:
+		if n.Type != nil {
+			f("Type", -1, n.Type)
+		}
+		for i, child := range n.Elts {
+			if child != nil {
+				f("Elts", i, child)
+			}
+		}
+	case *ParenExprNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+	case *SelectorExprNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+		if n.Sel != nil {
+			f("Sel", -1, n.Sel)
+		}
+	case *IndexExprNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+		if n.Index != nil {
+			f("Index", -1, n.Index)
+		}
+	case *IndexListExprNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+		for i, child := range n.Indices {
+			if child != nil {
+				f("Indices", i, child)
+			}
+		}
+	case *SliceExprNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+		if n.Low != nil {
+			f("Low", -1, n.Low)
+		}
+		if n.High != nil {
+			f("High", -1, n.High)
+		}
+		if n.Max != nil {
+			f("Max", -1, n.Max)
+		}
+	case *TypeAssertExprNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+		if n.Type != nil {
+			f("Type", -1, n.Type)
+		}
+	case *CallExprNode:
+		if n.Fun != nil {
+			f("Fun", -1, n.Fun)
+		}
+		for i, child := range n.Args {
+			if child != nil {
+				f("Args", i, child)
+			}
+		}
+	case *StarExprNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+	case *UnaryExprNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+	case *BinaryExprNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+		if n.Y != nil {
+			f("Y", -1, n.Y)
+		}
+	case *KeyValueExprNode:
+		if n.Key != nil {
+			f("Key", -1, n.Key)
+		}
+		if n.Value != nil {
+			f("Value", -1, n.Value)
+		}
+	case *ArrayTypeNode:
+		if n.Len != nil {
+			f("Len", -1, n.Len)
+		}
+		if n.Elt != nil {
+			f("Elt", -1, n.Elt)
+		}
+	case *StructTypeNode:
+		if n.Fields != nil {
+			f("Fields", -1, n.Fields)
+		}
+	case *FuncTypeNode:
+		if n.TypeParams != nil {
+			f("TypeParams", -1, n.TypeParams)
+		}
+		if n.Params != nil {
+			f("Params", -1, n.Params)
+		}
+		if n.Results != nil {
+			f("Results", -1, n.Results)
+		}
+	case *InterfaceTypeNode:
+		if n.Methods != nil {
+			f("Methods", -1, n.Methods)
+		}
+	case *MapTypeNode:
+		if n.Key != nil {
+			f("Key", -1, n.Key)
+		}
+		if n.Value != nil {
+			f("Value", -1, n.Value)
+		}
+	case *ChanTypeNode:
+		if n.Value != nil {
+			f("Value", -1, n.Value)
+		}
+	case *DeclStmtNode:
+		if n.Decl != nil {
+			f("Decl", -1, n.Decl)
+		}
+	case *LabeledStmtNode:
+		if n.Label != nil {
+			f("Label", -1, n.Label)
+		}
+		if n.Stmt != nil {
+			f("Stmt", -1, n.Stmt)
+		}
+	case *ExprStmtNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+	case *SendStmtNode:
+		if n.Chan != nil {
+			f("Chan", -1, n.Chan)
+		}
+		if n.Value != nil {
+			f("Value", -1, n.Value)
+		}
+	case *IncDecStmtNode:
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+	case *AssignStmtNode:
+		for i, child := range n.Lhs {
+			if child != nil {
+				f("Lhs", i, child)
+			}
+		}
+		for i, child := range n.Rhs {
+			if child != nil {
+				f("Rhs", i, child)
+			}
+		}
+	case *GoStmtNode:
+		if n.Call != nil {
+			f("Call", -1, n.Call)
+		}
+	case *DeferStmtNode:
+		if n.Call != nil {
+			f("Call", -1, n.Call)
+		}
+	case *ReturnStmtNode:
+		for i, child := range n.Results {
+			if child != nil {
+				f("Results", i, child)
+			}
+		}
+	case *BranchStmtNode:
+		if n.Label != nil {
+			f("Label", -1, n.Label)
+		}
+	case *BlockStmtNode:
+		for i, child := range n.List {
+			if child != nil {
+				f("List", i, child)
+			}
+		}
+	case *IfStmtNode:
+		if n.Init != nil {
+			f("Init", -1, n.Init)
+		}
+		if n.Cond != nil {
+			f("Cond", -1, n.Cond)
+		}
+		if n.Body != nil {
+			f("Body", -1, n.Body)
+		}
+		if n.Else != nil {
+			f("Else", -1, n.Else)
+		}
+	case *CaseClauseNode:
+		for i, child := range n.List {
+			if child != nil {
+				f("List", i, child)
+			}
+		}
+		for i, child := range n.Body {
+			if child != nil {
+				f("Body", i, child)
+			}
+		}
+	case *SwitchStmtNode:
+		if n.Init != nil {
+			f("Init", -1, n.Init)
+		}
+		if n.Tag != nil {
+			f("Tag", -1, n.Tag)
+		}
+		if n.Body != nil {
+			f("Body", -1, n.Body)
+		}
+	case *TypeSwitchStmtNode:
+		if n.Init != nil {
+			f("Init", -1, n.Init)
+		}
+		if n.Assign != nil {
+			f("Assign", -1, n.Assign)
+		}
+		if n.Body != nil {
+			f("Body", -1, n.Body)
+		}
+	case *CommClauseNode:
+		if n.Comm != nil {
+			f("Comm", -1, n.Comm)
+		}
+		for i, child := range n.Body {
+			if child != nil {
+				f("Body", i, child)
+			}
+		}
+	case *SelectStmtNode:
+		if n.Body != nil {
+			f("Body", -1, n.Body)
+		}
+	case *ForStmtNode:
+		if n.Init != nil {
+			f("Init", -1, n.Init)
+		}
+		if n.Cond != nil {
+			f("Cond", -1, n.Cond)
+		}
+		if n.Post != nil {
+			f("Post", -1, n.Post)
+		}
+		if n.Body != nil {
+			f("Body", -1, n.Body)
+		}
+	case *RangeStmtNode:
+		if n.Key != nil {
+			f("Key", -1, n.Key)
+		}
+		if n.Value != nil {
+			f("Value", -1, n.Value)
+		}
+		if n.X != nil {
+			f("X", -1, n.X)
+		}
+		if n.Body != nil {
+			f("Body", -1, n.Body)
+		}
+	case *ImportSpecNode:
+		if n.Doc != nil {
+			f("Doc", -1, n.Doc)
+		}
+		if n.Name != nil {
+			f("Name", -1, n.Name)
+		}
+		if n.Path != nil {
+			f("Path", -1, n.Path)
+		}
+		if n.Comment != nil {
+			f("Comment", -1, n.Comment)
+		}
+	case *ValueSpecNode:
+		if n.Doc != nil {
+			f("Doc", -1, n.Doc)
+		}
+		for i, child := range n.Names {
+			if child != nil {
+				f("Names", i, child)
+			}
+		}
+		if n.Type != nil {
+			f("Type", -1, n.Type)
+		}
+		for i, child := range n.Values {
+			if child != nil {
+				f("Values", i, child)
+			}
+		}
+		if n.Comment != nil {
+			f("Comment", -1, n.Comment)
+		}
+	case *TypeSpecNode:
+		if n.Doc != nil {
+			f("Doc", -1, n.Doc)
+		}
+		if n.Name != nil {
+			f("Name", -1, n.Name)
+		}
+		if n.TypeParams != nil {
+			f("TypeParams", -1, n.TypeParams)
+		}
+		if n.Type != nil {
+			f("Type", -1, n.Type)
+		}
+		if n.Comment != nil {
+			f("Comment", -1, n.Comment)
+		}
+	case *GenDeclNode:
+		if n.Doc != nil {
+			f("Doc", -1, n.Doc)
+		}
+		for i, child := range n.Specs {
+			if child != nil {
+				f("Specs", i, child)
+			}
+		}
+	case *FuncDeclNode:
+		if n.Doc != nil {
+			f("Doc", -1, n.Doc)
+		}
+		if n.Recv != nil {
+			f("Recv", -1, n.Recv)
+		}
+		if n.Name != nil {
+			f("Name", -1, n.Name)
+		}
+		if n.Type != nil {
+			f("Type", -1, n.Type)
+		}
+		if n.Body != nil {
+			f("Body", -1, n.Body)
+		}
+	case *FileNode:
+		if n.Doc != nil {
+			f("Doc", -1, n.Doc)
+		}
+		if n.Name != nil {
+			f("Name", -1, n.Name)
+		}
+		for i, child := range n.Decls {
+			if child != nil {
+				f("Decls", i, child)
+			}
+		}
+		for i, child := range n.Imports {
+			if child != nil {
+				f("Imports", i, child)
+			}
+		}
+		for i, child := range n.Unresolved {
+			if child != nil {
+				f("Unresolved", i, child)
+			}
+		}
+		for i, child := range n.Comments {
+			if child != nil {
+				f("Comments", i, child)
+			}
+		}
+	case *PackageNode:
+		for i, name := range sortedFileNames(n.Files) {
+			if child := n.Files[name]; child != nil {
+				f("Files", i, child)
+			}
+		}
+	default:
+		panic("implement me " + reflect.TypeOf(node).String())
+	}
+}
+
+// PathElement is a serializable form of Step.
+type PathElement struct {
+	NodeType string `json:"NodeType"`
+	Field    string `json:"Field,omitempty"`
+	Index    int    `json:"Index"`
+}
+
+// StepsToPath converts a path of steps into path elements.
+func StepsToPath(path []Step) []*PathElement {
+	result := make([]*PathElement, len(path))
+	for index, step := range path {
+		result[index] = &PathElement{
+			NodeType: nodeTypeOf(step.Node),
+			Field:    step.Field,
+			Index:    step.Index,
+		}
+	}
+	return result
+}
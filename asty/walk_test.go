@@ -0,0 +1,213 @@
+package asty
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func marshalFileForTest(t *testing.T, filename string, options Options) (*ast.File, *FileNode) {
+	marshaller := NewMarshaller(options)
+	mode := parser.SkipObjectResolution
+	if options.WithComments {
+		mode |= parser.ParseComments
+	}
+	tree, err := parser.ParseFile(marshaller.FileSet(), filename, nil, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree, marshaller.MarshalFile(tree)
+}
+
+func TestInspectMatchesGoAST(t *testing.T) {
+	for _, filename := range []string{"cli.go", "nodes.go", "testdata/generics.input", "testdata/statements.input"} {
+		t.Run(filename, func(t *testing.T) {
+			tree, node := marshalFileForTest(t, filename, Options{})
+
+			expected := make(map[string]int)
+			ast.Inspect(tree, func(n ast.Node) bool {
+				if n != nil {
+					expected[reflect.TypeOf(n).Elem().Name()]++
+				}
+				return true
+			})
+
+			actual := make(map[string]int)
+			Inspect(node, func(n INode) bool {
+				if n != nil {
+					actual[strings.TrimSuffix(reflect.TypeOf(n).Elem().Name(), "Node")]++
+				}
+				return true
+			})
+
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("node counts differ\nexpected: %v\nactual:   %v", expected, actual)
+			}
+		})
+	}
+}
+
+type countingVisitor struct {
+	enter *int
+	leave *int
+}
+
+func (v countingVisitor) Visit(node INode) Visitor {
+	if node == nil {
+		*v.leave++
+		return nil
+	}
+	if _, ok := node.(*FuncLitNode); ok {
+		return nil
+	}
+	*v.enter++
+	return v
+}
+
+func TestWalkPruning(t *testing.T) {
+	_, node := marshalFileForTest(t, "cli.go", Options{})
+	var enter, leave int
+	Walk(countingVisitor{enter: &enter, leave: &leave}, node)
+	if enter == 0 || enter != leave {
+		t.Errorf("unbalanced visits: %d entered, %d left", enter, leave)
+	}
+}
+
+func TestInspectPath(t *testing.T) {
+	_, node := marshalFileForTest(t, "cli.go", Options{WithComments: true})
+	InspectPath(node, func(path []Step) bool {
+		if path[0].Node != node || path[0].Field != "" {
+			t.Fatalf("unexpected root step %+v", path[0])
+		}
+		for _, step := range path[1:] {
+			if step.Field == "" {
+				t.Fatalf("missing field name in %+v", step)
+			}
+		}
+		if ident, ok := path[len(path)-1].Node.(*IdentNode); ok && ident.Name == "SourceToJSON" {
+			parent := path[len(path)-2]
+			if _, ok := parent.Node.(*FuncDeclNode); !ok || path[len(path)-1].Field != "Name" {
+				t.Errorf("unexpected parent %T via %s", parent.Node, path[len(path)-1].Field)
+			}
+			if parent.Field != "Decls" || parent.Index < 0 {
+				t.Errorf("unexpected step %+v", parent)
+			}
+		}
+		return true
+	})
+}
+
+// TestWalkCoversNodes fails when walkChildren misses a field holding nodes,
+// so that it is extended along with the node structs of nodes.go.
+func TestWalkCoversNodes(t *testing.T) {
+	tree, err := parser.ParseFile(token.NewFileSet(), "nodes.go", nil, parser.SkipObjectResolution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, decl := range tree.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			if _, ok := typeSpec.Type.(*ast.StructType); ok && strings.HasSuffix(typeSpec.Name.Name, "Node") {
+				names = append(names, typeSpec.Name.Name)
+			}
+		}
+	}
+
+	// Node types are found from the ones MakeNode creates through the
+	// fields that hold other nodes.
+	nodeInterface := reflect.TypeOf((*INode)(nil)).Elem()
+	types := make(map[string]reflect.Type)
+	var add func(typ reflect.Type)
+	add = func(typ reflect.Type) {
+		for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Pointer || typ.Elem().Kind() != reflect.Struct || !typ.Implements(nodeInterface) {
+			return
+		}
+		if _, ok := types[typ.Elem().Name()]; ok {
+			return
+		}
+		types[typ.Elem().Name()] = typ
+		for index := 0; index < typ.Elem().NumField(); index++ {
+			add(typ.Elem().Field(index).Type)
+		}
+	}
+	for _, name := range names {
+		if node := MakeNode(strings.TrimSuffix(name, "Node")); node != nil {
+			add(reflect.TypeOf(node))
+		}
+	}
+	add(reflect.TypeOf(&PackageNode{}))
+
+	// child makes a value of a field type holding a single node.
+	child := func(typ reflect.Type) (reflect.Value, bool) {
+		value := reflect.New(typ).Elem()
+		elem := typ
+		if typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+			elem = typ.Elem()
+		}
+		var node reflect.Value
+		switch {
+		case elem.Kind() == reflect.Interface && elem.Implements(nodeInterface):
+			for _, name := range names {
+				if candidate := types[name]; candidate != nil && candidate.Implements(elem) {
+					node = reflect.New(candidate.Elem())
+					break
+				}
+			}
+		case elem.Kind() == reflect.Pointer && elem.Implements(nodeInterface):
+			node = reflect.New(elem.Elem())
+		}
+		if !node.IsValid() {
+			return value, false
+		}
+		switch typ.Kind() {
+		case reflect.Slice:
+			value.Set(reflect.Append(value, node))
+		case reflect.Map:
+			value.Set(reflect.MakeMap(typ))
+			value.SetMapIndex(reflect.ValueOf("child.go"), node)
+		default:
+			value.Set(node)
+		}
+		return value, true
+	}
+
+	for _, name := range names {
+		typ := types[name]
+		if typ == nil {
+			if name != "Node" && name != "PositionNode" {
+				t.Errorf("%s is not reachable from the nodes MakeNode creates", name)
+			}
+			continue
+		}
+		node := reflect.New(typ.Elem())
+		var expected []string
+		for index := 0; index < typ.Elem().NumField(); index++ {
+			field := typ.Elem().Field(index)
+			if field.Anonymous {
+				continue
+			}
+			if value, ok := child(field.Type); ok {
+				node.Elem().Field(index).Set(value)
+				expected = append(expected, field.Name)
+			}
+		}
+		var actual []string
+		walkChildren(node.Interface().(INode), func(field string, _ int, _ INode) {
+			actual = append(actual, field)
+		})
+		if strings.Join(actual, ",") != strings.Join(expected, ",") {
+			t.Errorf("walkChildren visits %v of %s, expected %v", actual, name, expected)
+		}
+	}
+}
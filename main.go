@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/asty-org/asty/asty"
 )
@@ -13,6 +14,15 @@ const UsageString = `Usage: asty <command> [flags]
 commands:
   go2json - convert go source to json
   json2go - convert json to go source
+  clones  - report duplicated code in go files or packages (args: files, dirs or dir/...)
+  metrics - report complexity metrics of functions (args: files, dirs or dir/...)
+  api     - print the exported api of the package in a directory (args: dir)
+  apidiff - report changes of the exported api between two directories, exit 1 if any is breaking (args: old, new)
+  serve   - serve go2json and json2go over http (see -addr)
+  rpc     - serve json-rpc 2.0 requests on stdin/stdout with Content-Length framing
+  lsp     - run a language server showing asty node paths on stdin/stdout
+  at      - print nodes enclosing a position, innermost first (see -pos)
+  tokens  - print tokens of go source with the RefId of the innermost node containing each
   help    - print this message
 flags:
 `
@@ -26,7 +36,22 @@ func main() {
 	args := os.Args
 	var input, output string
 	var indent int
-	var comments, positions, references, imports bool
+	var comments, positions, spans, directives, docs, references, imports, tolerant bool
+	var minNodes int
+	var ignoreIdents, ignoreLiterals bool
+	var format string
+	var kind string
+	var positionFormat string
+	var lossless bool
+	var tabWidth int
+	var printMode string
+	var spaces, gofmt, fixImports bool
+	var original string
+	var withSource string
+	var position string
+	var addr string
+	var maxBody int64
+	var timeout time.Duration
 	fs := flag.NewFlagSet("asty", flag.ExitOnError)
 	fs.StringVar(&input, "input", "", "input file name (default: stdin)")
 	fs.StringVar(&output, "output", "", "output file name (default: stdout)")
@@ -37,6 +62,38 @@ func main() {
 		"include references to reuse nodes from multiple places (default: false)")
 	fs.BoolVar(&imports, "imports", false,
 		"include imports list into output (default: false)")
+	fs.BoolVar(&spans, "spans", false,
+		"include Pos and End positions of every node, even without -positions (default: false)")
+	fs.BoolVar(&directives, "directives", false,
+		"go2json: list comment directives and build constraints of files, functions and values (default: false)")
+	fs.BoolVar(&docs, "docs", false,
+		"go2json: parse doc comments into paragraphs, headings, code blocks, lists and links, with -comments (default: false)")
+	fs.StringVar(&positionFormat, "position-format", asty.PositionFull,
+		"encoding of positions, full, offset, compact (line:column) or table (default: full)")
+	fs.BoolVar(&lossless, "lossless", false,
+		"json2go: re-print only nodes changed since go2json, copy the rest from the original file (default: false)")
+	fs.StringVar(&original, "original", "", "json2go: original file for -lossless (default: file named in FileSet)")
+	fs.IntVar(&tabWidth, "tabwidth", asty.DefaultTabWidth, "json2go: tab width of printed source")
+	fs.BoolVar(&spaces, "spaces", false, "json2go: indent with tabwidth spaces instead of tabs (default: false)")
+	fs.StringVar(&printMode, "mode", "",
+		"json2go: comma separated printer modes, usespaces, tabindent or sourcepos (default: none)")
+	fs.BoolVar(&gofmt, "gofmt", false, "json2go: format output with gofmt, fail if it does not parse (default: false)")
+	fs.BoolVar(&fixImports, "fix-imports", false,
+		"json2go: add missing standard library imports and remove unused ones (default: false)")
+	fs.StringVar(&withSource, "with-source", "",
+		"go2json: attach source text to stmts, decls or all nodes (default: none)")
+	fs.BoolVar(&tolerant, "tolerant", false,
+		"go2json: keep the partial tree of a file with syntax errors and list the errors, -kind file only (default: false)")
+	fs.IntVar(&minNodes, "min-nodes", 30, "clones: minimal size of a duplicated subtree in nodes")
+	fs.BoolVar(&ignoreIdents, "ignore-idents", false, "clones: treat subtrees differing only in identifiers as clones")
+	fs.BoolVar(&ignoreLiterals, "ignore-literals", false, "clones: treat subtrees differing only in literals as clones")
+	fs.StringVar(&kind, "kind", asty.KindFile, "go2json: kind of go source, file, expr, stmts or decls")
+	fs.StringVar(&position, "pos", "",
+		"at: position as file.go:line:column, file.go:#offset or file.go:#start,#end")
+	fs.StringVar(&format, "format", "json", "metrics: output format, json or csv; apidiff: json or text")
+	fs.StringVar(&addr, "addr", ":8080", "serve: address to listen on")
+	fs.Int64Var(&maxBody, "max-body", asty.DefaultServerOptions.MaxBodySize, "serve: maximal request body size in bytes")
+	fs.DurationVar(&timeout, "timeout", asty.DefaultServerOptions.Timeout, "serve: maximal time to handle a request")
 
 	fs.Usage = func() {
 		fmt.Fprint(fs.Output(), UsageString)
@@ -57,18 +114,122 @@ func main() {
 		WithImports:    imports,
 		WithComments:   comments,
 		WithPositions:  positions,
+		WithSpans:      spans,
+		WithDirectives: directives,
+		WithDocs:       docs,
 		WithReferences: references,
+		Tolerant:       tolerant,
+		PositionFormat: positionFormat,
+		WithSource:     withSource,
+		TabWidth:       tabWidth,
+		PrintMode:      printMode,
+		Spaces:         spaces,
+		Gofmt:          gofmt,
+		FixImports:     fixImports,
 	}
 
 	switch args[1] {
 	case "go2json":
 		indentStr := strings.Repeat(" ", indent)
-		err := asty.SourceToJSON(input, output, indentStr, options)
+		err := asty.FragmentToJSON(input, output, indentStr, kind, options)
 		if err != nil {
 			printError(err)
 		}
 	case "json2go":
-		err := asty.JSONToSource(input, output, options)
+		var err error
+		if lossless {
+			err = asty.JSONToSourceLossless(input, output, original, options)
+		} else {
+			err = asty.JSONToSource(input, output, options)
+		}
+		if err != nil {
+			printError(err)
+		}
+	case "clones":
+		patterns := fs.Args()
+		if len(patterns) == 0 {
+			patterns = []string{"./..."}
+		}
+		indentStr := strings.Repeat(" ", indent)
+		err := asty.ClonesToJSON(patterns, output, indentStr, asty.CloneOptions{
+			MinNodes:       minNodes,
+			IgnoreIdents:   ignoreIdents,
+			IgnoreLiterals: ignoreLiterals,
+		})
+		if err != nil {
+			printError(err)
+		}
+	case "metrics":
+		patterns := fs.Args()
+		if len(patterns) == 0 {
+			patterns = []string{"./..."}
+		}
+		switch format {
+		case "json":
+			err = asty.MetricsToJSON(patterns, output, strings.Repeat(" ", indent))
+		case "csv":
+			err = asty.MetricsToCSV(patterns, output)
+		default:
+			err = fmt.Errorf("unknown format: %s", format)
+		}
+		if err != nil {
+			printError(err)
+		}
+	case "api":
+		dir := "."
+		if fs.NArg() > 0 {
+			dir = fs.Arg(0)
+		}
+		err := asty.APIToJSON(dir, output, strings.Repeat(" ", indent))
+		if err != nil {
+			printError(err)
+		}
+	case "apidiff":
+		if fs.NArg() != 2 {
+			printError(fmt.Errorf("apidiff: expected old and new directories, got %d arguments", fs.NArg()))
+		}
+		var breaking bool
+		switch format {
+		case "json":
+			breaking, err = asty.APIDiffToJSON(fs.Arg(0), fs.Arg(1), output, strings.Repeat(" ", indent))
+		case "text":
+			breaking, err = asty.APIDiffToText(fs.Arg(0), fs.Arg(1), output)
+		default:
+			err = fmt.Errorf("unknown format: %s", format)
+		}
+		if err != nil {
+			printError(err)
+		}
+		if breaking {
+			os.Exit(1)
+		}
+	case "serve":
+		err := asty.Serve(addr, asty.ServerOptions{
+			MaxBodySize: maxBody,
+			Timeout:     timeout,
+		})
+		if err != nil {
+			printError(err)
+		}
+	case "rpc":
+		err := asty.ServeRPC(os.Stdin, os.Stdout)
+		if err != nil {
+			printError(err)
+		}
+	case "lsp":
+		err := asty.ServeLSP(os.Stdin, os.Stdout)
+		if err != nil {
+			printError(err)
+		}
+	case "at":
+		indentStr := strings.Repeat(" ", indent)
+		err := asty.EnclosingToJSON(position, output, indentStr, options)
+		if err != nil {
+			printError(err)
+		}
+	case "tokens":
+		indentStr := strings.Repeat(" ", indent)
+		err := asty.TokensToJSON(input, output, indentStr, options)
 		if err != nil {
 			printError(err)
 		}